@@ -0,0 +1,277 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"time"
+)
+
+// How long frames show for when neither the animation nor the frame says
+const DefaultFrameDuration = 100 * time.Millisecond
+
+// PlayMode says what an animation does when it gets to its last frame.
+type PlayMode int
+
+const (
+	PlayLoop     PlayMode = iota // Start again from the first frame
+	PlayPingPong                 // Play backwards to the first frame, then forwards again, and so on
+	PlayOnce                     // Stop on the last frame
+)
+
+// Animation is a named sequence of sprite frames, each shown for its own time.
+type Animation struct {
+	Name      string
+	Frames    []*SpriteFrame
+	Durations []time.Duration // For each frame; missing or 0 means DefaultFrameDuration
+	Mode      PlayMode
+}
+
+// NewAnimation makes an animation of frames, each shown for the duration the sprite sheet gave it or, failing that, frameDuration.
+func NewAnimation(name string, frames []*SpriteFrame, frameDuration time.Duration, mode PlayMode) *Animation {
+	a := &Animation{Name: name, Frames: frames, Durations: make([]time.Duration, len(frames)), Mode: mode}
+	for i, f := range frames {
+		a.Durations[i] = frameDuration
+		if f.Duration > 0 {
+			a.Durations[i] = f.Duration
+		}
+	}
+	return a
+}
+
+// Animations makes an animation from each of the sheet's frame tags, as exported by Aseprite.
+// Frames without a duration of their own show for frameDuration.  Tags play in a loop, or ping-pong, as their direction says.
+func (s *SpriteSheet) Animations(frameDuration time.Duration) []*Animation {
+	var anims []*Animation
+	for _, t := range s.tags {
+		frames := append([]*SpriteFrame(nil), s.frames[t.From:t.To+1]...)
+		mode := PlayLoop
+		switch t.Direction {
+		case "reverse":
+			for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+				frames[i], frames[j] = frames[j], frames[i]
+			}
+		case "pingpong":
+			mode = PlayPingPong
+		}
+		anims = append(anims, NewAnimation(t.Name, frames, frameDuration, mode))
+	}
+	return anims
+}
+
+// duration returns how long frame i shows for.
+func (a *Animation) duration(i int) time.Duration {
+	if i < len(a.Durations) && a.Durations[i] > 0 {
+		return a.Durations[i]
+	}
+	return DefaultFrameDuration
+}
+
+// Animator is anything Canvas2d.Animate can have the frame loop advance, such as an AnimationPlayer or AnimatedImagePlayer.
+type Animator interface {
+	Tick(timestamp float64) // requestAnimationFrame timestamp, in milliseconds
+}
+
+// AnimationPlayer plays one animation at a time, out of a set of named animations from a sprite sheet.
+// Advance it with Tick from the render loop (Canvas2d.Animate does that for you each frame), or with Update,
+// and draw it with Canvas2d.DrawAnimation.
+type AnimationPlayer struct {
+	sheet *SpriteSheet
+	anims map[string]*Animation
+
+	current *Animation
+	index   int
+	dir     int           // 1 or -1, the way ping-pong is going
+	elapsed time.Duration // Time spent on the current frame
+	speed   float64
+	paused  bool
+	done    bool // A PlayOnce animation got to the end
+
+	onComplete func(name string)
+	last       float64 // Timestamp of the last Tick, in milliseconds
+	ticked     bool
+}
+
+// NewAnimationPlayer returns a player of animations drawn from sheet, playing none of them yet.
+func NewAnimationPlayer(sheet *SpriteSheet, anims ...*Animation) *AnimationPlayer {
+	p := &AnimationPlayer{sheet: sheet, anims: make(map[string]*Animation), speed: 1, dir: 1}
+	for _, a := range anims {
+		p.Add(a)
+	}
+	return p
+}
+
+// Add adds or replaces an animation, by its name.
+func (p *AnimationPlayer) Add(a *Animation) {
+	p.anims[a.Name] = a
+	if p.current != nil && p.current.Name == a.Name {
+		p.current = a
+		p.Restart()
+	}
+}
+
+// Play switches to the named animation, from its first frame, returning false if there is no such animation.
+// Playing the animation that is already playing carries on with it, unless it has finished.
+func (p *AnimationPlayer) Play(name string) bool {
+	a, ok := p.anims[name]
+	if !ok {
+		return false
+	}
+	p.paused = false
+	if a == p.current && !p.done {
+		return true
+	}
+	p.current = a
+	p.Restart()
+	return true
+}
+
+// Restart goes back to the first frame of the current animation.
+func (p *AnimationPlayer) Restart() {
+	p.index, p.dir, p.elapsed, p.done = 0, 1, 0, false
+}
+
+// Pause holds the current frame until Resume.
+func (p *AnimationPlayer) Pause() {
+	p.paused = true
+}
+
+func (p *AnimationPlayer) Resume() {
+	p.paused = false
+}
+
+// Playing reports whether an animation is running: not paused, and not stopped at the end of a PlayOnce animation.
+func (p *AnimationPlayer) Playing() bool {
+	return p.current != nil && !p.paused && !p.done
+}
+
+// Done reports whether a PlayOnce animation has got to its end.
+func (p *AnimationPlayer) Done() bool {
+	return p.done
+}
+
+// SetSpeed scales how fast animations play: 2 is twice as fast, 0.5 half speed.  Negative speeds count as 0.
+func (p *AnimationPlayer) SetSpeed(speed float64) {
+	if speed < 0 {
+		speed = 0
+	}
+	p.speed = speed
+}
+
+func (p *AnimationPlayer) Speed() float64 {
+	return p.speed
+}
+
+// OnComplete sets a function called with the animation's name when a PlayOnce animation ends, or a looping one comes back round
+// to its first frame.  It may call Play to move on to another animation.
+func (p *AnimationPlayer) OnComplete(fn func(name string)) {
+	p.onComplete = fn
+}
+
+// Current returns the name of the current animation, or "" if none has been played.
+func (p *AnimationPlayer) Current() string {
+	if p.current == nil {
+		return ""
+	}
+	return p.current.Name
+}
+
+// Index returns the position of the current frame in the current animation.
+func (p *AnimationPlayer) Index() int {
+	return p.index
+}
+
+// Frame returns the sprite frame showing now, or nil if there is none.
+func (p *AnimationPlayer) Frame() *SpriteFrame {
+	if p.current == nil || p.index >= len(p.current.Frames) {
+		return nil
+	}
+	return p.current.Frames[p.index]
+}
+
+// Sheet returns the sprite sheet the frames are drawn from.
+func (p *AnimationPlayer) Sheet() *SpriteSheet {
+	return p.sheet
+}
+
+// Tick advances the player to timestamp, in milliseconds, as passed to requestAnimationFrame callbacks.
+// The first Tick only notes the time.
+func (p *AnimationPlayer) Tick(timestamp float64) {
+	if p.ticked && timestamp > p.last {
+		p.Update(time.Duration((timestamp - p.last) * float64(time.Millisecond)))
+	}
+	p.last, p.ticked = timestamp, true
+}
+
+// Update advances the player by dt, scaled by its speed.
+func (p *AnimationPlayer) Update(dt time.Duration) {
+	a := p.current
+	if a == nil || p.paused || p.done || len(a.Frames) == 0 {
+		return
+	}
+	p.elapsed += time.Duration(float64(dt) * p.speed)
+	if a.Mode != PlayOnce {
+		// After a long stall, such as the tab being hidden, skip whole cycles rather than stepping through them
+		var cycle time.Duration
+		for i := range a.Frames {
+			cycle += a.duration(i)
+		}
+		if p.elapsed > 2*cycle {
+			p.elapsed %= cycle
+		}
+	}
+	for p.elapsed >= a.duration(p.index) {
+		p.elapsed -= a.duration(p.index)
+		if !p.step() || p.current != a { // Stopped, or the completion callback moved on to another animation
+			return
+		}
+	}
+}
+
+// step moves on a frame, returning false if the animation has stopped.
+func (p *AnimationPlayer) step() bool {
+	a := p.current
+	n := len(a.Frames)
+	switch {
+	case a.Mode == PlayOnce:
+		if p.index >= n-1 {
+			p.done, p.elapsed = true, 0
+			p.complete()
+			return false
+		}
+		p.index++
+	case a.Mode == PlayPingPong && n > 1:
+		next := p.index + p.dir
+		if next < 0 || next >= n {
+			p.dir = -p.dir
+			next = p.index + p.dir
+		}
+		p.index = next
+		if p.index == 0 {
+			p.complete()
+		}
+	default:
+		if p.index++; p.index >= n {
+			p.index = 0
+			p.complete()
+		}
+	}
+	return true
+}
+
+func (p *AnimationPlayer) complete() {
+	if p.onComplete != nil {
+		p.onComplete(p.current.Name)
+	}
+}
@@ -0,0 +1,555 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"sort"
+	"time"
+)
+
+// GIFOptions controls how animations are cut down to a GIF's 256 colours.
+type GIFOptions struct {
+	Colors  int           // Most colours in the palette, 2 to 256; 0 means 256.  One goes on transparency if any is needed
+	Dither  bool          // Spread out the rounding to the palette (Floyd-Steinberg), which hides banding in gradients but costs size
+	Palette color.Palette // Use this palette instead of choosing one to suit the frames
+}
+
+// animFrame is a frame to encode: the part of it that changed since the last, and how long it shows for.
+type animFrame struct {
+	img   *image.RGBA
+	rect  image.Rectangle
+	delay time.Duration
+}
+
+// changedFrames works out what changes from frame to frame, folding frames that change nothing into the one before.
+// With crop false every frame is kept whole.
+func changedFrames(a *AnimatedImage, crop bool) []animFrame {
+	var out []animFrame
+	for i, f := range a.Frames {
+		delay := time.Duration(0)
+		if i < len(a.Delays) {
+			delay = a.Delays[i]
+		}
+		r := f.Rect
+		if i > 0 {
+			prev := out[len(out)-1]
+			if d := diffBounds(prev.img, f); d.Empty() {
+				out[len(out)-1].delay += delay
+				continue
+			} else if crop {
+				r = d
+			}
+		}
+		out = append(out, animFrame{f, r, delay})
+	}
+	return out
+}
+
+// diffBounds returns the smallest rectangle holding every pixel that differs between a and b, which are the same size.
+func diffBounds(a, b *image.RGBA) image.Rectangle {
+	r := b.Rect
+	d := image.Rectangle{Min: r.Max, Max: r.Min}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		pa, pb := a.Pix[a.PixOffset(r.Min.X, y):a.PixOffset(r.Max.X, y)], b.Pix[b.PixOffset(r.Min.X, y):b.PixOffset(r.Max.X, y)]
+		if bytes.Equal(pa, pb) {
+			continue
+		}
+		x0, x1 := 0, len(pa)/4
+		for x0 < x1 && bytes.Equal(pa[4*x0:4*x0+4], pb[4*x0:4*x0+4]) {
+			x0++
+		}
+		for x1 > x0 && bytes.Equal(pa[4*x1-4:4*x1], pb[4*x1-4:4*x1]) {
+			x1--
+		}
+		d.Min.X, d.Max.X = minInt(d.Min.X, r.Min.X+x0), maxInt(d.Max.X, r.Min.X+x1)
+		d.Min.Y, d.Max.Y = minInt(d.Min.Y, y), maxInt(d.Max.Y, y+1)
+	}
+	if d.Empty() {
+		return image.Rectangle{}
+	}
+	return d
+}
+
+// opaqueRGBA reports whether every pixel of m is opaque.
+func opaqueRGBA(m *image.RGBA) bool {
+	for i := 3; i < len(m.Pix); i += 4 {
+		if m.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// EncodeGIF writes an animation as a GIF, with one palette for all the frames.  Only the part of each frame that changed is stored.
+// GIF delays are in hundredths of a second, and browsers slow anything under 2 down, so frames closer together than that are dropped.
+func EncodeGIF(w io.Writer, a *AnimatedImage, opts GIFOptions) error {
+	if len(a.Frames) == 0 {
+		return errors.New("canvas: no frames to encode")
+	}
+	opaque := true
+	for _, f := range a.Frames {
+		if !opaqueRGBA(f) {
+			opaque = false
+			break
+		}
+	}
+	// Drawing a transparent pixel over the last frame doesn't clear it, so frames with see through parts are stored whole
+	frames := gifTiming(changedFrames(a, opaque))
+
+	pal := opts.Palette
+	if pal == nil {
+		n := opts.Colors
+		if n <= 0 || n > 256 {
+			n = 256
+		}
+		if !opaque {
+			n-- // Leave room for transparent
+		}
+		pal = medianCut(a.Frames, maxInt(n, 1))
+		if !opaque {
+			pal = append(color.Palette{color.Transparent}, pal...)
+		}
+	}
+	q := newQuantizer(pal)
+
+	b := a.Frames[0].Rect
+	g := &gif.GIF{Config: image.Config{ColorModel: pal, Width: b.Dx(), Height: b.Dy()}}
+	switch {
+	case a.Plays == 0:
+		g.LoopCount = 0
+	case a.Plays == 1:
+		g.LoopCount = -1
+	default:
+		g.LoopCount = a.Plays - 1
+	}
+	for _, f := range frames {
+		dst := image.NewPaletted(f.rect, pal)
+		q.draw(dst, f.img, opts.Dither)
+		disposal := byte(gif.DisposalNone)
+		if !opaque {
+			disposal = gif.DisposalBackground
+		}
+		g.Image = append(g.Image, dst)
+		g.Delay = append(g.Delay, int(f.delay/(10*time.Millisecond)))
+		g.Disposal = append(g.Disposal, disposal)
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// gifTiming rounds the frame times to hundredths of a second, dropping frames that would show for less than 2.
+// Rounding the running time, rather than each delay, keeps the animation in step with the original.
+func gifTiming(frames []animFrame) []animFrame {
+	var out []animFrame
+	var at, shown time.Duration // Original time, and time in the GIF, to the start of the current frame
+	for _, f := range frames {
+		start := at
+		at += f.delay
+		if len(out) > 0 && start-shown < 20*time.Millisecond {
+			// Too soon after the last kept frame: show this one's changes along with the last one's
+			last := &out[len(out)-1]
+			last.img, last.rect = f.img, last.rect.Union(f.rect)
+			continue
+		}
+		if len(out) > 0 {
+			out[len(out)-1].delay = (start - shown + 5*time.Millisecond) / (10 * time.Millisecond) * (10 * time.Millisecond)
+			shown += out[len(out)-1].delay
+		}
+		out = append(out, f)
+	}
+	if n := len(out); n > 0 {
+		out[n-1].delay = (at - shown + 5*time.Millisecond) / (10 * time.Millisecond) * (10 * time.Millisecond)
+		if out[n-1].delay < 20*time.Millisecond {
+			out[n-1].delay = 20 * time.Millisecond
+		}
+	}
+	return out
+}
+
+// medianCut chooses n colours to suit the frames, by splitting the colours used into boxes of about equal numbers of pixels.
+// Colours are counted at 5 bits a channel, from a sample of up to about a million pixels.
+func medianCut(frames []*image.RGBA, n int) color.Palette {
+	type bin struct {
+		count   int
+		r, g, b int // Sums, for the mean
+	}
+	bins := make([]bin, 1<<15)
+	total := 0
+	for _, f := range frames {
+		total += len(f.Pix) / 4
+	}
+	step := 1 + total/(1<<20)
+	for _, f := range frames {
+		for i := 0; i < len(f.Pix); i += 4 * step {
+			a := int(f.Pix[i+3])
+			if a < 0x80 {
+				continue
+			}
+			r, g, b := int(f.Pix[i])*255/a, int(f.Pix[i+1])*255/a, int(f.Pix[i+2])*255/a
+			k := (r>>3)<<10 | (g>>3)<<5 | b>>3
+			bins[k].count++
+			bins[k].r += r
+			bins[k].g += g
+			bins[k].b += b
+		}
+	}
+	var used []int
+	for k := range bins {
+		if bins[k].count > 0 {
+			used = append(used, k)
+		}
+	}
+	if len(used) == 0 {
+		return color.Palette{color.RGBA{0, 0, 0, 0xff}}
+	}
+
+	channel := func(k, c int) int { return k >> uint(10-5*c) & 31 }
+	boxes := [][]int{used}
+	for len(boxes) < n {
+		// Split the box with the most pixels along its widest channel
+		best, bestCount := -1, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			count := 0
+			for _, k := range box {
+				count += bins[k].count
+			}
+			if count > bestCount {
+				best, bestCount = i, count
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		wide, wideRange := 0, -1
+		for c := 0; c < 3; c++ {
+			lo, hi := 31, 0
+			for _, k := range box {
+				v := channel(k, c)
+				lo, hi = minInt(lo, v), maxInt(hi, v)
+			}
+			if hi-lo > wideRange {
+				wide, wideRange = c, hi-lo
+			}
+		}
+		sort.Slice(box, func(i, j int) bool { return channel(box[i], wide) < channel(box[j], wide) })
+		half, split := 0, 1
+		for i, k := range box {
+			if half += bins[k].count; half*2 >= bestCount {
+				split = i + 1
+				break
+			}
+		}
+		if split >= len(box) {
+			split = len(box) - 1
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	pal := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var c bin
+		for _, k := range box {
+			c.count += bins[k].count
+			c.r += bins[k].r
+			c.g += bins[k].g
+			c.b += bins[k].b
+		}
+		pal = append(pal, color.RGBA{uint8(c.r / c.count), uint8(c.g / c.count), uint8(c.b / c.count), 0xff})
+	}
+	return pal
+}
+
+// quantizer maps colours to a palette, remembering the answer for each colour at 5 bits a channel.
+type quantizer struct {
+	pal         color.Palette
+	rgb         [][3]int32
+	transparent int // Index of the transparent entry, or -1
+	cache       []int16
+}
+
+func newQuantizer(pal color.Palette) *quantizer {
+	q := &quantizer{pal: pal, transparent: -1, cache: make([]int16, 1<<15)}
+	for i, c := range pal {
+		r, g, b, a := c.RGBA()
+		if a == 0 && q.transparent < 0 {
+			q.transparent = i
+		}
+		if a != 0 {
+			r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+		}
+		q.rgb = append(q.rgb, [3]int32{int32(r >> 8), int32(g >> 8), int32(b >> 8)})
+	}
+	for i := range q.cache {
+		q.cache[i] = -1
+	}
+	return q
+}
+
+// index returns the palette entry nearest the opaque colour r, g, b.
+func (q *quantizer) index(r, g, b int32) int {
+	k := (r>>3)<<10 | (g>>3)<<5 | b>>3
+	if i := q.cache[k]; i >= 0 {
+		return int(i)
+	}
+	best, bestD := 0, int32(1<<30)
+	for i, c := range q.rgb {
+		if i == q.transparent {
+			continue
+		}
+		dr, dg, db := c[0]-r, c[1]-g, c[2]-b
+		if d := dr*dr + dg*dg + db*db; d < bestD {
+			best, bestD = i, d
+		}
+	}
+	q.cache[k] = int16(best)
+	return best
+}
+
+// draw fills dst, over its bounds, with src mapped to the palette.  Mostly transparent pixels become the transparent entry, if there is one.
+func (q *quantizer) draw(dst *image.Paletted, src *image.RGBA, dither bool) {
+	r := dst.Rect
+	w := r.Dx()
+	var cur, next [][3]int32
+	if dither {
+		cur, next = make([][3]int32, w+2), make([][3]int32, w+2)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sp := src.Pix[src.PixOffset(r.Min.X, y):]
+		dp := dst.Pix[dst.PixOffset(r.Min.X, y):]
+		for x := 0; x < w; x++ {
+			p := sp[4*x : 4*x+4 : 4*x+4]
+			a := int32(p[3])
+			if a < 0x80 && q.transparent >= 0 {
+				dp[x] = uint8(q.transparent)
+				continue
+			}
+			if a == 0 {
+				a = 1
+			}
+			c := [3]int32{int32(p[0]) * 255 / a, int32(p[1]) * 255 / a, int32(p[2]) * 255 / a}
+			if dither {
+				for i := range c {
+					c[i] = clampInt32(c[i] + cur[x+1][i]/16)
+				}
+			}
+			i := q.index(c[0], c[1], c[2])
+			dp[x] = uint8(i)
+			if dither {
+				// Floyd-Steinberg: 7/16 right, 3/16 down left, 5/16 down, 1/16 down right
+				for ch := range c {
+					e := c[ch] - q.rgb[i][ch]
+					cur[x+2][ch] += e * 7
+					next[x][ch] += e * 3
+					next[x+1][ch] += e * 5
+					next[x+2][ch] += e
+				}
+			}
+		}
+		if dither {
+			cur, next = next, cur
+			for i := range next {
+				next[i] = [3]int32{}
+			}
+		}
+	}
+}
+
+func clampInt32(v int32) int32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
+
+// EncodeAPNG writes an animation as an animated PNG, in full colour.  Only the part of each frame that changed is stored.
+func EncodeAPNG(w io.Writer, a *AnimatedImage) error {
+	if len(a.Frames) == 0 {
+		return errors.New("canvas: no frames to encode")
+	}
+	opaque := true
+	for _, f := range a.Frames {
+		if !opaqueRGBA(f) {
+			opaque = false
+			break
+		}
+	}
+	frames := changedFrames(a, true) // Frames replace what they cover, transparency and all, so can always be cropped
+
+	bw := bufio.NewWriter(w)
+	b := a.Frames[0].Rect
+	bw.Write(pngSignature)
+	hdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(b.Dy()))
+	hdr[8], hdr[9] = 8, 6 // 8 bits a channel, RGBA
+	if opaque {
+		hdr[9] = 2 // RGB
+	}
+	writePNGChunk(bw, "IHDR", hdr)
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+	binary.BigEndian.PutUint32(actl[4:], uint32(a.Plays))
+	writePNGChunk(bw, "acTL", actl)
+
+	seq := uint32(0)
+	var at, shown time.Duration // Original time, and time in the APNG, to the end of the current frame
+	for i, f := range frames {
+		fc := make([]byte, 26)
+		binary.BigEndian.PutUint32(fc[0:], seq)
+		binary.BigEndian.PutUint32(fc[4:], uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(fc[8:], uint32(f.rect.Dy()))
+		binary.BigEndian.PutUint32(fc[12:], uint32(f.rect.Min.X-b.Min.X))
+		binary.BigEndian.PutUint32(fc[16:], uint32(f.rect.Min.Y-b.Min.Y))
+		// Delays are whole milliseconds; round the running time so 60fps frames don't all come out short
+		at += f.delay
+		ms := (at - shown + time.Millisecond/2) / time.Millisecond
+		if ms > 0xffff {
+			ms = 0xffff
+		}
+		shown += ms * time.Millisecond
+		binary.BigEndian.PutUint16(fc[20:], uint16(ms))
+		binary.BigEndian.PutUint16(fc[22:], 1000)
+		// Dispose none and blend source, both 0
+		writePNGChunk(bw, "fcTL", fc)
+		seq++
+
+		data, err := pngImageData(f.img, f.rect, !opaque)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			writePNGChunk(bw, "IDAT", data)
+			continue
+		}
+		fd := make([]byte, 4, 4+len(data))
+		binary.BigEndian.PutUint32(fd, seq)
+		writePNGChunk(bw, "fdAT", append(fd, data...))
+		seq++
+	}
+	writePNGChunk(bw, "IEND", nil)
+	return bw.Flush()
+}
+
+// pngImageData returns the compressed scanlines of the r part of m, as RGBA or RGB, not premultiplied.
+// Each line uses whichever PNG filter leaves the smallest numbers, as image/png does.
+func pngImageData(m *image.RGBA, r image.Rectangle, alpha bool) ([]byte, error) {
+	bpp := 3
+	if alpha {
+		bpp = 4
+	}
+	n := bpp * r.Dx()
+	prev, line := make([]byte, n), make([]byte, n)
+	var filtered [5][]byte
+	for i := range filtered {
+		filtered[i] = make([]byte, n+1)
+		filtered[i][0] = byte(i)
+	}
+	var buf bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&buf, zlib.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sp := m.Pix[m.PixOffset(r.Min.X, y):]
+		for x, j := 0, 0; x < r.Dx(); x, j = x+1, j+bpp {
+			p := sp[4*x : 4*x+4 : 4*x+4]
+			a := uint32(p[3])
+			switch a {
+			case 0xff:
+				copy(line[j:j+3], p[:3])
+			case 0:
+				line[j], line[j+1], line[j+2] = 0, 0, 0
+			default:
+				line[j], line[j+1], line[j+2] = uint8(uint32(p[0])*0xff/a), uint8(uint32(p[1])*0xff/a), uint8(uint32(p[2])*0xff/a)
+			}
+			if alpha {
+				line[j+3] = p[3]
+			}
+		}
+		best, bestSum := 0, -1
+		for ft := 0; ft < 5; ft++ {
+			out := filtered[ft][1:]
+			sum := 0
+			for i := range line {
+				var left, upLeft byte
+				if i >= bpp {
+					left, upLeft = line[i-bpp], prev[i-bpp]
+				}
+				up := prev[i]
+				var v byte
+				switch ft {
+				case 0:
+					v = line[i]
+				case 1:
+					v = line[i] - left
+				case 2:
+					v = line[i] - up
+				case 3:
+					v = line[i] - byte((int(left)+int(up))/2)
+				case 4:
+					v = line[i] - paeth(left, up, upLeft)
+				}
+				out[i] = v
+				sum += int(int8(v)) * sign(int8(v))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = ft, sum
+			}
+		}
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev, line = line, prev
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func sign(v int8) int {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
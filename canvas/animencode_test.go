@@ -0,0 +1,169 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// movingSquare makes an animation of a square crossing a gradient, with a see through background if transparent.
+func movingSquare(delays []time.Duration, plays int, transparent bool) *AnimatedImage {
+	a := &AnimatedImage{Delays: delays, Plays: plays}
+	for i := range delays {
+		m := image.NewRGBA(image.Rect(0, 0, 40, 30))
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				c := color.RGBA{uint8(x * 6), uint8(y * 8), 90, 255}
+				if transparent {
+					c = color.RGBA{}
+				}
+				if x >= 8*i && x < 8*i+10 && y >= 10 && y < 20 {
+					c = color.RGBA{250, 40, 20, 255}
+				}
+				m.SetRGBA(x, y, c)
+			}
+		}
+		a.Frames = append(a.Frames, m)
+	}
+	return a
+}
+
+// frameError returns the biggest difference of any channel between two frames.
+func frameError(a, b *image.RGBA) int {
+	d := 0
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			ca, cb := a.RGBAAt(x, y), b.RGBAAt(x, y)
+			for _, v := range []int{int(ca.R) - int(cb.R), int(ca.G) - int(cb.G), int(ca.B) - int(cb.B), int(ca.A) - int(cb.A)} {
+				if v < 0 {
+					v = -v
+				}
+				if v > d {
+					d = v
+				}
+			}
+		}
+	}
+	return d
+}
+
+// roundTrip encodes the animation and decodes it again, checking it comes back within tolerance of each pixel.
+func roundTrip(t *testing.T, name string, a *AnimatedImage, encode func(*bytes.Buffer) error, tolerance int) *AnimatedImage {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	got, err := DecodeAnimated(&buf)
+	if err != nil {
+		t.Fatalf("%s: decoding: %v", name, err)
+	}
+	if len(got.Frames) != len(a.Frames) {
+		t.Fatalf("%s: %d frames, want %d", name, len(got.Frames), len(a.Frames))
+	}
+	if got.Plays != a.Plays {
+		t.Errorf("%s: plays %d, want %d", name, got.Plays, a.Plays)
+	}
+	for i := range a.Frames {
+		if got.Delays[i] != a.Delays[i] {
+			t.Errorf("%s: frame %d delay %v, want %v", name, i, got.Delays[i], a.Delays[i])
+		}
+		if d := frameError(got.Frames[i], a.Frames[i]); d > tolerance {
+			t.Errorf("%s: frame %d off by up to %d, want at most %d", name, i, d, tolerance)
+		}
+	}
+	return got
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	ms := time.Millisecond
+	delays := []time.Duration{50 * ms, 100 * ms, 30 * ms, 70 * ms}
+	for _, plays := range []int{0, 1, 3} {
+		for _, transparent := range []bool{false, true} {
+			a := movingSquare(delays, plays, transparent)
+			roundTrip(t, "APNG", a, func(w *bytes.Buffer) error {
+				return EncodeAPNG(w, a)
+			}, 0)
+			// 256 colours are plenty for the gradient to come back close
+			roundTrip(t, "GIF", a, func(w *bytes.Buffer) error {
+				return EncodeGIF(w, a, GIFOptions{})
+			}, 24)
+			roundTrip(t, "dithered GIF", a, func(w *bytes.Buffer) error {
+				return EncodeGIF(w, a, GIFOptions{Colors: 64, Dither: true})
+			}, 80)
+		}
+	}
+}
+
+func TestEncodeGIFTiming(t *testing.T) {
+	// GIF can't show frames under 20ms, so those fold into the next kept one, and the total time is kept
+	ms := time.Millisecond
+	a := movingSquare([]time.Duration{40 * ms, 8 * ms, 8 * ms, 33 * ms, 47 * ms}, 0, false)
+	var buf bytes.Buffer
+	if err := EncodeGIF(&buf, a, GIFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeAnimated(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{40 * ms, 50 * ms, 50 * ms} // Frames at 0, 40 and 89ms, ending at 136
+	if len(got.Delays) != len(want) {
+		t.Fatalf("delays %v, want %v", got.Delays, want)
+	}
+	for i := range want {
+		if got.Delays[i] != want[i] {
+			t.Errorf("delays %v, want %v", got.Delays, want)
+			break
+		}
+	}
+	if got.Duration() != 140*ms {
+		t.Errorf("duration %v, want 140ms, the original to the hundredth", got.Duration())
+	}
+	if d := frameError(got.Frames[len(got.Frames)-1], a.Frames[len(a.Frames)-1]); d > 24 {
+		t.Errorf("last frame off by up to %d", d)
+	}
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	r := NewRecorder()
+	r.Start()
+	frames := movingSquare(make([]time.Duration, 4), 0, false).Frames
+	for i, at := range []float64{1000, 1040, 1100, 1180} {
+		r.Capture(frames[i], at)
+	}
+	var buf bytes.Buffer
+	if err := r.EncodeAPNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeAnimated(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := time.Millisecond
+	want := []time.Duration{40 * ms, 60 * ms, 80 * ms, 80 * ms}
+	for i := range want {
+		if i >= len(got.Delays) || got.Delays[i] != want[i] {
+			t.Fatalf("delays %v, want %v", got.Delays, want)
+		}
+		if d := frameError(got.Frames[i], frames[i]); d != 0 {
+			t.Errorf("frame %d off by up to %d", i, d)
+		}
+	}
+}
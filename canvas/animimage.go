@@ -0,0 +1,490 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// AnimatedImage is a decoded animated GIF or APNG, with every frame fully composited, ready to draw as it is.
+type AnimatedImage struct {
+	Frames []*image.RGBA
+	Delays []time.Duration // How long each frame shows for
+	Plays  int             // How many times the animation plays through; 0 is forever
+}
+
+// Duration returns the time one play through takes.
+func (a *AnimatedImage) Duration() time.Duration {
+	var d time.Duration
+	for _, delay := range a.Delays {
+		d += delay
+	}
+	return d
+}
+
+// Largest animation decoded, in pixels a frame: 4096 x 4096.  Every frame is kept whole, so bigger ones
+// from uploaded files could take all the memory there is.
+const maxAnimationPixels = 1 << 24
+
+// checkAnimationSize returns an error if an animation of w x h pixels is empty or too big to decode.
+func checkAnimationSize(w, h int) error {
+	if w <= 0 || h <= 0 || int64(w)*int64(h) > maxAnimationPixels {
+		return fmt.Errorf("canvas: animation size %dx%d is empty or too big", w, h)
+	}
+	return nil
+}
+
+// DecodeAnimated decodes an animated GIF or APNG, telling them apart by their headers.  A still PNG or GIF gives one frame.
+// Animations bigger than 4096 x 4096 pixels a frame are refused.
+func DecodeAnimated(r io.Reader) (*AnimatedImage, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		return DecodeGIF(bytes.NewReader(data))
+	case bytes.HasPrefix(data, pngSignature):
+		return DecodeAPNG(bytes.NewReader(data))
+	}
+	return nil, errors.New("canvas: not a GIF or PNG")
+}
+
+// DecodeGIF decodes all the frames of a GIF, applying each frame's disposal method as browsers do.
+func DecodeGIF(r io.Reader) (*AnimatedImage, error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, m := range g.Image {
+		bounds = bounds.Union(m.Bounds()) // Some encoders write a logical screen too small for the frames
+	}
+	if err := checkAnimationSize(bounds.Dx(), bounds.Dy()); err != nil {
+		return nil, err
+	}
+	c := newFrameComposer(bounds)
+	for i, m := range g.Image {
+		dispose := disposeNone
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				dispose = disposeBackground // Browsers clear to transparent, not the background colour
+			case gif.DisposalPrevious:
+				dispose = disposePrevious
+			}
+		}
+		delay := 0
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+		}
+		c.add(m, m.Bounds(), draw.Over, dispose, time.Duration(delay)*10*time.Millisecond)
+	}
+	a := c.result()
+	switch {
+	case g.LoopCount == 0:
+		a.Plays = 0
+	case g.LoopCount < 0:
+		a.Plays = 1
+	default:
+		a.Plays = g.LoopCount + 1 // LoopCount is repeats after the first play
+	}
+	return a, nil
+}
+
+// DecodeAPNG decodes all the frames of an animated PNG.  A PNG without animation gives one frame.
+func DecodeAPNG(r io.Reader) (*AnimatedImage, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// Check the header before anything is sized from it
+	cfg, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAnimationSize(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	bounds := image.Rect(0, 0, cfg.Width, cfg.Height)
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	type apngFrame struct {
+		rect     image.Rectangle
+		delay    time.Duration
+		dispose  int
+		blend    draw.Op
+		data     [][]byte
+		hasImage bool
+	}
+	var (
+		ihdr     []byte
+		extra    []pngChunk // Chunks the frames need too, such as PLTE and tRNS
+		frames   []*apngFrame
+		cur      *apngFrame
+		animated bool
+		plays    int
+		seenIDAT bool
+	)
+	for _, ch := range chunks {
+		switch ch.typ {
+		case "IHDR":
+			if len(ch.data) < 13 {
+				return nil, errors.New("canvas: bad PNG header")
+			}
+			ihdr = ch.data
+		case "acTL":
+			if len(ch.data) < 8 {
+				return nil, errors.New("canvas: bad APNG acTL chunk")
+			}
+			animated, plays = true, int(binary.BigEndian.Uint32(ch.data[4:]))
+		case "fcTL":
+			d := ch.data
+			if len(d) < 26 {
+				return nil, errors.New("canvas: bad APNG fcTL chunk")
+			}
+			w, h := int64(binary.BigEndian.Uint32(d[4:])), int64(binary.BigEndian.Uint32(d[8:]))
+			x, y := int64(binary.BigEndian.Uint32(d[12:])), int64(binary.BigEndian.Uint32(d[16:]))
+			if w == 0 || h == 0 || x+w > int64(cfg.Width) || y+h > int64(cfg.Height) {
+				return nil, errors.New("canvas: APNG frame is empty or outside the image")
+			}
+			num, den := int(binary.BigEndian.Uint16(d[20:])), int(binary.BigEndian.Uint16(d[22:]))
+			if den == 0 {
+				den = 100
+			}
+			cur = &apngFrame{
+				rect:    image.Rect(int(x), int(y), int(x+w), int(y+h)),
+				delay:   time.Duration(num) * time.Second / time.Duration(den),
+				dispose: int(d[24]), // The APNG values match ours
+				blend:   draw.Src,
+			}
+			if d[25] == 1 {
+				cur.blend = draw.Over
+			}
+			frames = append(frames, cur)
+		case "IDAT":
+			seenIDAT = true
+			if cur != nil { // With no fcTL before it, the default image isn't part of the animation
+				cur.data = append(cur.data, ch.data)
+				cur.hasImage = true
+			}
+		case "fdAT":
+			if cur != nil && len(ch.data) > 4 {
+				cur.data = append(cur.data, ch.data[4:])
+				cur.hasImage = true
+			}
+		default:
+			if !seenIDAT && ch.typ != "IEND" {
+				extra = append(extra, ch)
+			}
+		}
+	}
+	if ihdr == nil {
+		return nil, errors.New("canvas: PNG has no header")
+	}
+	if !animated || len(frames) == 0 {
+		m, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		c := newFrameComposer(bounds)
+		c.add(m, c.canvas.Rect, draw.Src, disposeNone, 0)
+		return c.result(), nil
+	}
+
+	c := newFrameComposer(bounds)
+	for i, f := range frames {
+		if !f.hasImage {
+			continue
+		}
+		m, err := decodeAPNGFrame(ihdr, extra, f.rect.Size(), f.data)
+		if err != nil {
+			return nil, fmt.Errorf("canvas: APNG frame %d: %v", i, err)
+		}
+		dispose := f.dispose
+		if i == 0 && dispose == disposePrevious {
+			dispose = disposeBackground // Nothing before the first frame to go back to
+		}
+		c.add(m, f.rect, f.blend, dispose, f.delay)
+	}
+	a := c.result()
+	a.Plays = plays
+	return a, nil
+}
+
+// decodeAPNGFrame decodes one frame's image data, by wrapping it up as a PNG of its own.
+func decodeAPNGFrame(ihdr []byte, extra []pngChunk, size image.Point, data [][]byte) (image.Image, error) {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	hdr := append([]byte(nil), ihdr...)
+	binary.BigEndian.PutUint32(hdr[0:], uint32(size.X))
+	binary.BigEndian.PutUint32(hdr[4:], uint32(size.Y))
+	writePNGChunk(&buf, "IHDR", hdr)
+	for _, ch := range extra {
+		writePNGChunk(&buf, ch.typ, ch.data)
+	}
+	writePNGChunk(&buf, "IDAT", bytes.Join(data, nil))
+	writePNGChunk(&buf, "IEND", nil)
+	return png.Decode(&buf)
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunks splits a PNG file into its chunks, up to IEND.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("canvas: not a PNG")
+	}
+	data = data[len(pngSignature):]
+	var chunks []pngChunk
+	for len(data) >= 12 {
+		n := binary.BigEndian.Uint32(data)
+		if uint64(n) > uint64(len(data)-12) {
+			return nil, errors.New("canvas: PNG chunk runs past the end of the file")
+		}
+		ch := pngChunk{string(data[4:8]), data[8 : 8+n]}
+		chunks = append(chunks, ch)
+		data = data[12+n:]
+		if ch.typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// writePNGChunk writes a chunk with its length and checksum.
+func writePNGChunk(w io.Writer, typ string, data []byte) {
+	var b [8]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(len(data)))
+	copy(b[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(b[4:])
+	crc.Write(data)
+	w.Write(b[:])
+	w.Write(data)
+	binary.BigEndian.PutUint32(b[:4], crc.Sum32())
+	w.Write(b[:4])
+}
+
+// What happens to a frame's area once it has been shown, shared by GIF and APNG
+const (
+	disposeNone       = iota // Leave it for the next frame to draw over
+	disposeBackground        // Clear it to transparent
+	disposePrevious          // Put back what was there before
+)
+
+// frameComposer builds up the frames of an animation, each drawn over what the last left behind.
+type frameComposer struct {
+	canvas *image.RGBA
+	anim   *AnimatedImage
+}
+
+func newFrameComposer(r image.Rectangle) *frameComposer {
+	return &frameComposer{canvas: image.NewRGBA(r), anim: &AnimatedImage{}}
+}
+
+// frameDelay gives the time a frame with delay shows for.  Delays of 10ms or less show for 100ms, as browsers do,
+// so "as fast as possible" animations don't race.
+func frameDelay(delay time.Duration) time.Duration {
+	if delay <= 10*time.Millisecond {
+		return 100 * time.Millisecond
+	}
+	return delay
+}
+
+// add draws m into r with op, keeps a copy of the result as the next frame, then disposes of r.
+func (c *frameComposer) add(m image.Image, r image.Rectangle, op draw.Op, dispose int, delay time.Duration) {
+	var saved *image.RGBA
+	if dispose == disposePrevious {
+		saved = image.NewRGBA(r)
+		draw.Draw(saved, r, c.canvas, r.Min, draw.Src)
+	}
+	draw.Draw(c.canvas, r, m, m.Bounds().Min, op)
+
+	frame := image.NewRGBA(c.canvas.Rect)
+	copy(frame.Pix, c.canvas.Pix)
+	c.anim.Frames = append(c.anim.Frames, frame)
+	c.anim.Delays = append(c.anim.Delays, frameDelay(delay))
+
+	switch dispose {
+	case disposeBackground:
+		draw.Draw(c.canvas, r, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		draw.Draw(c.canvas, r, saved, r.Min, draw.Src)
+	}
+}
+
+func (c *frameComposer) result() *AnimatedImage {
+	return c.anim
+}
+
+// AnimatedImagePlayer plays an AnimatedImage in time with the render loop.  Canvas2d.Animate has the frame loop advance it,
+// and Canvas2d.DrawAnimatedImage draws the frame it is showing.
+type AnimatedImagePlayer struct {
+	anim    *AnimatedImage
+	index   int
+	elapsed time.Duration
+	played  int // Times played through
+	speed   float64
+	paused  bool
+	done    bool
+	changed bool
+
+	onComplete func()
+	last       float64
+	ticked     bool
+}
+
+// NewAnimatedImagePlayer returns a player showing the first frame of a.
+func NewAnimatedImagePlayer(a *AnimatedImage) *AnimatedImagePlayer {
+	return &AnimatedImagePlayer{anim: a, speed: 1, changed: true}
+}
+
+// Image returns the animation being played.
+func (p *AnimatedImagePlayer) Image() *AnimatedImage {
+	return p.anim
+}
+
+// Frame returns the frame showing now, or nil if the animation has no frames.
+func (p *AnimatedImagePlayer) Frame() *image.RGBA {
+	if p.index >= len(p.anim.Frames) {
+		return nil
+	}
+	p.changed = false
+	return p.anim.Frames[p.index]
+}
+
+// Index returns the number of the frame showing now.
+func (p *AnimatedImagePlayer) Index() int {
+	return p.index
+}
+
+// Changed reports whether the frame to show has changed since Frame was last called, so the canvas needs drawing again.
+func (p *AnimatedImagePlayer) Changed() bool {
+	return p.changed
+}
+
+// Restart goes back to the first frame and play.
+func (p *AnimatedImagePlayer) Restart() {
+	p.changed = p.changed || p.index != 0
+	p.index, p.elapsed, p.played, p.done = 0, 0, 0, false
+}
+
+// Pause holds the current frame until Resume.
+func (p *AnimatedImagePlayer) Pause() {
+	p.paused = true
+}
+
+func (p *AnimatedImagePlayer) Resume() {
+	p.paused = false
+}
+
+// Done reports whether the animation has played as many times as it says, and stopped on its last frame.
+func (p *AnimatedImagePlayer) Done() bool {
+	return p.done
+}
+
+// SetSpeed scales how fast the animation plays.  Negative speeds count as 0.
+func (p *AnimatedImagePlayer) SetSpeed(speed float64) {
+	if speed < 0 {
+		speed = 0
+	}
+	p.speed = speed
+}
+
+func (p *AnimatedImagePlayer) Speed() float64 {
+	return p.speed
+}
+
+// OnComplete sets a function called when the animation has played as many times as it says.
+func (p *AnimatedImagePlayer) OnComplete(fn func()) {
+	p.onComplete = fn
+}
+
+// Tick advances the player to timestamp, in milliseconds, as passed to requestAnimationFrame callbacks.
+// The first Tick only notes the time.
+func (p *AnimatedImagePlayer) Tick(timestamp float64) {
+	if p.ticked && timestamp > p.last {
+		p.Update(time.Duration((timestamp - p.last) * float64(time.Millisecond)))
+	}
+	p.last, p.ticked = timestamp, true
+}
+
+// delay returns how long frame i shows for.  Frames missing a delay, or with a tiny one, as an AnimatedImage
+// built by hand might have, get the same delay DecodeAnimated would give them.
+func (p *AnimatedImagePlayer) delay(i int) time.Duration {
+	if i < len(p.anim.Delays) {
+		return frameDelay(p.anim.Delays[i])
+	}
+	return frameDelay(0)
+}
+
+// duration returns the time one play through takes, going by delay.
+func (p *AnimatedImagePlayer) duration() time.Duration {
+	var d time.Duration
+	for i := range p.anim.Frames {
+		d += p.delay(i)
+	}
+	return d
+}
+
+// Update advances the player by dt, scaled by its speed.
+func (p *AnimatedImagePlayer) Update(dt time.Duration) {
+	a := p.anim
+	n := len(a.Frames)
+	if p.paused || p.done || n < 2 {
+		return
+	}
+	p.elapsed += time.Duration(float64(dt) * p.speed)
+	if total := p.duration(); a.Plays == 0 && p.elapsed > 2*total {
+		p.elapsed %= total // Skip whole plays after a long stall, such as the tab being hidden
+	}
+	for p.elapsed >= p.delay(p.index) {
+		p.elapsed -= p.delay(p.index)
+		if p.index == n-1 {
+			p.played++
+			if a.Plays > 0 && p.played >= a.Plays {
+				p.done, p.elapsed = true, 0
+				if p.onComplete != nil {
+					p.onComplete()
+				}
+				return
+			}
+			p.index = 0
+		} else {
+			p.index++
+		}
+		p.changed = true
+	}
+}
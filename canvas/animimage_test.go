@@ -0,0 +1,148 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"testing"
+	"time"
+)
+
+func testAnimation(frames int, delays []time.Duration, plays int) *AnimatedImage {
+	a := &AnimatedImage{Delays: delays, Plays: plays}
+	for i := 0; i < frames; i++ {
+		a.Frames = append(a.Frames, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	}
+	return a
+}
+
+func TestAnimatedImagePlayer(t *testing.T) {
+	ms := time.Millisecond
+	p := NewAnimatedImagePlayer(testAnimation(3, []time.Duration{50 * ms, 100 * ms, 200 * ms}, 0))
+	steps := []struct {
+		dt    time.Duration
+		index int
+	}{
+		{40 * ms, 0}, {10 * ms, 1}, {99 * ms, 1}, {1 * ms, 2}, {200 * ms, 0},
+		{350*ms*10 + 60*ms, 1}, // Long stalls skip whole plays
+	}
+	for i, s := range steps {
+		p.Update(s.dt)
+		if p.Index() != s.index {
+			t.Errorf("step %d: frame %d, want %d", i, p.Index(), s.index)
+		}
+	}
+}
+
+func TestAnimatedImagePlayerBadDelays(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		delays []time.Duration
+		plays  int
+	}{
+		{"no delays forever", nil, 0},
+		{"zero delays forever", []time.Duration{0, 0, 0}, 0},
+		{"zero delays once", []time.Duration{0, 0, 0}, 1},
+		{"too few delays", []time.Duration{50 * ms}, 0},
+	}
+	for _, tt := range tests {
+		p := NewAnimatedImagePlayer(testAnimation(3, tt.delays, tt.plays))
+		completed := 0
+		p.OnComplete(func() { completed++ })
+
+		// Missing and tiny delays show for 100ms, as DecodeAnimated gives them
+		p.Update(99 * ms)
+		if p.Index() != 0 && tt.delays != nil && tt.delays[0] == 0 {
+			t.Errorf("%s: frame %d after 99ms, want 0", tt.name, p.Index())
+		}
+		p.Update(time.Hour)
+		switch {
+		case tt.plays > 0 && (!p.Done() || completed != 1 || p.Index() != 2):
+			t.Errorf("%s: done %v, completed %d times, frame %d; want done once on the last frame", tt.name, p.Done(), completed, p.Index())
+		case tt.plays == 0 && (p.Done() || p.Index() > 2):
+			t.Errorf("%s: done %v at frame %d, want it playing", tt.name, p.Done(), p.Index())
+		}
+	}
+}
+
+// patchPNG rewrites the chunks of a PNG file with fn, fixing up their checksums.
+func patchPNG(t *testing.T, data []byte, fn func(typ string, data []byte)) []byte {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, ch := range chunks {
+		d := append([]byte(nil), ch.data...)
+		fn(ch.typ, d)
+		writePNGChunk(&buf, ch.typ, d)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeAPNGBadSizes(t *testing.T) {
+	ms := time.Millisecond
+	var buf bytes.Buffer
+	if err := EncodeAPNG(&buf, testAnimation(2, []time.Duration{50 * ms, 50 * ms}, 0)); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+	if _, err := DecodeAnimated(bytes.NewReader(good)); err != nil {
+		t.Fatalf("unpatched: %v", err)
+	}
+
+	be := binary.BigEndian
+	tests := []struct {
+		name  string
+		patch func(typ string, d []byte)
+	}{
+		{"huge header", func(typ string, d []byte) {
+			if typ == "IHDR" {
+				be.PutUint32(d, 0x7fffffff)
+				be.PutUint32(d[4:], 0x7fffffff)
+			}
+		}},
+		{"too many pixels", func(typ string, d []byte) {
+			if typ == "IHDR" {
+				be.PutUint32(d, 5000)
+				be.PutUint32(d[4:], 5000)
+			}
+		}},
+		{"frame past the right", func(typ string, d []byte) {
+			if typ == "fcTL" {
+				be.PutUint32(d[12:], 1)
+			}
+		}},
+		{"frame offset wrapping", func(typ string, d []byte) {
+			if typ == "fcTL" {
+				be.PutUint32(d[16:], 0xffffffff)
+			}
+		}},
+		{"empty frame", func(typ string, d []byte) {
+			if typ == "fcTL" {
+				be.PutUint32(d[4:], 0)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeAnimated(bytes.NewReader(patchPNG(t, good, tt.patch))); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,672 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Unicode Bidirectional Algorithm (UAX #9, https://www.unicode.org/reports/tr9/) so right to left scripts
+// such as Hebrew and Arabic are displayed in the correct order, mixed with left to right text and numbers.
+// Character classes come from golang.org/x/text, the algorithm itself is implemented here.
+
+// TextDirection is the base direction of a paragraph of text.
+type TextDirection int
+
+const (
+	DirectionAuto TextDirection = iota // Taken from the first strong character, left to right if there is none
+	DirectionLTR
+	DirectionRTL
+)
+
+// Maximum explicit embedding depth (BD2)
+const bidiMaxDepth = 125
+
+// bidiParagraph holds the resolved embedding levels of a paragraph.
+type bidiParagraph struct {
+	runes   []rune
+	offsets []int        // Byte offset of each rune in the source string
+	initial []bidi.Class // Classes before resolution, needed for L1
+	levels  []uint8
+	base    uint8 // Paragraph embedding level, 0 or 1
+}
+
+// resolveBidi runs the algorithm up to resolving embedding levels (rules P2 to I2) for a single paragraph.
+// Line breaking and reordering are left to visualOrder, as levels must be resolved over the whole paragraph.
+func resolveBidi(s string, dir TextDirection) *bidiParagraph {
+	p := &bidiParagraph{}
+	for i, r := range s {
+		p.runes = append(p.runes, r)
+		p.offsets = append(p.offsets, i)
+		prop, _ := bidi.LookupRune(r)
+		p.initial = append(p.initial, prop.Class())
+	}
+	n := len(p.runes)
+	classes := append([]bidi.Class(nil), p.initial...)
+	p.levels = make([]uint8, n)
+
+	matching := p.matchIsolates()
+	switch dir {
+	case DirectionLTR:
+		p.base = 0
+	case DirectionRTL:
+		p.base = 1
+	default:
+		p.base = p.firstStrong(0, n, matching)
+	}
+	if n == 0 {
+		return p
+	}
+
+	p.resolveExplicit(classes, matching)
+
+	// X9: explicit formatting characters (and boundary neutrals) are ignored from here on, removed just leaves them out of each sequence
+	removed := make([]bool, n)
+	for i, c := range classes {
+		switch c {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO, bidi.PDF, bidi.BN:
+			removed[i] = true
+		}
+	}
+
+	for _, seq := range p.isolatingSequences(classes, removed, matching) {
+		p.resolveSequence(seq, classes)
+	}
+
+	// Removed characters take the level of the character before them, so they don't break up runs when reordering
+	for i := range removed {
+		if removed[i] {
+			if i > 0 {
+				p.levels[i] = p.levels[i-1]
+			} else {
+				p.levels[i] = p.base
+			}
+		}
+	}
+	return p
+}
+
+// matchIsolates finds the matching PDI for every isolate initiator (BD9).  -1 where there is none.
+func (p *bidiParagraph) matchIsolates() []int {
+	matching := make([]int, len(p.runes))
+	var stack []int
+	for i, c := range p.initial {
+		matching[i] = -1
+		switch c {
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			stack = append(stack, i)
+		case bidi.PDI:
+			if len(stack) > 0 {
+				matching[stack[len(stack)-1]] = i
+				stack = stack[:len(stack)-1]
+			}
+		case bidi.B:
+			stack = stack[:0]
+		}
+	}
+	return matching
+}
+
+// firstStrong returns the level (0 or 1) given by the first strong character in [start, end), skipping isolates (P2, P3).
+func (p *bidiParagraph) firstStrong(start, end int, matching []int) uint8 {
+	for i := start; i < end; i++ {
+		switch p.initial[i] {
+		case bidi.L:
+			return 0
+		case bidi.R, bidi.AL:
+			return 1
+		case bidi.LRI, bidi.RLI, bidi.FSI:
+			if matching[i] < 0 {
+				return 0
+			}
+			i = matching[i]
+		case bidi.B:
+			return 0
+		}
+	}
+	return 0
+}
+
+type bidiStatus struct {
+	level    uint8
+	override bidi.Class // L, R, or ON for no override
+	isolate  bool
+}
+
+// resolveExplicit applies the explicit embeddings, overrides and isolates (X1 to X8).
+func (p *bidiParagraph) resolveExplicit(classes []bidi.Class, matching []int) {
+	stack := []bidiStatus{{level: p.base, override: bidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+
+	nextLevel := func(rtl bool) uint8 {
+		l := stack[len(stack)-1].level
+		if rtl {
+			return (l + 1) | 1
+		}
+		return (l + 2) &^ 1
+	}
+
+	for i, c := range classes {
+		top := stack[len(stack)-1]
+		switch c {
+		case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO: // X2 - X5
+			p.levels[i] = top.level
+			l := nextLevel(c == bidi.RLE || c == bidi.RLO)
+			if l <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				s := bidiStatus{level: l, override: bidi.ON}
+				if c == bidi.RLO {
+					s.override = bidi.R
+				} else if c == bidi.LRO {
+					s.override = bidi.L
+				}
+				stack = append(stack, s)
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case bidi.RLI, bidi.LRI, bidi.FSI: // X5a - X5c
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+			rtl := c == bidi.RLI
+			if c == bidi.FSI {
+				end := matching[i]
+				if end < 0 {
+					end = len(classes)
+				}
+				rtl = p.firstStrong(i+1, end, matching) == 1
+			}
+			l := nextLevel(rtl)
+			if l <= bidiMaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, bidiStatus{level: l, override: bidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case bidi.PDI: // X6a
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+
+		case bidi.PDF: // X7
+			p.levels[i] = top.level
+			if overflowIsolates > 0 {
+				// Nothing
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) >= 2 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case bidi.B: // X8
+			p.levels[i] = p.base
+
+		case bidi.BN:
+			p.levels[i] = top.level
+
+		default: // X6
+			p.levels[i] = top.level
+			if top.override != bidi.ON {
+				classes[i] = top.override
+			}
+		}
+	}
+}
+
+// isolatingSequence is a set of level runs that are resolved together (BD13), with its start and end of sequence types.
+type isolatingSequence struct {
+	indexes  []int
+	level    uint8
+	sos, eos bidi.Class
+}
+
+// isolatingSequences splits the non removed characters into level runs and joins runs across isolates (X10).
+func (p *bidiParagraph) isolatingSequences(classes []bidi.Class, removed []bool, matching []int) []isolatingSequence {
+	var runs [][]int
+	var run []int
+	for i := range classes {
+		if removed[i] {
+			continue
+		}
+		if len(run) > 0 && p.levels[run[len(run)-1]] != p.levels[i] {
+			runs = append(runs, run)
+			run = nil
+		}
+		run = append(run, i)
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	runOf := make(map[int]int, len(runs)) // First index of a run -> run number
+	for k, r := range runs {
+		runOf[r[0]] = k
+	}
+	matched := make([]bool, len(classes)) // PDIs that close an isolate initiator
+	for _, m := range matching {
+		if m >= 0 {
+			matched[m] = true
+		}
+	}
+	isIsolateInit := func(c bidi.Class) bool { return c == bidi.LRI || c == bidi.RLI || c == bidi.FSI }
+
+	var seqs []isolatingSequence
+	for _, r := range runs {
+		// Runs starting with a matched PDI were already joined to the sequence of their initiator
+		if matched[r[0]] {
+			continue
+		}
+		var indexes []int
+		for {
+			indexes = append(indexes, r...)
+			last := r[len(r)-1]
+			if !isIsolateInit(p.initial[last]) || matching[last] < 0 {
+				break
+			}
+			k, ok := runOf[matching[last]]
+			if !ok {
+				break
+			}
+			r = runs[k]
+		}
+		seqs = append(seqs, p.newSequence(indexes, classes, removed, matching))
+	}
+	return seqs
+}
+
+func (p *bidiParagraph) newSequence(indexes []int, classes []bidi.Class, removed []bool, matching []int) isolatingSequence {
+	first, last := indexes[0], indexes[len(indexes)-1]
+	level := p.levels[first]
+
+	prev := p.base
+	for i := first - 1; i >= 0; i-- {
+		if !removed[i] {
+			prev = p.levels[i]
+			break
+		}
+	}
+	next := p.base
+	c := p.initial[last]
+	if !(c == bidi.LRI || c == bidi.RLI || c == bidi.FSI) || matching[last] >= 0 {
+		for i := last + 1; i < len(classes); i++ {
+			if !removed[i] {
+				next = p.levels[i]
+				break
+			}
+		}
+	}
+	return isolatingSequence{
+		indexes: indexes,
+		level:   level,
+		sos:     levelClass(maxLevel(level, prev)),
+		eos:     levelClass(maxLevel(p.levels[last], next)),
+	}
+}
+
+// resolveSequence applies the weak, neutral and implicit rules (W1 to I2) to one isolating run sequence.
+func (p *bidiParagraph) resolveSequence(seq isolatingSequence, classes []bidi.Class) {
+	idx := seq.indexes
+	t := make([]bidi.Class, len(idx))
+	for k, i := range idx {
+		t[k] = classes[i]
+	}
+
+	// W1: non spacing marks take the type of the previous character
+	for k := range t {
+		if t[k] != bidi.NSM {
+			continue
+		}
+		switch {
+		case k == 0:
+			t[k] = seq.sos
+		case isIsolateControl(t[k-1]):
+			t[k] = bidi.ON
+		default:
+			t[k] = t[k-1]
+		}
+	}
+	// W2: European numbers after Arabic letters become Arabic numbers.  W3: Arabic letters become R
+	lastStrong := seq.sos
+	for k, c := range t {
+		switch c {
+		case bidi.L, bidi.R, bidi.AL:
+			lastStrong = c
+		case bidi.EN:
+			if lastStrong == bidi.AL {
+				t[k] = bidi.AN
+			}
+		}
+	}
+	for k := range t {
+		if t[k] == bidi.AL {
+			t[k] = bidi.R
+		}
+	}
+	// W4: a single separator between two numbers of the same type joins them
+	for k := 1; k+1 < len(t); k++ {
+		if t[k] == bidi.ES && t[k-1] == bidi.EN && t[k+1] == bidi.EN {
+			t[k] = bidi.EN
+		} else if t[k] == bidi.CS && t[k-1] == t[k+1] && (t[k-1] == bidi.EN || t[k-1] == bidi.AN) {
+			t[k] = t[k-1]
+		}
+	}
+	// W5: terminators next to European numbers become European numbers
+	for k := 0; k < len(t); k++ {
+		if t[k] != bidi.ET {
+			continue
+		}
+		end := k
+		for end < len(t) && t[end] == bidi.ET {
+			end++
+		}
+		if (k > 0 && t[k-1] == bidi.EN) || (end < len(t) && t[end] == bidi.EN) {
+			for j := k; j < end; j++ {
+				t[j] = bidi.EN
+			}
+		}
+		k = end - 1
+	}
+	// W6: remaining separators and terminators become neutral
+	for k, c := range t {
+		if c == bidi.ES || c == bidi.ET || c == bidi.CS {
+			t[k] = bidi.ON
+		}
+	}
+	// W7: European numbers in left to right context become L
+	lastStrong = seq.sos
+	for k, c := range t {
+		switch c {
+		case bidi.L, bidi.R:
+			lastStrong = c
+		case bidi.EN:
+			if lastStrong == bidi.L {
+				t[k] = bidi.L
+			}
+		}
+	}
+
+	p.resolveBrackets(seq, t)
+
+	// N1, N2: runs of neutrals take the direction around them if both sides agree, otherwise the embedding direction
+	embedding := levelClass(seq.level)
+	for k := 0; k < len(t); k++ {
+		if !isNeutral(t[k]) {
+			continue
+		}
+		end := k
+		for end < len(t) && isNeutral(t[end]) {
+			end++
+		}
+		before, after := seq.sos, seq.eos
+		if k > 0 {
+			before = strongClass(t[k-1])
+		}
+		if end < len(t) {
+			after = strongClass(t[end])
+		}
+		dir := embedding
+		if before == after {
+			dir = before
+		}
+		for j := k; j < end; j++ {
+			t[j] = dir
+		}
+		k = end - 1
+	}
+
+	// I1, I2: implicit levels
+	for k, i := range idx {
+		l := p.levels[i]
+		switch {
+		case l&1 == 0 && t[k] == bidi.R:
+			l++
+		case l&1 == 0 && (t[k] == bidi.AN || t[k] == bidi.EN):
+			l += 2
+		case l&1 == 1 && (t[k] == bidi.L || t[k] == bidi.EN || t[k] == bidi.AN):
+			l++
+		}
+		p.levels[i] = l
+	}
+}
+
+// resolveBrackets applies N0, giving paired brackets a consistent direction based on their content and context.
+func (p *bidiParagraph) resolveBrackets(seq isolatingSequence, t []bidi.Class) {
+	type pair struct{ open, close int }
+	var pairs []pair
+	type opener struct {
+		k     int
+		close rune
+	}
+	var stack []opener
+	// BD16, pair up brackets that are still neutral
+outer:
+	for k, i := range seq.indexes {
+		if t[k] != bidi.ON {
+			continue
+		}
+		r := p.runes[i]
+		prop, _ := bidi.LookupRune(r)
+		if !prop.IsBracket() {
+			continue
+		}
+		if prop.IsOpeningBracket() {
+			if len(stack) == 63 {
+				break
+			}
+			stack = append(stack, opener{k, mirrorRune(r)})
+			continue
+		}
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].close == r || (stack[j].close == 0x232A && r == 0x3009) || (stack[j].close == 0x3009 && r == 0x232A) {
+				pairs = append(pairs, pair{stack[j].k, k})
+				stack = stack[:j]
+				continue outer
+			}
+		}
+	}
+	// Process in order of the opening brackets
+	for a := 1; a < len(pairs); a++ {
+		for b := a; b > 0 && pairs[b].open < pairs[b-1].open; b-- {
+			pairs[b], pairs[b-1] = pairs[b-1], pairs[b]
+		}
+	}
+
+	embedding := levelClass(seq.level)
+	for _, pr := range pairs {
+		var inside bidi.Class = bidi.ON
+		for k := pr.open + 1; k < pr.close; k++ {
+			s := strongClass(t[k])
+			if s == embedding {
+				inside = embedding
+				break
+			}
+			if s == bidi.L || s == bidi.R {
+				inside = s
+			}
+		}
+		if inside == bidi.ON {
+			continue // No strong type inside, leave for N1 / N2
+		}
+		dir := embedding
+		if inside != embedding {
+			// Opposite direction inside, use it if the context before the bracket matches
+			before := seq.sos
+			for k := pr.open - 1; k >= 0; k-- {
+				if s := strongClass(t[k]); s == bidi.L || s == bidi.R {
+					before = s
+					break
+				}
+			}
+			if before == inside {
+				dir = inside
+			}
+		}
+		t[pr.open], t[pr.close] = dir, dir
+		// Marks following a bracket take its new type
+		for _, k := range []int{pr.open, pr.close} {
+			for j := k + 1; j < len(t) && p.initial[seq.indexes[j]] == bidi.NSM; j++ {
+				t[j] = dir
+			}
+		}
+	}
+}
+
+// visualOrder returns the indexes of runes [start, end) in display order, left to right, after applying L1 and L2 to that line.
+// lineLevels holds the level of each rune of order, also in display order.
+func (p *bidiParagraph) visualOrder(start, end int) (order []int, lineLevels []uint8) {
+	n := end - start
+	lineLevels = append([]uint8(nil), p.levels[start:end]...)
+
+	// L1: separators, and whitespace at the end of the line or before a separator, go back to the paragraph level
+	trailing := true
+	for k := n - 1; k >= 0; k-- {
+		switch c := p.initial[start+k]; c {
+		case bidi.S, bidi.B:
+			lineLevels[k] = p.base
+			trailing = true
+		case bidi.WS, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI, bidi.BN,
+			bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO, bidi.PDF:
+			if trailing {
+				lineLevels[k] = p.base
+			}
+		default:
+			trailing = false
+		}
+	}
+
+	// L2: from the highest level down to the lowest odd level, reverse every run at that level or higher
+	order = make([]int, n)
+	var highest, lowestOdd uint8 = 0, bidiMaxDepth + 2
+	for k, l := range lineLevels {
+		order[k] = start + k
+		if l > highest {
+			highest = l
+		}
+		if l&1 == 1 && l < lowestOdd {
+			lowestOdd = l
+		}
+	}
+	for l := highest; l >= lowestOdd && l > 0; l-- {
+		for k := 0; k < n; k++ {
+			if lineLevels[k] < l {
+				continue
+			}
+			e := k
+			for e < n && lineLevels[e] >= l {
+				e++
+			}
+			for a, b := k, e-1; a < b; a, b = a+1, b-1 {
+				order[a], order[b] = order[b], order[a]
+				lineLevels[a], lineLevels[b] = lineLevels[b], lineLevels[a]
+			}
+			k = e
+		}
+	}
+	return order, lineLevels
+}
+
+// isBidiControl reports whether the rune at i is an explicit directional formatting character, which is not drawn.
+func (p *bidiParagraph) isBidiControl(i int) bool {
+	switch p.initial[i] {
+	case bidi.RLE, bidi.LRE, bidi.RLO, bidi.LRO, bidi.PDF, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	r := p.runes[i]
+	return r == 0x200E || r == 0x200F || r == 0x061C // LRM, RLM, ALM
+}
+
+func isIsolateControl(c bidi.Class) bool {
+	return c == bidi.LRI || c == bidi.RLI || c == bidi.FSI || c == bidi.PDI
+}
+
+// isNeutral reports whether c is a neutral or isolate formatting type for N1 / N2
+func isNeutral(c bidi.Class) bool {
+	switch c {
+	case bidi.B, bidi.S, bidi.WS, bidi.ON, bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return true
+	}
+	return false
+}
+
+// strongClass maps numbers to R, as they count as right to left for resolving neutrals
+func strongClass(c bidi.Class) bidi.Class {
+	if c == bidi.EN || c == bidi.AN {
+		return bidi.R
+	}
+	return c
+}
+
+func levelClass(l uint8) bidi.Class {
+	if l&1 == 1 {
+		return bidi.R
+	}
+	return bidi.L
+}
+
+func maxLevel(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// mirrorRune returns the mirrored form of r for right to left display (Bidi_Mirroring_Glyph), or r if it has none.
+// Covers the brackets, quotes and maths symbols in common use.
+func mirrorRune(r rune) rune {
+	if m, ok := mirrors[r]; ok {
+		return m
+	}
+	return r
+}
+
+var mirrors = func() map[rune]rune {
+	pairs := []rune{
+		'(', ')', '<', '>', '[', ']', '{', '}', '«', '»',
+		0x0F3A, 0x0F3B, 0x0F3C, 0x0F3D, 0x169B, 0x169C,
+		0x2039, 0x203A, 0x2045, 0x2046, 0x207D, 0x207E, 0x208D, 0x208E,
+		0x2208, 0x220B, 0x2209, 0x220C, 0x220A, 0x220D, 0x2264, 0x2265,
+		0x2266, 0x2267, 0x226A, 0x226B, 0x226E, 0x226F, 0x2270, 0x2271,
+		0x2282, 0x2283, 0x2284, 0x2285, 0x2286, 0x2287, 0x2288, 0x2289,
+		0x228A, 0x228B, 0x22A2, 0x22A3, 0x22D6, 0x22D7, 0x22DC, 0x22DD,
+		0x2308, 0x2309, 0x230A, 0x230B, 0x2329, 0x232A,
+		0x2768, 0x2769, 0x276A, 0x276B, 0x276C, 0x276D, 0x276E, 0x276F,
+		0x2770, 0x2771, 0x2772, 0x2773, 0x2774, 0x2775, 0x27E6, 0x27E7,
+		0x27E8, 0x27E9, 0x27EA, 0x27EB, 0x2983, 0x2984, 0x2985, 0x2986,
+		0x3008, 0x3009, 0x300A, 0x300B, 0x300C, 0x300D, 0x300E, 0x300F,
+		0x3010, 0x3011, 0x3014, 0x3015, 0x3016, 0x3017, 0x3018, 0x3019,
+		0x301A, 0x301B, 0xFF08, 0xFF09, 0xFF1C, 0xFF1E, 0xFF3B, 0xFF3D,
+		0xFF5B, 0xFF5D, 0xFF5F, 0xFF60, 0xFF62, 0xFF63,
+	}
+	m := make(map[rune]rune, len(pairs))
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m[pairs[i]] = pairs[i+1]
+		m[pairs[i+1]] = pairs[i]
+	}
+	return m
+}()
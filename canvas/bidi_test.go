@@ -0,0 +1,121 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"testing"
+)
+
+// visual returns s in display order, with right to left brackets mirrored and bidi controls dropped.
+func visual(s string, dir TextDirection) (string, []uint8) {
+	p := resolveBidi(s, dir)
+	order, levels := p.visualOrder(0, len(p.runes))
+	var out []rune
+	var outLevels []uint8
+	for k, i := range order {
+		if p.isBidiControl(i) {
+			continue
+		}
+		r := p.runes[i]
+		if levels[k]&1 == 1 {
+			r = mirrorRune(r)
+		}
+		out = append(out, r)
+		outLevels = append(outLevels, levels[k])
+	}
+	return string(out), outLevels
+}
+
+func TestBidiReorder(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		dir  TextDirection
+		want string
+	}{
+		{"latin", "abc def", DirectionAuto, "abc def"},
+		{"hebrew", "אבג דה", DirectionAuto, "הד גבא"},
+		{"hebrew in ltr", "abc אבג def", DirectionLTR, "abc גבא def"},
+		{"latin in rtl", "אבג abc דה", DirectionAuto, "הד abc גבא"},
+		{"forced rtl", "abc def", DirectionRTL, "abc def"},
+		{"forced ltr", "אבג דה", DirectionLTR, "הד גבא"},
+
+		// Numbers keep their digits left to right
+		{"number in rtl", "אבג 123", DirectionAuto, "123 גבא"},
+		{"number after hebrew in ltr", "abc אבג 123", DirectionLTR, "abc 123 גבא"},
+		{"leading number", "123 אב", DirectionAuto, "בא 123"},
+		{"number with separators", "אב 1,234.5", DirectionRTL, "1,234.5 בא"},
+		{"arabic digits", "ب ١٢٣", DirectionAuto, "١٢٣ ب"},
+
+		// Brackets pair up, and mirror when right to left
+		{"brackets in rtl", "אב(גד)", DirectionAuto, "(דג)בא"},
+		{"hebrew in brackets in ltr", "a (אב) c", DirectionLTR, "a (בא) c"},
+		{"latin in brackets in rtl", "אב (cd) גד", DirectionRTL, "דג (cd) בא"},
+		{"mirrored pairs", "א[ב]<ג>", DirectionRTL, "<ג>[ב]א"},
+
+		// Isolates reorder within themselves only
+		{"rtl isolate", "a\u2067b אג\u2069d", DirectionLTR, "aגא bd"},
+		{"ltr isolate in rtl", "א\u2066b c\u2069ב", DirectionRTL, "בb cא"},
+	}
+	for _, tt := range tests {
+		if got, _ := visual(tt.text, tt.dir); got != tt.want {
+			t.Errorf("%s: %q shows as %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBidiLevels(t *testing.T) {
+	// Levels come back in display order: the number is at level 2, and shows first
+	_, levels := visual("אב 12", DirectionRTL)
+	want := []uint8{2, 2, 1, 1, 1}
+	for k := range want {
+		if k >= len(levels) || levels[k] != want[k] {
+			t.Fatalf("levels %v, want %v", levels, want)
+		}
+	}
+
+	// Trailing whitespace goes back to the paragraph level (L1)
+	_, levels = visual("abc אב  ", DirectionLTR)
+	if l := levels[len(levels)-1]; l != 0 {
+		t.Errorf("trailing space at level %d, want 0", l)
+	}
+}
+
+func TestBidiLines(t *testing.T) {
+	// Each line is reordered on its own, with the paragraph's levels
+	p := resolveBidi("abc אבג דהו xyz", DirectionLTR)
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 8, "abc גבא"},
+		{8, 15, "והד xyz"},
+	}
+	for _, tt := range tests {
+		order, _ := p.visualOrder(tt.start, tt.end)
+		var out []rune
+		for _, i := range order {
+			out = append(out, p.runes[i])
+		}
+		got := string(out)
+		// The space ending the first line is at the paragraph level, so stays at the end
+		if tt.start == 0 {
+			got = got[:len(got)-1]
+		}
+		if got != tt.want {
+			t.Errorf("line %d-%d shows as %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
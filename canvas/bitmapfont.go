@@ -0,0 +1,479 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/llgcode/draw2d"
+)
+
+// BitmapFont is a pixel font, drawn without anti-aliasing at whole number scales.
+// Load one from a BDF file with ParseBDF, or from a sheet of equally sized cells with NewGridFont.
+type BitmapFont struct {
+	Name    string
+	Ascent  int // Pixels above the baseline, at scale 1
+	Descent int // Pixels below the baseline, at scale 1
+	Default rune
+
+	glyphs map[rune]*BitmapGlyph
+	scaled map[bitmapKey]*BitmapGlyph
+}
+
+// BitmapGlyph is a single glyph of a BitmapFont.  Mask pixels are either fully set (0xff) or clear.
+type BitmapGlyph struct {
+	Mask    *image.Alpha
+	Offset  image.Point // Top left of Mask relative to the glyph origin on the baseline
+	Advance int
+}
+
+type bitmapKey struct {
+	r     rune
+	scale int
+}
+
+// NewBitmapFont creates an empty font, ready for glyphs to be added with SetGlyph.
+func NewBitmapFont(name string, ascent, descent int) *BitmapFont {
+	return &BitmapFont{
+		Name:    name,
+		Ascent:  ascent,
+		Descent: descent,
+		Default: -1,
+		glyphs:  make(map[rune]*BitmapGlyph),
+		scaled:  make(map[bitmapKey]*BitmapGlyph),
+	}
+}
+
+// SetGlyph adds or replaces the glyph for r.
+func (b *BitmapFont) SetGlyph(r rune, g *BitmapGlyph) {
+	b.glyphs[r] = g
+	for k := range b.scaled {
+		if k.r == r {
+			delete(b.scaled, k)
+		}
+	}
+}
+
+// Glyph returns the glyph for r, the Default glyph if the font doesn't have r, or nil if it has neither.
+func (b *BitmapFont) Glyph(r rune) *BitmapGlyph {
+	if g, ok := b.glyphs[r]; ok {
+		return g
+	}
+	return b.glyphs[b.Default]
+}
+
+// HasGlyph reports whether the font has its own glyph for r.
+func (b *BitmapFont) HasGlyph(r rune) bool {
+	_, ok := b.glyphs[r]
+	return ok
+}
+
+// glyphAt returns the glyph for r enlarged scale times, caching the result.
+func (b *BitmapFont) glyphAt(r rune, scale int) *BitmapGlyph {
+	if scale <= 1 {
+		return b.Glyph(r)
+	}
+	key := bitmapKey{r, scale}
+	if g, ok := b.scaled[key]; ok {
+		return g
+	}
+	g := b.Glyph(r)
+	if g != nil {
+		g = g.scale(scale)
+	}
+	b.scaled[key] = g
+	return g
+}
+
+// scale enlarges a glyph by whole pixels, so it stays sharp.
+func (g *BitmapGlyph) scale(n int) *BitmapGlyph {
+	s := &BitmapGlyph{Offset: g.Offset.Mul(n), Advance: g.Advance * n}
+	if g.Mask == nil {
+		return s
+	}
+	sr := g.Mask.Bounds()
+	s.Mask = image.NewAlpha(image.Rect(0, 0, sr.Dx()*n, sr.Dy()*n))
+	for y := 0; y < s.Mask.Rect.Dy(); y++ {
+		for x := 0; x < s.Mask.Rect.Dx(); x++ {
+			s.Mask.Pix[y*s.Mask.Stride+x] = g.Mask.AlphaAt(sr.Min.X+x/n, sr.Min.Y+y/n).A
+		}
+	}
+	return s
+}
+
+// Metrics returns the font metrics at a whole number scale, in the same form as truetype font metrics.
+func (b *BitmapFont) Metrics(scale int) FontMetrics {
+	scale = bitmapScale(scale)
+	m := FontMetrics{
+		Size:       float64((b.Ascent + b.Descent) * scale),
+		Ascent:     float64(b.Ascent * scale),
+		Descent:    float64(b.Descent * scale),
+		UnitsPerEm: b.Ascent + b.Descent,
+	}
+	m.LineHeight = m.Ascent + m.Descent
+	// Measured from the ink, as grid sheet glyphs fill their whole cell
+	if g := b.glyphs['x']; g != nil {
+		m.XHeight = -g.ink().Top * float64(scale)
+	}
+	if g := b.glyphs['H']; g != nil {
+		m.CapHeight = -g.ink().Top * float64(scale)
+	}
+	return m
+}
+
+// Measure lays out s at a whole number scale, exactly as DrawString draws it.
+func (b *BitmapFont) Measure(s string, scale int) TextExtents {
+	p := resolveBidi(s, DirectionAuto)
+	return b.layoutLine(scale, p, 0, len(p.runes)).extents(0)
+}
+
+// DrawString draws s with its baseline starting at x, y, enlarged scale times.  The position is rounded to whole pixels.
+// Returns the advance of the string in pixels.
+func (b *BitmapFont) DrawString(dst draw.Image, s string, scale int, x, y float64, c color.Color) float64 {
+	p := resolveBidi(s, DirectionAuto)
+	return drawBitmapRun(dst, b.layoutLine(scale, p, 0, len(p.runes)), x, y, c)
+}
+
+// LayoutParagraph wraps and aligns text in the bitmap font, the same way as FontCache.LayoutParagraph.
+// The lines can be drawn with GlyphAtlas.DrawParagraph or Canvas2d.FillParagraph.
+func (b *BitmapFont) LayoutParagraph(text string, scale int, opts ParagraphOptions) []TextLine {
+	lineHeight := opts.LineHeight
+	if lineHeight <= 0 {
+		lineHeight = b.Metrics(scale).LineHeight
+	}
+	return layoutParagraph(text, opts, lineHeight, 0, func(p *bidiParagraph, start, end int) glyphRun {
+		return b.layoutLine(scale, p, start, end)
+	})
+}
+
+// layoutLine lays out runes [start, end) of a resolved paragraph in display order.  Bitmap fonts have no shaping or kerning,
+// so each rune is simply placed at the pen, with right to left runs mirrored.
+func (b *BitmapFont) layoutLine(scale int, p *bidiParagraph, start, end int) glyphRun {
+	scale = bitmapScale(scale)
+	var run glyphRun
+	order, levels := p.visualOrder(start, end)
+	pen := 0
+	for k, i := range order {
+		if p.isBidiControl(i) {
+			continue
+		}
+		r := p.runes[i]
+		if levels[k]&1 == 1 {
+			r = mirrorRune(r)
+		}
+		g := b.glyphAt(r, scale)
+		if g == nil {
+			continue
+		}
+		run.glyphs = append(run.glyphs, layoutGlyph{
+			r:       p.runes[i],
+			cluster: p.offsets[i],
+			x:       float64(pen),
+			advance: float64(g.Advance),
+			bitmap:  g,
+		})
+		pen += g.Advance
+	}
+	run.advance = float64(pen)
+	return run
+}
+
+// drawBitmapRun blits a run of bitmap glyphs, snapping the origin to whole pixels.
+func drawBitmapRun(dst draw.Image, run glyphRun, x, y float64, c color.Color) float64 {
+	src := image.NewUniform(c)
+	ix, iy := int(math.Round(x)), int(math.Round(y))
+	for _, g := range run.glyphs {
+		if g.bitmap != nil {
+			drawBitmapGlyph(dst, src, g.bitmap, ix+int(g.x), iy+int(g.y))
+		}
+	}
+	return run.advance
+}
+
+func drawBitmapGlyph(dst draw.Image, src image.Image, g *BitmapGlyph, x, y int) {
+	if g.Mask == nil {
+		return
+	}
+	r := g.Mask.Bounds()
+	draw.DrawMask(dst, r.Sub(r.Min).Add(g.Offset).Add(image.Pt(x, y)), src, image.ZP, g.Mask, r.Min, draw.Over)
+}
+
+// ink returns the bounds of the set pixels of the glyph relative to its origin.
+func (g *BitmapGlyph) ink() TextBounds {
+	var ink image.Rectangle
+	if g.Mask != nil {
+		r := g.Mask.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if g.Mask.AlphaAt(x, y).A != 0 {
+					ink = ink.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		ink = ink.Sub(r.Min).Add(g.Offset)
+	}
+	if ink.Empty() {
+		return TextBounds{}
+	}
+	return TextBounds{
+		Left:   float64(ink.Min.X),
+		Top:    float64(ink.Min.Y),
+		Right:  float64(ink.Max.X),
+		Bottom: float64(ink.Max.Y),
+	}
+}
+
+// appendPath adds a rectangle for each horizontal stretch of set pixels, with the glyph origin at x, y.
+// Used when bitmap text is drawn rotated or scaled by the canvas transform.
+func (g *BitmapGlyph) appendPath(path draw2d.PathBuilder, x, y float64) {
+	if g.Mask == nil {
+		return
+	}
+	r := g.Mask.Bounds()
+	for py := r.Min.Y; py < r.Max.Y; py++ {
+		for px := r.Min.X; px < r.Max.X; {
+			if g.Mask.AlphaAt(px, py).A == 0 {
+				px++
+				continue
+			}
+			e := px
+			for e < r.Max.X && g.Mask.AlphaAt(e, py).A != 0 {
+				e++
+			}
+			x0, y0 := x+float64(px-r.Min.X+g.Offset.X), y+float64(py-r.Min.Y+g.Offset.Y)
+			x1 := x0 + float64(e-px)
+			path.MoveTo(x0, y0)
+			path.LineTo(x1, y0)
+			path.LineTo(x1, y0+1)
+			path.LineTo(x0, y0+1)
+			path.Close()
+			px = e
+		}
+	}
+}
+
+func bitmapScale(scale int) int {
+	if scale < 1 {
+		return 1
+	}
+	return scale
+}
+
+// ParseBDF reads a font in the Glyph Bitmap Distribution Format (BDF 2.1), as used by X11 and most terminal pixel fonts.
+func ParseBDF(r io.Reader) (*BitmapFont, error) {
+	var (
+		b        *BitmapFont
+		bbox     [4]int // Font bounding box: width, height, x offset, y offset
+		defChar  = -1
+		enc      = -1
+		dwidth   int
+		gbox     [4]int
+		inBitmap bool
+		rows     [][]byte
+	)
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		bad := func() error {
+			return fmt.Errorf("canvas: bdf line %d: bad %s", line, fields[0])
+		}
+		if inBitmap && fields[0] != "ENDCHAR" {
+			row, err := hex.DecodeString(fields[0])
+			if err != nil {
+				return nil, bad()
+			}
+			rows = append(rows, row)
+			continue
+		}
+		switch fields[0] {
+		case "STARTFONT":
+			b = NewBitmapFont("", 0, 0)
+		case "FONT":
+			if b == nil {
+				return nil, errBadBDF
+			}
+			b.Name = strings.TrimSpace(strings.TrimPrefix(sc.Text(), "FONT"))
+		case "FONTBOUNDINGBOX":
+			if b == nil || !atois(fields[1:], bbox[:]) {
+				return nil, bad()
+			}
+			b.Ascent, b.Descent = bbox[1]+bbox[3], -bbox[3]
+		case "FONT_ASCENT", "FONT_DESCENT", "DEFAULT_CHAR":
+			if b == nil || len(fields) < 2 {
+				return nil, bad()
+			}
+			v, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, bad()
+			}
+			switch fields[0] {
+			case "FONT_ASCENT":
+				b.Ascent = v
+			case "FONT_DESCENT":
+				b.Descent = v
+			default:
+				defChar = v
+			}
+		case "STARTCHAR":
+			enc, dwidth, gbox, rows = -1, bbox[0], bbox, nil
+		case "ENCODING":
+			if len(fields) < 2 {
+				return nil, bad()
+			}
+			v, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, bad()
+			}
+			enc = v
+		case "DWIDTH":
+			var d [1]int
+			if !atois(fields[1:], d[:]) {
+				return nil, bad()
+			}
+			dwidth = d[0]
+		case "BBX":
+			if !atois(fields[1:], gbox[:]) {
+				return nil, bad()
+			}
+		case "BITMAP":
+			inBitmap = true
+		case "ENDCHAR":
+			inBitmap = false
+			if b == nil {
+				return nil, errBadBDF
+			}
+			if enc >= 0 { // -1 is an unencoded glyph, which can't be reached from text
+				b.glyphs[rune(enc)] = bdfGlyph(gbox, dwidth, rows)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, errBadBDF
+	}
+	if defChar >= 0 {
+		b.Default = rune(defChar)
+	}
+	return b, nil
+}
+
+var errBadBDF = errors.New("canvas: not a bdf font")
+
+// bdfGlyph builds a glyph from its BBX (width, height, x and y offset of the bottom left corner) and hex bitmap rows.
+func bdfGlyph(box [4]int, advance int, rows [][]byte) *BitmapGlyph {
+	w, h := box[0], box[1]
+	g := &BitmapGlyph{Advance: advance, Offset: image.Pt(box[2], -(box[3] + h))}
+	if w <= 0 || h <= 0 {
+		return g
+	}
+	g.Mask = image.NewAlpha(image.Rect(0, 0, w, h))
+	for y := 0; y < h && y < len(rows); y++ {
+		for x := 0; x < w && x/8 < len(rows[y]); x++ {
+			if rows[y][x/8]&(0x80>>uint(x%8)) != 0 {
+				g.Mask.Pix[y*g.Mask.Stride+x] = 0xff
+			}
+		}
+	}
+	return g
+}
+
+// atois parses as many ints into dst as there are fields, failing if there are too few or one is not a number.
+func atois(fields []string, dst []int) bool {
+	if len(fields) < len(dst) {
+		return false
+	}
+	for i := range dst {
+		v, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return false
+		}
+		dst[i] = v
+	}
+	return true
+}
+
+// NewGridFont makes a monospaced font from an image of equally sized cells, read left to right, top to bottom,
+// with one cell for each rune of chars.  baseline is the row within a cell the glyphs sit on.
+// Pixels more than half opaque are set.  For sheets with no transparency, pixels brighter than half are set instead.
+func NewGridFont(name string, sheet image.Image, cellWidth, cellHeight int, chars string, baseline int) (*BitmapFont, error) {
+	sr := sheet.Bounds()
+	if cellWidth <= 0 || cellHeight <= 0 || sr.Dx() < cellWidth || sr.Dy() < cellHeight {
+		return nil, errors.New("canvas: grid font cells don't fit the sheet")
+	}
+	b := NewBitmapFont(name, baseline, cellHeight-baseline)
+	b.Default = '?'
+	set := gridPixelTest(sheet)
+
+	cols := sr.Dx() / cellWidth
+	i := 0
+	for _, r := range chars {
+		cx, cy := sr.Min.X+(i%cols)*cellWidth, sr.Min.Y+(i/cols)*cellHeight
+		i++
+		if cy+cellHeight > sr.Max.Y {
+			return nil, fmt.Errorf("canvas: grid font sheet has no cell for %q", r)
+		}
+		g := &BitmapGlyph{Advance: cellWidth, Offset: image.Pt(0, -baseline)}
+		mask := image.NewAlpha(image.Rect(0, 0, cellWidth, cellHeight))
+		empty := true
+		for y := 0; y < cellHeight; y++ {
+			for x := 0; x < cellWidth; x++ {
+				if set(sheet.At(cx+x, cy+y)) {
+					mask.Pix[y*mask.Stride+x] = 0xff
+					empty = false
+				}
+			}
+		}
+		if !empty {
+			g.Mask = mask
+		}
+		b.glyphs[r] = g
+	}
+	return b, nil
+}
+
+// gridPixelTest picks how a sheet marks set pixels: by alpha if it has any transparency, otherwise by brightness.
+func gridPixelTest(sheet image.Image) func(color.Color) bool {
+	sr := sheet.Bounds()
+	for y := sr.Min.Y; y < sr.Max.Y; y++ {
+		for x := sr.Min.X; x < sr.Max.X; x++ {
+			if _, _, _, a := sheet.At(x, y).RGBA(); a < 0xffff {
+				return func(c color.Color) bool {
+					_, _, _, a := c.RGBA()
+					return a >= 0x8000
+				}
+			}
+		}
+	}
+	return func(c color.Color) bool {
+		return color.GrayModel.Convert(c).(color.Gray).Y >= 0x80
+	}
+}
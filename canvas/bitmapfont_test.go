@@ -0,0 +1,116 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// gridSheet draws a two cell sheet, 6x8 cells with the baseline on row 7: an x from row 3 and an H from row 1.
+func gridSheet() *image.NRGBA {
+	sheet := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	for y := 3; y < 7; y++ {
+		sheet.Set(1+(y-3), y, color.Black)
+		sheet.Set(4-(y-3), y, color.Black)
+	}
+	for y := 1; y < 7; y++ {
+		sheet.Set(7, y, color.Black)
+		sheet.Set(10, y, color.Black)
+	}
+	for x := 7; x <= 10; x++ {
+		sheet.Set(x, 4, color.Black)
+	}
+	return sheet
+}
+
+const bdfSample = `STARTFONT 2.1
+FONT -test-fixed-medium-r-normal--8-80-75-75-C-60-ISO10646-1
+SIZE 8 75 75
+FONTBOUNDINGBOX 6 8 0 -1
+STARTPROPERTIES 2
+FONT_ASCENT 7
+FONT_DESCENT 1
+ENDPROPERTIES
+CHARS 2
+STARTCHAR x
+ENCODING 120
+SWIDTH 600 0
+DWIDTH 6 0
+BBX 4 4 1 0
+BITMAP
+90
+60
+60
+90
+ENDCHAR
+STARTCHAR H
+ENCODING 72
+SWIDTH 600 0
+DWIDTH 6 0
+BBX 4 6 1 0
+BITMAP
+90
+90
+F0
+90
+90
+90
+ENDCHAR
+ENDFONT
+`
+
+func TestBitmapFontMetrics(t *testing.T) {
+	grid, err := NewGridFont("grid", gridSheet(), 6, 8, "xH", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bdf, err := ParseBDF(strings.NewReader(bdfSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		font *BitmapFont
+	}{{"grid", grid}, {"bdf", bdf}} {
+		for _, scale := range []int{1, 3} {
+			m := tt.font.Metrics(scale)
+			s := float64(scale)
+			if m.XHeight != 4*s || m.CapHeight != 6*s {
+				t.Errorf("%s at %dx: x-height %v, cap height %v, want %v, %v", tt.name, scale, m.XHeight, m.CapHeight, 4*s, 6*s)
+			}
+			if m.Ascent != 7*s || m.Descent != 1*s || m.LineHeight != 8*s {
+				t.Errorf("%s at %dx: ascent %v descent %v line height %v, want %v %v %v", tt.name, scale, m.Ascent, m.Descent, m.LineHeight, 7*s, s, 8*s)
+			}
+		}
+	}
+}
+
+func TestBitmapFontMeasure(t *testing.T) {
+	grid, err := NewGridFont("grid", gridSheet(), 6, 8, "xH", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := grid.Measure("Hx", 2)
+	if m.Advance != 24 {
+		t.Errorf("advance %v, want 24", m.Advance)
+	}
+	// Ink runs from the H's left stem to the x's right arm, from the top of the H to the baseline
+	if m.Ink != (TextBounds{Left: 2, Top: -12, Right: 22, Bottom: 0}) {
+		t.Errorf("ink %+v", m.Ink)
+	}
+}
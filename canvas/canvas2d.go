@@ -12,10 +12,16 @@
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
 
+//go:build js && wasm
+// +build js,wasm
+
 package canvas
 
 import (
+	"bytes"
 	"image"
+	"io"
+	"strings"
 	"syscall/js"
 
 	"github.com/golang/freetype/truetype"
@@ -42,9 +48,23 @@ type Canvas2d struct {
 
 	// Drawing Context
 	gctx     *draw2dimg.GraphicContext // Graphic Context
+	painter  *painter                  // Paints the graphic context's spans, including gradients
 	image    *image.RGBA               // The Shadow frame we actually draw on
 	font     *truetype.Font
 	fontData draw2d.FontData
+	fonts    *FontCache  // Font registry, including the fallback chain
+	atlas    *GlyphAtlas // Cached glyph masks for FillText
+	sdf      *SDFAtlas   // Distance fields for FillTextSDF
+	textDir  TextDirection
+
+	bitmapFont  *BitmapFont // Replaces the truetype font for text when set
+	bitmapScale int
+
+	post     *PostProcess // Effects run over the frame on its way to the browser
+	surfaces *SurfacePool // Offscreen surfaces for reuse
+	players  []Animator   // Advanced every frame, before the RenderFunc
+	recorder *Recorder    // Captures the frames shown, while recording
+	now      float64      // Timestamp of the frame being drawn, from requestAnimationFrame
 
 	reqID    js.Value // Storage of the current annimationFrame requestID - For Cancel
 	timeStep float64  // Min Time delay between frames. - Calculated as   maxFPS/1000
@@ -96,20 +116,23 @@ func (c *Canvas2d) Set(canvas js.Value, width int, height int) {
 	c.image = image.NewRGBA(image.Rect(0, 0, width, height))
 	c.copybuff = js.Global().Get("Uint8Array").New(len(c.image.Pix)) // Static JS buffer for copying data out to JS. Defined once and re-used to save on un-needed allocations
 
-	c.gctx = draw2dimg.NewGraphicContext(c.image)
+	c.gctx, c.painter = newGraphicContext(c.image)
 
 	// init font
-	c.font, _ = truetype.Parse(FontData["font.ttf"])
-
 	c.fontData = draw2d.FontData{
 		Name:   "roboto",
 		Family: draw2d.FontFamilySans,
 		Style:  draw2d.FontStyleNormal,
 	}
-	fontCache := &FontCache{}
-	fontCache.Store(c.fontData, c.font)
-
-	c.gctx.FontCache = fontCache
+	c.fonts = NewFontCache()
+	c.font, _ = c.fonts.StoreData(c.fontData, FontData["font.ttf"])
+
+	c.gctx.FontCache = c.fonts
+	c.atlas = NewGlyphAtlas(DefaultGlyphAtlasSize)
+	c.sdf = NewSDFAtlas(DefaultSDFSize, DefaultSDFSpread)
+	c.post = NewPostProcess()
+	c.surfaces = NewSurfacePool(c.fonts)
+	c.recorder = NewRecorder()
 }
 
 // Starts the annimationFrame callbacks running.   (Recently seperated from Create / Set to give better control for when things start / stop)
@@ -135,6 +158,462 @@ func (c *Canvas2d) Gc() *draw2dimg.GraphicContext {
 	return c.gctx
 }
 
+// Get the shadow frame image that is drawn on and copied to the browser, for post-processing it directly (see the filter package).
+func (c *Canvas2d) Image() *image.RGBA {
+	return c.image
+}
+
+// Save pushes the drawing state, that of the graphic context along with the global alpha, composite operation, shadow, clip and image quality.
+// Use it instead of Gc().Save() when changing those.
+func (c *Canvas2d) Save() {
+	c.gctx.Save()
+	c.painter.save()
+}
+
+// Restore pops the drawing state pushed by Save.
+func (c *Canvas2d) Restore() {
+	c.gctx.Restore()
+	c.painter.restore()
+}
+
+// Set the opacity, from 0 to 1, applied to everything drawn: paths, text and images.
+func (c *Canvas2d) SetGlobalAlpha(alpha float64) {
+	c.painter.alpha = clamp01(alpha)
+}
+
+func (c *Canvas2d) GlobalAlpha() float64 {
+	return c.painter.alpha
+}
+
+// Set how drawing is combined with the canvas, as canvas globalCompositeOperation.  Use ParseCompositeOp for the canvas names.
+// Anything other than OpSourceOver is drawn into a layer first and composited from there, so is slower.
+func (c *Canvas2d) SetCompositeOperation(op CompositeOp) {
+	c.painter.op = op
+}
+
+func (c *Canvas2d) CompositeOperation() CompositeOp {
+	return c.painter.op
+}
+
+// Set the shadow drawn beneath paths, text and images from now on.  Shadow{} turns it off.
+// Blurred shadows are drawn into a layer and blurred there, so cost time in proportion to the area drawn.
+func (c *Canvas2d) SetShadow(s Shadow) {
+	c.painter.shadow = s
+}
+
+func (c *Canvas2d) Shadow() Shadow {
+	return c.painter.shadow
+}
+
+// Clip narrows the clip to the inside of the current path and any paths given, through the current transform,
+// by rule: draw2d.FillRuleWinding for nonzero, draw2d.FillRuleEvenOdd for even-odd.  Clips add up until Restore or ResetClip.
+// Clip edges are anti-aliased, and anything clipped is drawn into a layer first, so is slower.
+func (c *Canvas2d) Clip(rule draw2d.FillRule, paths ...*draw2d.Path) {
+	paths = append(paths, c.gctx.Current.Path)
+	c.painter.clipPaths(paths, c.gctx.Current.Tr, rule)
+}
+
+// ClipImage narrows the clip by the alpha of mask, drawn with its top left corner at x, y through the current transform.
+// Drawing shows through in proportion to the mask's alpha, and not at all outside it, for soft edged reveals and fades.
+func (c *Canvas2d) ClipImage(mask image.Image, x, y float64) {
+	tr := c.gctx.GetMatrixTransform()
+	tr.Compose(draw2d.NewTranslationMatrix(x, y))
+	c.painter.clipImage(mask, tr)
+}
+
+// ResetClip lets drawing go anywhere again, until Restore brings back the clip of the saved state.
+func (c *Canvas2d) ResetClip() {
+	c.painter.clip = nil
+}
+
+// DrawImage draws img with its top left corner at x, y, through the current transform, global alpha and composite operation.
+// Drawn at a whole pixel with no more than a translation, it is a straight copy, the quickest way to put a sprite down.
+func (c *Canvas2d) DrawImage(img image.Image, x, y float64) {
+	c.painter.drawImage(img, img.Bounds(), draw2d.NewTranslationMatrix(x, y), 1)
+}
+
+// DrawImageRect draws the src part of img scaled into the rectangle at dx, dy sized dw by dh, like the 9 argument canvas drawImage.
+// An empty src means all of img.  The image quality says how it is resampled.
+func (c *Canvas2d) DrawImageRect(img image.Image, src image.Rectangle, dx, dy, dw, dh float64) {
+	if src.Empty() {
+		src = img.Bounds()
+	}
+	if src.Empty() {
+		return
+	}
+	tr := draw2d.NewTranslationMatrix(dx, dy)
+	tr.Compose(draw2d.NewScaleMatrix(dw/float64(src.Dx()), dh/float64(src.Dy())))
+	c.painter.drawImage(img, src, tr, 1)
+}
+
+// DrawImageTransformed draws the src part of img (all of it if src is empty), with its top left corner at the origin, placed by tr
+// on top of the current transform, so it can be turned, skewed or flipped.  opacity, 0 to 1, multiplies the global alpha.
+func (c *Canvas2d) DrawImageTransformed(img image.Image, src image.Rectangle, tr draw2d.Matrix, opacity float64) {
+	if src.Empty() {
+		src = img.Bounds()
+	}
+	c.painter.drawImage(img, src, tr, opacity)
+}
+
+// Set how images are resampled when drawn scaled or turned: QualityNearest for pixel art, QualityBilinear (the default) or QualityCatmullRom.
+// Saved and restored with Save / Restore.
+func (c *Canvas2d) SetImageQuality(q ImageQuality) {
+	c.painter.quality = q
+}
+
+func (c *Canvas2d) ImageQuality() ImageQuality {
+	return c.painter.quality
+}
+
+// NewSurface returns a transparent offscreen surface, sharing the canvas's fonts, to draw on once and draw onto the canvas
+// as often as needed with DrawSurface.  For short lived surfaces, SurfacePool saves making new ones.
+func (c *Canvas2d) NewSurface(width, height int) *Surface {
+	return NewSurface(width, height, c.fonts)
+}
+
+// Get the pool of surfaces, sharing the canvas's fonts, for surfaces made and dropped often
+func (c *Canvas2d) SurfacePool() *SurfacePool {
+	return c.surfaces
+}
+
+// DrawSurface draws s onto the canvas, placed by tr on top of the current transform, with opacity multiplying the global alpha.
+// Placed on a whole pixel with no scaling or turning, it is a straight copy.
+func (c *Canvas2d) DrawSurface(s *Surface, tr draw2d.Matrix, opacity float64) {
+	c.painter.drawImage(s.image, s.image.Rect, tr, opacity)
+}
+
+// DrawSprite draws the named frame of sheet with its pivot at x, y, through the current transform.  Unknown names draw nothing.
+// Frames that aren't stored rotated, drawn at a whole pixel with no more than a translation, are straight copies from the sheet.
+func (c *Canvas2d) DrawSprite(sheet *SpriteSheet, name string, x, y float64) {
+	if f := sheet.Frame(name); f != nil {
+		c.painter.drawSprite(sheet, f, draw2d.NewTranslationMatrix(x, y), 1)
+	}
+}
+
+// DrawSpriteFrame draws frame f of sheet with its pivot at the origin of tr, on top of the current transform,
+// so it can be scaled, turned or flipped.  opacity multiplies the global alpha.
+func (c *Canvas2d) DrawSpriteFrame(sheet *SpriteSheet, f *SpriteFrame, tr draw2d.Matrix, opacity float64) {
+	c.painter.drawSprite(sheet, f, tr, opacity)
+}
+
+// Animate has the frame loop advance p by the requestAnimationFrame timestamps each frame, before calling the RenderFunc.
+func (c *Canvas2d) Animate(p Animator) {
+	for _, q := range c.players {
+		if q == p {
+			return
+		}
+	}
+	c.players = append(c.players, p)
+}
+
+// StopAnimating stops the frame loop advancing p, leaving it on the frame it was showing.
+func (c *Canvas2d) StopAnimating(p Animator) {
+	for i, q := range c.players {
+		if q == p {
+			c.players = append(c.players[:i], c.players[i+1:]...)
+			return
+		}
+	}
+}
+
+// DrawAnimation draws the frame p is showing with its pivot at x, y, through the current transform.
+func (c *Canvas2d) DrawAnimation(p *AnimationPlayer, x, y float64) {
+	if f := p.Frame(); f != nil {
+		c.painter.drawSprite(p.Sheet(), f, draw2d.NewTranslationMatrix(x, y), 1)
+	}
+}
+
+// DrawAnimatedImage draws the frame of a GIF or APNG that p is showing, with its top left corner at x, y, through the current transform.
+// Check p.Changed() to see whether the canvas needs drawing again.
+func (c *Canvas2d) DrawAnimatedImage(p *AnimatedImagePlayer, x, y float64) {
+	if f := p.Frame(); f != nil {
+		c.painter.drawImage(f, f.Rect, draw2d.NewTranslationMatrix(x, y), 1)
+	}
+}
+
+// Get the Recorder, which captures each frame shown while it is recording, for saving as an animated GIF or APNG.
+// Frames are only captured when the RenderFunc returns true, and each shows until the next one is captured.
+func (c *Canvas2d) Recorder() *Recorder {
+	return c.recorder
+}
+
+// DownloadRecording has the browser save what the recorder has captured, as a GIF if filename ends in .gif, otherwise an APNG.
+// opts sets the GIF's colours.
+func (c *Canvas2d) DownloadRecording(filename string, opts GIFOptions) error {
+	var buf bytes.Buffer
+	mime := "image/apng"
+	if strings.HasSuffix(strings.ToLower(filename), ".gif") {
+		mime = "image/gif"
+		if err := c.recorder.EncodeGIF(&buf, opts); err != nil {
+			return err
+		}
+	} else if err := c.recorder.EncodeAPNG(&buf); err != nil {
+		return err
+	}
+	c.download(filename, mime, buf.Bytes())
+	return nil
+}
+
+// Screenshot writes the shadow frame, or the part of it opts asks for, as a PNG or JPEG.
+// Called from the RenderFunc it takes what has been drawn so far this frame.
+// To take an offscreen layer instead, use its Surface.Screenshot or Surface.ScreenshotDataURL.
+func (c *Canvas2d) Screenshot(w io.Writer, opts ScreenshotOptions) error {
+	return EncodeScreenshot(w, c.screenshotImage(opts), opts)
+}
+
+// ScreenshotDataURL returns the shadow frame, or the part of it opts asks for, as a data: URL.
+func (c *Canvas2d) ScreenshotDataURL(opts ScreenshotOptions) (string, error) {
+	return ScreenshotDataURL(c.screenshotImage(opts), opts)
+}
+
+// DownloadScreenshot has the browser save the shadow frame, or the part of it opts asks for, as a JPEG if filename ends
+// in .jpg or .jpeg, otherwise a PNG.  opts.Format is ignored.
+func (c *Canvas2d) DownloadScreenshot(filename string, opts ScreenshotOptions) error {
+	var buf bytes.Buffer
+	opts.Format = FormatForName(filename)
+	if err := c.Screenshot(&buf, opts); err != nil {
+		return err
+	}
+	c.download(filename, opts.Format.MIME(), buf.Bytes())
+	return nil
+}
+
+func (c *Canvas2d) screenshotImage(opts ScreenshotOptions) *image.RGBA {
+	if opts.PostProcessed {
+		return c.post.apply(c.image) // Not Run, which would hide a pass switched this frame from the render loop
+	}
+	return c.image
+}
+
+// download has the browser save data as a file, through a temporary link.
+func (c *Canvas2d) download(filename, mime string, data []byte) {
+	arr := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(arr, data)
+	blob := js.Global().Get("Blob").New([]interface{}{arr}, map[string]interface{}{"type": mime})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+
+	a := c.doc.Call("createElement", "a")
+	a.Set("href", url)
+	a.Set("download", filename)
+	c.body.Call("appendChild", a)
+	a.Call("click")
+	c.body.Call("removeChild", a)
+
+	// Revoking the URL straight away can cancel the download in some browsers, so leave it a moment
+	var revoke js.Func
+	revoke = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		js.Global().Get("URL").Call("revokeObjectURL", url)
+		revoke.Release()
+		return nil
+	})
+	js.Global().Call("setTimeout", revoke, 1000)
+}
+
+// Get the post-processing chain, whose passes (vignette, CRT, bloom, colour grading, or any filter.Filter) are run over each frame
+// after the RenderFunc, on a copy, so the frame drawn is kept as it was for the next render.
+func (c *Canvas2d) PostProcess() *PostProcess {
+	return c.post
+}
+
+// Get the Glyph Atlas used by FillText, to tune its capacity or check hit rates
+func (c *Canvas2d) GlyphAtlas() *GlyphAtlas {
+	return c.atlas
+}
+
+// Get the Font Cache used for text.  Store extra fonts here, and set the fallback chain for runes missing from the current font.
+func (c *Canvas2d) FontCache() *FontCache {
+	return c.fonts
+}
+
+// Set the base direction used by FillText and MeasureText.  DirectionAuto (the default) takes it from the first strong character of the text.
+// Either way, runs of right to left text such as Arabic or Hebrew are reordered for display.
+func (c *Canvas2d) SetTextDirection(dir TextDirection) {
+	c.textDir = dir
+}
+
+func (c *Canvas2d) TextDirection() TextDirection {
+	return c.textDir
+}
+
+// FillText draws the text at x, y using the current font, font size and fill colour of the graphic context.
+// Glyphs are rasterized once into the glyph atlas and blitted on later calls, which is much faster than FillStringAt for text redrawn every frame.
+// Runes missing from the current font are drawn from the FontCache fallback chain.
+// If the current transform is more than a translation, or the fill colour is a Paint such as a gradient, the glyph outlines are filled
+// through the graphic context instead, so rotated / scaled / gradient text still works.
+func (c *Canvas2d) FillText(text string, x, y float64) float64 {
+	run, size, err := c.textRun(text)
+	if err != nil {
+		return 0
+	}
+	return c.fillRun(run, size, x, y)
+}
+
+// SetBitmapFont makes FillText, MeasureText, FontMetrics, TextPath and the paragraph functions use a pixel font, enlarged scale times, instead of the truetype font.
+// Bitmap text is drawn without anti-aliasing, on whole pixels.  Pass nil to go back to the truetype font.
+func (c *Canvas2d) SetBitmapFont(b *BitmapFont, scale int) {
+	c.bitmapFont, c.bitmapScale = b, bitmapScale(scale)
+}
+
+// Get the current bitmap font and its scale, or nil if text uses the truetype font
+func (c *Canvas2d) BitmapFont() (*BitmapFont, int) {
+	return c.bitmapFont, c.bitmapScale
+}
+
+// textRun lays text out in the current font, returning the run and the size to draw it at.
+func (c *Canvas2d) textRun(text string) (glyphRun, float64, error) {
+	if c.bitmapFont != nil {
+		p := resolveBidi(text, c.textDir)
+		return c.bitmapFont.layoutLine(c.bitmapScale, p, 0, len(p.runes)), 0, nil
+	}
+	f, err := c.gctx.FontCache.Load(c.gctx.GetFontData())
+	if err != nil {
+		return glyphRun{}, 0, err
+	}
+	size := c.textSize()
+	return layoutText(c.fonts, f, size, text, c.textDir), size, nil
+}
+
+// FillTextSDF draws text from signed distance fields, which stay sharp at any scale and rotation of the current transform.
+// Better than FillText for zoomable views, where the glyph atlas would cache every glyph at every zoom level.
+// style.Color defaults to the current fill colour.
+// Bitmap font glyphs have no outlines to make fields from, so while SetBitmapFont is in effect this draws with FillText, without the style.
+func (c *Canvas2d) FillTextSDF(text string, x, y float64, style SDFStyle) float64 {
+	if c.bitmapFont != nil {
+		return c.FillText(text, x, y)
+	}
+	f, err := c.gctx.FontCache.Load(c.gctx.GetFontData())
+	if err != nil {
+		return 0
+	}
+	if style.Color == nil {
+		style.Color = c.gctx.Current.FillColor
+	}
+	tr := c.gctx.GetMatrixTransform()
+	tr.Compose(draw2d.NewTranslationMatrix(x, y))
+	dst := c.painter.begin()
+	defer c.painter.end()
+	return c.sdf.DrawText(dst, c.fonts, f, c.textSize(), text, tr, style)
+}
+
+// Get the SDF Atlas used by FillTextSDF
+func (c *Canvas2d) SDFAtlas() *SDFAtlas {
+	return c.sdf
+}
+
+// FillParagraph wraps text to opts.Width and draws it with the baseline of the first line at x, y, the same way as FillText.
+// Returns the laid out lines, for hit testing or drawing decorations.
+func (c *Canvas2d) FillParagraph(text string, x, y float64, opts ParagraphOptions) []TextLine {
+	lines := c.LayoutParagraph(text, opts)
+	for _, l := range lines {
+		c.fillRun(l.run, l.size, x+l.X, y+l.Y)
+	}
+	return lines
+}
+
+// LayoutParagraph wraps and aligns text with the current font and font size, without drawing it.
+func (c *Canvas2d) LayoutParagraph(text string, opts ParagraphOptions) []TextLine {
+	if c.bitmapFont != nil {
+		return c.bitmapFont.LayoutParagraph(text, c.bitmapScale, opts)
+	}
+	f, err := c.gctx.FontCache.Load(c.gctx.GetFontData())
+	if err != nil {
+		return nil
+	}
+	return c.fonts.LayoutParagraph(f, c.textSize(), text, opts)
+}
+
+// TextPath returns the outlines of text in the current font and font size as a path, with the baseline starting at x, y.
+// Fill it with a gradient, stroke it, or clip to it.  The current transform is applied when the path is drawn, not here.
+func (c *Canvas2d) TextPath(text string, x, y float64) (*draw2d.Path, error) {
+	run, size, err := c.textRun(text)
+	if err != nil {
+		return nil, err
+	}
+	path := new(draw2d.Path)
+	return path, run.appendPath(path, size, x, y)
+}
+
+// StrokeText outlines text with the current stroke colour and line width.
+func (c *Canvas2d) StrokeText(text string, x, y float64) error {
+	path, err := c.TextPath(text, x, y)
+	if err != nil {
+		return err
+	}
+	c.gctx.Save()
+	c.gctx.BeginPath()
+	c.gctx.Stroke(path)
+	c.gctx.Restore()
+	return nil
+}
+
+// FillTextOnPath draws text along path, in the current font, font size and fill colour, with each glyph turned to follow the path.
+// The glyphs are filled through the graphic context, so the current transform applies to both the path and the text.
+func (c *Canvas2d) FillTextOnPath(text string, path *draw2d.Path, opts PathTextOptions) error {
+	f, err := c.gctx.FontCache.Load(c.gctx.GetFontData())
+	if err != nil {
+		return err
+	}
+	glyphs, err := c.fonts.TextOnPath(f, c.textSize(), text, path, opts)
+	if err != nil {
+		return err
+	}
+	c.gctx.Save()
+	c.gctx.BeginPath()
+	c.gctx.Fill(glyphs)
+	c.gctx.Restore()
+	return nil
+}
+
+// fillRun draws a laid out run in the fill colour, through the atlas unless the transform needs the outlines.
+func (c *Canvas2d) fillRun(run glyphRun, size, x, y float64) float64 {
+	tr := c.gctx.GetMatrixTransform()
+	dst := c.painter.begin() // The whole run is composited at once
+	defer c.painter.end()
+	if _, paint := c.gctx.Current.FillColor.(Paint); paint || !tr.IsTranslation() {
+		plain, colored := run.splitColor(size)
+		path := new(draw2d.Path)
+		if err := plain.appendPath(path, size, x, y); err != nil {
+			return 0
+		}
+		c.gctx.Save() // Keep any path the caller is building
+		c.gctx.BeginPath()
+		c.gctx.Fill(path)
+		c.gctx.Restore()
+		if err := fillColorGlyphs(c.gctx, dst, colored, size, x, y); err != nil {
+			return 0
+		}
+		return run.advance
+	}
+	x, y = tr.TransformPoint(x, y)
+	return c.atlas.drawRun(dst, run, size, x, y, c.gctx.Current.FillColor)
+}
+
+// MeasureText measures text with the current font and font size, laid out exactly as FillText would draw it.
+func (c *Canvas2d) MeasureText(text string) TextExtents {
+	run, size, err := c.textRun(text)
+	if err != nil {
+		return TextExtents{}
+	}
+	return run.extents(size)
+}
+
+// FontMetrics returns the ascent, descent, line gap etc. of the current font at the current font size, in pixels.
+func (c *Canvas2d) FontMetrics() FontMetrics {
+	if c.bitmapFont != nil {
+		return c.bitmapFont.Metrics(c.bitmapScale)
+	}
+	f, err := c.gctx.FontCache.Load(c.gctx.GetFontData())
+	if err != nil {
+		return FontMetrics{}
+	}
+	return c.fonts.Metrics(f, c.textSize())
+}
+
+// Current font size in pixels per em.  Points to pixels, same as draw2d
+func (c *Canvas2d) textSize() float64 {
+	return c.gctx.GetFontSize() * float64(c.gctx.GetDPI()) / 72
+}
+
 func (c *Canvas2d) Height() int {
 	return c.height
 }
@@ -154,9 +633,13 @@ func (c *Canvas2d) initFrameUpdate(rf RenderFunc) {
 
 			timestamp := args[0].Float()
 			if timestamp-lastTimestamp >= c.timeStep { // Constrain FPS
+				c.now = timestamp
+				for _, p := range c.players {
+					p.Tick(timestamp)
+				}
 				if rf != nil { // If required, call the requested render function, before copying the frame
-					if rf(c.gctx) { // Only copy the image back if RenderFunction returns TRUE. (i.e. stuff has changed.)  This allows Render to return false, saving time this cycle if nothing changed.  (Keep frame as before)
-						c.imgCopy()
+					if rf(c.gctx) || c.post.Changed() { // Only copy the image back if RenderFunction returns TRUE. (i.e. stuff has changed.)  This allows Render to return false, saving time this cycle if nothing changed.  (Keep frame as before)
+						c.imgCopy() // Switching post-processing passes needs the frame showing again too
 					}
 				} else { // Just do the copy, rendering must be being done elsewhere
 					c.imgCopy()
@@ -178,7 +661,9 @@ func (c *Canvas2d) imgCopy() {
 	// TODO:  This currently does multiple data copies.   go image buffer -> JS Uint8Array,   Then JS Uint8Array -> ImageData,  then ImageData into the Canvas.
 	// Would like to eliminate at least one of them, however currently CopyBytesToJS only supports Uint8Array  rather than the Uint8ClampedArray of ImageData.
 
-	js.CopyBytesToJS(c.copybuff, c.image.Pix)
+	frame := c.post.Run(c.image) // The frame after any post-processing passes, leaving c.image as drawn
+	c.recorder.Capture(frame, c.now)
+	js.CopyBytesToJS(c.copybuff, frame.Pix)
 	c.imgData.Get("data").Call("set", c.copybuff)
 	c.ctx.Call("putImageData", c.imgData, 0, 0)
 }
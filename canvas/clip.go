@@ -0,0 +1,89 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/golang/freetype/raster"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dbase"
+	"github.com/llgcode/draw2d/draw2dimg"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// clipMask is the coverage drawing is allowed on: anti-aliased clip paths and alpha masks, multiplied together.
+type clipMask struct {
+	mask   *image.Alpha
+	bounds image.Rectangle // Where mask isn't 0
+}
+
+// clipBounds returns the part of the image that can be drawn on.
+func (p *painter) clipBounds() image.Rectangle {
+	if p.clip == nil {
+		return p.img.Rect
+	}
+	return p.clip.bounds
+}
+
+// clipPaths narrows the clip to the inside of paths, drawn through tr, by the fill rule.
+func (p *painter) clipPaths(paths []*draw2d.Path, tr draw2d.Matrix, rule draw2d.FillRule) {
+	r := p.img.Rect
+	ras := raster.NewRasterizer(r.Dx(), r.Dy())
+	ras.UseNonZeroWinding = rule == draw2d.FillRuleWinding
+	flattener := draw2dbase.Transformer{Tr: tr, Flattener: draw2dimg.FtLineBuilder{Adder: ras}}
+	for _, path := range paths {
+		draw2dbase.Flatten(path, flattener, tr.GetScale())
+	}
+	mask := image.NewAlpha(r)
+	ras.Rasterize(raster.NewAlphaSrcPainter(mask))
+	p.narrowClip(mask)
+}
+
+// clipImage narrows the clip by the alpha of m, drawn through tr.  Outside m nothing can be drawn.
+func (p *painter) clipImage(m image.Image, tr draw2d.Matrix) {
+	mask := image.NewAlpha(p.img.Rect)
+	xdraw.BiLinear.Transform(mask, f64.Aff3{tr[0], tr[2], tr[4], tr[1], tr[3], tr[5]}, m, m.Bounds(), draw.Src, nil)
+	p.narrowClip(mask)
+}
+
+// narrowClip multiplies the clip by mask, which becomes the new clip.  The old one is left alone for saved states.
+func (p *painter) narrowClip(mask *image.Alpha) {
+	if p.clip != nil {
+		for i, a := range p.clip.mask.Pix {
+			mask.Pix[i] = uint8((uint32(mask.Pix[i])*uint32(a) + 127) / 255)
+		}
+	}
+	bounds := image.Rectangle{}
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := mask.Pix[mask.PixOffset(r.Min.X, y):mask.PixOffset(r.Max.X, y)]
+		x0, x1 := -1, -1
+		for i, a := range row {
+			if a != 0 {
+				if x0 < 0 {
+					x0 = i
+				}
+				x1 = i
+			}
+		}
+		if x0 >= 0 {
+			bounds = bounds.Union(image.Rect(r.Min.X+x0, y, r.Min.X+x1+1, y+1))
+		}
+	}
+	p.clip = &clipMask{mask, bounds}
+}
@@ -0,0 +1,521 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"container/list"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Colour glyph support, for emoji fonts.  Three formats are read:
+//   - CBDT/CBLC: PNG bitmaps at one or more sizes (Google's Noto Color Emoji)
+//   - sbix: PNG bitmaps at one or more sizes (Apple Color Emoji)
+//   - COLR version 0 with CPAL: a stack of ordinary outline glyphs, each filled with a palette colour (Windows Segoe UI Emoji, Twemoji)
+//
+// COLR version 1 gradients and SVG glyphs are not supported, those glyphs fall back to their monochrome outline if the font has one.
+type colorFont struct {
+	cblc, cbdt []byte
+	sbix       []byte
+	numGlyphs  int
+
+	colr    []byte
+	palette []color.NRGBA // First CPAL palette, which is not premultiplied
+
+	// Decoded bitmaps, least recently used dropped past maxBytes.  A nil bitmap means the strike doesn't have the glyph.
+	bitmaps  map[colorBitmapKey]*list.Element
+	lru      *list.List // Front is most recently used
+	bytes    int
+	maxBytes int // 0 means colorBitmapBytes
+}
+
+// Limit on the memory the decoded bitmaps of one font take.  A 136px emoji decodes to about 72KB, so this holds a couple of hundred.
+const colorBitmapBytes = 16 << 20
+
+// colorBitmapKey is a glyph in one strike.  Bitmaps are decoded once per strike, and scaled to the text size when drawn.
+type colorBitmapKey struct {
+	index  truetype.Index
+	strike int // Offset of the strike's record in CBLC, or minus one less than the offset of the strike in sbix
+}
+
+type colorBitmapEntry struct {
+	key    colorBitmapKey
+	bitmap *colorBitmap
+}
+
+// size is the memory the decoded bitmap takes, plus a little for the entry itself so missing glyphs count too.
+func (e *colorBitmapEntry) size() int {
+	if e.bitmap == nil {
+		return 64
+	}
+	r := e.bitmap.img.Bounds()
+	return 4*r.Dx()*r.Dy() + 64
+}
+
+// colorLayer is one layer of a COLR glyph.  Foreground layers use the text colour.
+type colorLayer struct {
+	index      truetype.Index
+	color      color.NRGBA
+	foreground bool
+}
+
+// colorBitmap is a decoded bitmap glyph.  Bearings are in pixels of the strike, Y going upwards from the baseline.
+type colorBitmap struct {
+	img                image.Image
+	ppem               int
+	bearingX, bearingY int
+}
+
+// colors returns the colour tables of the font, or nil if it has none.
+func (s *sfntFont) colors() *colorFont {
+	if s == nil {
+		return nil
+	}
+	if s.color == nil {
+		c := &colorFont{
+			cblc: s.table("CBLC"),
+			cbdt: s.table("CBDT"),
+			sbix: s.table("sbix"),
+		}
+		if maxp := s.table("maxp"); len(maxp) >= 6 {
+			c.numGlyphs = int(u16(maxp, 4))
+		}
+		if colr := s.table("COLR"); len(colr) >= 14 && u16(colr, 0) == 0 {
+			c.colr = colr
+			c.palette = parseCPAL(s.table("CPAL"))
+		}
+		s.color = c
+	}
+	if s.color.cbdt == nil && s.color.sbix == nil && s.color.colr == nil {
+		return nil
+	}
+	return s.color
+}
+
+// parseCPAL reads the first palette.  Colour records are stored as BGRA, not premultiplied.
+func parseCPAL(t []byte) []color.NRGBA {
+	if len(t) < 14 {
+		return nil
+	}
+	n := int(u16(t, 2))
+	records := int(u32(t, 8)) + 4*int(u16(t, 12))
+	var pal []color.NRGBA
+	for i := 0; i < n; i++ {
+		o := records + 4*i
+		if o+4 > len(t) {
+			break
+		}
+		pal = append(pal, color.NRGBA{R: t[o+2], G: t[o+1], B: t[o], A: t[o+3]})
+	}
+	return pal
+}
+
+// layers returns the COLR layers of a glyph, bottom first, or nil if it isn't a colour glyph.
+func (c *colorFont) layers(index truetype.Index) []colorLayer {
+	if c == nil || c.colr == nil {
+		return nil
+	}
+	t := c.colr
+	numBase, baseOff := int(u16(t, 2)), int(u32(t, 4))
+	layerOff, numLayers := int(u32(t, 8)), int(u16(t, 12))
+	if baseOff+6*numBase > len(t) || layerOff+4*numLayers > len(t) {
+		return nil
+	}
+	i := sort.Search(numBase, func(i int) bool { return u16(t, baseOff+6*i) >= uint16(index) })
+	if i == numBase || u16(t, baseOff+6*i) != uint16(index) {
+		return nil
+	}
+	first, n := int(u16(t, baseOff+6*i+2)), int(u16(t, baseOff+6*i+4))
+	if first+n > numLayers {
+		return nil
+	}
+	out := make([]colorLayer, n)
+	for j := range out {
+		o := layerOff + 4*(first+j)
+		out[j].index = truetype.Index(u16(t, o))
+		if p := int(u16(t, o+2)); p < len(c.palette) {
+			out[j].color = c.palette[p]
+		} else {
+			out[j].foreground = true // 0xffff, or a bad index
+		}
+	}
+	return out
+}
+
+// hasBitmaps reports whether the font has CBDT or sbix bitmaps.
+func (c *colorFont) hasBitmaps() bool {
+	return c != nil && (c.cbdt != nil || c.sbix != nil)
+}
+
+// bitmap returns the bitmap for a glyph from the strike best suited to size pixels per em:
+// the smallest one at least that big, so it's scaled down, or the biggest there is.
+// It is at the strike's size, to be scaled by size / ppem when drawn.
+func (c *colorFont) bitmap(index truetype.Index, size float64) *colorBitmap {
+	if !c.hasBitmaps() {
+		return nil
+	}
+	var b *colorBitmap
+	if c.cbdt != nil && len(c.cblc) >= 8 {
+		b = c.cbdtBitmap(index, size)
+	}
+	if b == nil && c.sbix != nil && len(c.sbix) >= 8 {
+		b = c.sbixBitmap(index, size)
+	}
+	if b == nil || b.ppem <= 0 {
+		return nil // A strike without a size can't be scaled
+	}
+	return b
+}
+
+// cached returns the bitmap for a glyph in a strike, calling decode for it the first time, or when it has been evicted since.
+// The bitmap just looked up is never evicted, even if it alone is over the limit.
+func (c *colorFont) cached(index truetype.Index, strike int, decode func() *colorBitmap) *colorBitmap {
+	key := colorBitmapKey{index, strike}
+	if e, ok := c.bitmaps[key]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*colorBitmapEntry).bitmap
+	}
+	if c.bitmaps == nil {
+		c.bitmaps, c.lru = make(map[colorBitmapKey]*list.Element), list.New()
+	}
+	e := &colorBitmapEntry{key, decode()}
+	c.bitmaps[key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	c.evict()
+	return e.bitmap
+}
+
+func (c *colorFont) evict() {
+	limit := c.maxBytes
+	if limit <= 0 {
+		limit = colorBitmapBytes
+	}
+	for c.bytes > limit && c.lru.Len() > 1 {
+		e := c.lru.Back().Value.(*colorBitmapEntry)
+		delete(c.bitmaps, e.key)
+		c.lru.Remove(c.lru.Back())
+		c.bytes -= e.size()
+	}
+}
+
+// pickStrike returns the index of the best strike for size, given each strike's pixels per em.
+func pickStrike(ppems []int, size float64) int {
+	best := -1
+	for i, p := range ppems {
+		switch {
+		case best < 0:
+			best = i
+		case float64(ppems[best]) < size:
+			if p > ppems[best] {
+				best = i
+			}
+		case float64(p) >= size && p < ppems[best]:
+			best = i
+		}
+	}
+	return best
+}
+
+func (c *colorFont) cbdtBitmap(index truetype.Index, size float64) *colorBitmap {
+	t := c.cblc
+	numSizes := int(u32(t, 4))
+	if 8+48*numSizes > len(t) {
+		return nil
+	}
+	// Strikes that have the glyph at all
+	var ppems, strikes []int
+	for i := 0; i < numSizes; i++ {
+		o := 8 + 48*i
+		if g := int(index); g >= int(u16(t, o+40)) && g <= int(u16(t, o+42)) {
+			ppems = append(ppems, int(t[o+44]))
+			strikes = append(strikes, o)
+		}
+	}
+	s := pickStrike(ppems, size)
+	if s < 0 {
+		return nil
+	}
+	o := strikes[s]
+	return c.cached(index, o, func() *colorBitmap {
+		return c.cbdtStrike(index, o)
+	})
+}
+
+// cbdtStrike decodes a glyph from the strike whose BitmapSize record is at o in CBLC.
+func (c *colorFont) cbdtStrike(index truetype.Index, o int) *colorBitmap {
+	t := c.cblc
+	arrayOff, numSubtables := int(u32(t, o)), int(u32(t, o+8))
+
+	for i := 0; i < numSubtables; i++ {
+		rec := arrayOff + 8*i
+		if rec+8 > len(t) {
+			return nil
+		}
+		first, last := int(u16(t, rec)), int(u16(t, rec+2))
+		if int(index) < first || int(index) > last {
+			continue
+		}
+		sub := arrayOff + int(u32(t, rec+4))
+		if sub+8 > len(t) {
+			return nil
+		}
+		indexFormat, imageFormat, dataOff := u16(t, sub), u16(t, sub+2), int(u32(t, sub+4))
+		g := int(index) - first
+
+		var start, end int
+		var metrics []byte // Big metrics from the index, for image format 19
+		switch indexFormat {
+		case 1:
+			p := sub + 8 + 4*g
+			if p+8 > len(t) {
+				return nil
+			}
+			start, end = int(u32(t, p)), int(u32(t, p+4))
+		case 2:
+			if sub+20 > len(t) {
+				return nil
+			}
+			n := int(u32(t, sub+8))
+			start, end = g*n, (g+1)*n
+			metrics = t[sub+12 : sub+20]
+		case 3:
+			p := sub + 8 + 2*g
+			if p+4 > len(t) {
+				return nil
+			}
+			start, end = int(u16(t, p)), int(u16(t, p+2))
+		case 4, 5:
+			return c.cbdtSparse(index, sub, indexFormat, int(imageFormat), dataOff, int(t[o+44]))
+		default:
+			return nil
+		}
+		return c.cbdtImage(int(imageFormat), dataOff+start, dataOff+end, metrics, int(t[o+44]))
+	}
+	return nil
+}
+
+// cbdtSparse finds a glyph in index formats 4 and 5, which list glyph ids rather than covering a range.
+func (c *colorFont) cbdtSparse(index truetype.Index, sub int, indexFormat uint16, imageFormat, dataOff, ppem int) *colorBitmap {
+	t := c.cblc
+	if indexFormat == 4 {
+		n := int(su16(t, sub+10)) // Low half of numGlyphs, which never needs more
+		for k := 0; k < n; k++ {
+			p := sub + 12 + 4*k
+			if p+8 > len(t) {
+				return nil
+			}
+			if u16(t, p) == uint16(index) {
+				return c.cbdtImage(imageFormat, dataOff+int(u16(t, p+2)), dataOff+int(u16(t, p+6)), nil, ppem)
+			}
+		}
+		return nil
+	}
+	if sub+24 > len(t) {
+		return nil
+	}
+	size := int(u32(t, sub+8))
+	metrics := t[sub+12 : sub+20]
+	n := int(u32(t, sub+20))
+	for k := 0; k < n; k++ {
+		if su16(t, sub+24+2*k) == uint16(index) {
+			return c.cbdtImage(imageFormat, dataOff+k*size, dataOff+(k+1)*size, metrics, ppem)
+		}
+	}
+	return nil
+}
+
+// cbdtImage decodes a PNG glyph image, formats 17 (small metrics), 18 (big metrics) and 19 (metrics in the index).
+func (c *colorFont) cbdtImage(format, start, end int, metrics []byte, ppem int) *colorBitmap {
+	t := c.cbdt
+	if start < 0 || end > len(t) || start >= end {
+		return nil
+	}
+	d := t[start:end]
+	var data []byte
+	b := &colorBitmap{ppem: ppem}
+	switch format {
+	case 17:
+		if len(d) < 9 {
+			return nil
+		}
+		b.bearingX, b.bearingY = int(int8(d[2])), int(int8(d[3]))
+		data = d[9:]
+	case 18:
+		if len(d) < 12 {
+			return nil
+		}
+		b.bearingX, b.bearingY = int(int8(d[2])), int(int8(d[3]))
+		data = d[12:]
+	case 19:
+		if len(d) < 4 || len(metrics) < 4 {
+			return nil
+		}
+		b.bearingX, b.bearingY = int(int8(metrics[2])), int(int8(metrics[3]))
+		data = d[4:]
+	default:
+		return nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	b.img = img
+	return b
+}
+
+func (c *colorFont) sbixBitmap(index truetype.Index, size float64) *colorBitmap {
+	t := c.sbix
+	numStrikes := int(u32(t, 4))
+	if 8+4*numStrikes > len(t) || int(index) >= c.numGlyphs {
+		return nil
+	}
+	ppems := make([]int, numStrikes)
+	order := make([]int, numStrikes)
+	for i := range ppems {
+		ppems[i] = int(su16(t, int(u32(t, 8+4*i))))
+		order[i] = i
+	}
+	// Strikes can leave glyphs out, so after the best match try the rest, biggest first
+	best := pickStrike(ppems, size)
+	sort.Slice(order, func(a, b int) bool {
+		if order[a] == best || order[b] == best {
+			return order[a] == best
+		}
+		return ppems[order[a]] > ppems[order[b]]
+	})
+	for _, s := range order {
+		strike := int(u32(t, 8+4*s))
+		b := c.cached(index, -1-strike, func() *colorBitmap {
+			b := c.sbixGlyph(strike, int(index), 0)
+			if b != nil {
+				b.ppem = ppems[s]
+			}
+			return b
+		})
+		if b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// sbixGlyph decodes a glyph from the strike at offset strike, following 'dupe' references.
+func (c *colorFont) sbixGlyph(strike, index, depth int) *colorBitmap {
+	t := c.sbix
+	p := strike + 4 + 4*index
+	if p+8 > len(t) || depth > 4 {
+		return nil
+	}
+	start, end := strike+int(u32(t, p)), strike+int(u32(t, p+4))
+	if end-start < 8 || end > len(t) {
+		return nil
+	}
+	d := t[start:end]
+	switch string(d[4:8]) {
+	case "png ":
+		img, err := png.Decode(bytes.NewReader(d[8:]))
+		if err != nil {
+			return nil
+		}
+		// The origin offset places the bottom left of the image
+		h := img.Bounds().Dy()
+		return &colorBitmap{img: img, bearingX: int(int16(u16(d, 0))), bearingY: int(int16(u16(d, 2))) + h}
+	case "dupe":
+		if len(d) < 10 {
+			return nil
+		}
+		return c.sbixGlyph(strike, int(u16(d, 8)), depth+1)
+	}
+	return nil
+}
+
+// ink returns the bounds of the bitmap drawn at size pixels per em, relative to the glyph origin with Y going down.
+func (b *colorBitmap) ink(size float64) TextBounds {
+	s := size / float64(b.ppem)
+	r := b.img.Bounds()
+	return TextBounds{
+		Left:   float64(b.bearingX) * s,
+		Top:    -float64(b.bearingY) * s,
+		Right:  float64(b.bearingX+r.Dx()) * s,
+		Bottom: float64(r.Dy()-b.bearingY) * s,
+	}
+}
+
+// isColor reports whether a laid out glyph is drawn from colour layers or a bitmap.
+func (g *layoutGlyph) isColor(size float64) bool {
+	return g.color != nil && (g.color.layers(g.index) != nil || g.color.bitmap(g.index, size) != nil)
+}
+
+// splitColor separates the colour glyphs of a run from the ones drawn as plain outlines.
+func (run glyphRun) splitColor(size float64) (plain, colored glyphRun) {
+	plain.advance, colored.advance = run.advance, run.advance
+	for _, g := range run.glyphs {
+		if g.isColor(size) {
+			colored.glyphs = append(colored.glyphs, g)
+		} else {
+			plain.glyphs = append(plain.glyphs, g)
+		}
+	}
+	return plain, colored
+}
+
+// fillColorGlyphs draws colour glyphs through gc, so they follow its transform, with the run's baseline starting at x, y.
+// COLR layers are filled as paths, bitmaps are resampled into dst, which must be the image gc draws on.
+func fillColorGlyphs(gc *draw2dimg.GraphicContext, dst draw.Image, run glyphRun, size, x, y float64) error {
+	fg := gc.Current.FillColor
+	gc.Save()
+	defer gc.Restore()
+	for _, g := range run.glyphs {
+		if layers := g.color.layers(g.index); layers != nil {
+			for _, l := range layers {
+				path := new(draw2d.Path)
+				if err := GlyphPath(path, g.font, size, l.index, x+g.x, y+g.y); err != nil {
+					return err
+				}
+				if l.foreground {
+					gc.SetFillColor(fg)
+				} else {
+					gc.SetFillColor(l.color)
+				}
+				gc.BeginPath()
+				gc.Fill(path)
+			}
+			continue
+		}
+		b := g.color.bitmap(g.index, size)
+		if b == nil {
+			continue
+		}
+		ink := b.ink(size)
+		s := size / float64(b.ppem)
+		tr := gc.GetMatrixTransform()
+		tr.Compose(draw2d.NewTranslationMatrix(x+g.x+ink.Left, y+g.y+ink.Top))
+		tr.Compose(draw2d.NewScaleMatrix(s, s))
+		sr := b.img.Bounds()
+		tr.Compose(draw2d.NewTranslationMatrix(-float64(sr.Min.X), -float64(sr.Min.Y)))
+		xdraw.BiLinear.Transform(dst, f64.Aff3{tr[0], tr[2], tr[4], tr[1], tr[3], tr[5]}, b.img, sr, draw.Over, nil)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/llgcode/draw2d"
+)
+
+func TestParseCPAL(t *testing.T) {
+	// One palette of two entries: half transparent red, and opaque blue, as BGRA
+	cpal := []byte{0, 0, 0, 2, 0, 1, 0, 2, 0, 0, 0, 14, 0, 0, 0, 0, 255, 128, 255, 0, 0, 255}
+	pal := parseCPAL(cpal)
+	want := []color.NRGBA{{R: 255, A: 128}, {B: 255, A: 255}}
+	if len(pal) != len(want) {
+		t.Fatalf("%d colours, want %d", len(pal), len(want))
+	}
+	for i := range want {
+		if pal[i] != want[i] {
+			t.Errorf("colour %d is %v, want %v", i, pal[i], want[i])
+		}
+	}
+	// Drawn, the half transparent red must not come out brighter than it is
+	if r, _, _, a := pal[0].RGBA(); r > a {
+		t.Errorf("premultiplied red %#x over alpha %#x", r, a)
+	}
+}
+
+// sbixTable builds an sbix table with a strike per ppem, each with a png for glyph 1 only.
+func sbixTable(t *testing.T, ppems ...int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	glyph := append([]byte{0, 0, 0, 0, 'p', 'n', 'g', ' '}, buf.Bytes()...)
+
+	be := binary.BigEndian
+	tbl := make([]byte, 8+4*len(ppems))
+	be.PutUint16(tbl, 1)
+	be.PutUint16(tbl[2:], 1)
+	be.PutUint32(tbl[4:], uint32(len(ppems)))
+	for i, ppem := range ppems {
+		be.PutUint32(tbl[8+4*i:], uint32(len(tbl)))
+		// ppem, ppi, then offsets for glyphs 0, 1 and the end: glyph 0 is empty
+		strike := make([]byte, 16)
+		be.PutUint16(strike, uint16(ppem))
+		be.PutUint16(strike[2:], 72)
+		be.PutUint32(strike[4:], 16)
+		be.PutUint32(strike[8:], 16)
+		be.PutUint32(strike[12:], uint32(16+len(glyph)))
+		tbl = append(tbl, strike...)
+		tbl = append(tbl, glyph...)
+	}
+	return tbl
+}
+
+func TestColorBitmapStrikes(t *testing.T) {
+	c := &colorFont{sbix: sbixTable(t, 20, 40), numGlyphs: 2}
+
+	// Any size up to 20 uses the 20 strike, decoded once and scaled when drawn
+	small := c.bitmap(1, 15)
+	for _, size := range []float64{10, 17.5, 19.9, 20} {
+		if b := c.bitmap(1, size); b != small {
+			t.Errorf("size %v: a different bitmap to size 15", size)
+		}
+	}
+	if small == nil || small.ppem != 20 {
+		t.Fatalf("size 15: bitmap %v, want the 20 ppem strike", small)
+	}
+	if ink := small.ink(10); ink.Right != 2 || ink.Top != -2 {
+		t.Errorf("4 pixels at 20 ppem drawn at 10: ink %+v, want 2 wide and high", ink)
+	}
+	if b := c.bitmap(1, 30); b == nil || b.ppem != 40 {
+		t.Errorf("size 30: bitmap %v, want the 40 ppem strike", b)
+	}
+	if b := c.bitmap(0, 15); b != nil {
+		t.Errorf("glyph 0 has no bitmap, got %v", b)
+	}
+	if n := len(c.bitmaps); n != 4 {
+		t.Errorf("%d cached bitmaps, want one per glyph and strike tried: 4", n)
+	}
+}
+
+// collection wraps a font file in a single font TrueType collection.
+func collection(font []byte) []byte {
+	be := binary.BigEndian
+	out := []byte{'t', 't', 'c', 'f', 0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 16}
+	out = append(out, font...)
+	// Table offsets are from the start of the file, which moved
+	dir := out[16:]
+	for i := 0; i < int(be.Uint16(dir[4:])); i++ {
+		rec := dir[12+16*i:]
+		be.PutUint32(rec[8:], be.Uint32(rec[8:])+16)
+	}
+	return out
+}
+
+func TestParseSFNTCollection(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/shaping.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttc := collection(data)
+	s, err := parseSFNT(ttc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, _ := parseSFNT(data)
+	for _, tag := range []string{"GSUB", "GPOS", "GDEF", "cmap"} {
+		if !bytes.Equal(s.table(tag), font.table(tag)) {
+			t.Errorf("%s table differs in the collection", tag)
+		}
+	}
+
+	// And the shaping tables are used, GPOS kerning AV
+	fc := NewFontCache()
+	f, err := fc.StoreData(draw2d.FontData{Name: "collection"}, ttc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := layoutText(fc, f, 1000, "AV", DirectionLTR); run.advance != 1050 {
+		t.Errorf("AV advance %v, want 1050", run.advance)
+	}
+}
+
+func TestColorBitmapEviction(t *testing.T) {
+	// Each 4x4 bitmap counts as 128 bytes, so two fit
+	c := &colorFont{sbix: sbixTable(t, 20, 40, 80), numGlyphs: 2, maxBytes: 300}
+	small := c.bitmap(1, 15)
+	mid := c.bitmap(1, 30)
+	if c.bitmap(1, 15) != small || c.bytes != 256 {
+		t.Fatalf("both bitmaps should be cached, taking 256 bytes, not %d", c.bytes)
+	}
+	// Decoding the 80 strike drops the 40 one, now least recently used
+	big := c.bitmap(1, 60)
+	if c.bytes > 300 || c.lru.Len() != 2 {
+		t.Errorf("%d bitmaps taking %d bytes, want 2 in at most 300", c.lru.Len(), c.bytes)
+	}
+	if c.bitmap(1, 15) != small || c.bitmap(1, 60) != big {
+		t.Error("the recently used bitmaps were evicted")
+	}
+	if b := c.bitmap(1, 30); b == mid || b == nil || b.ppem != 40 {
+		t.Errorf("the 40 strike wasn't decoded again: %v", b)
+	}
+
+	// One bitmap over the limit alone is still kept while it's in use
+	c.maxBytes = 1
+	if b := c.bitmap(1, 15); b == nil || c.lru.Len() != 1 {
+		t.Errorf("bitmap %v with %d cached, want it alone", b, c.lru.Len())
+	}
+}
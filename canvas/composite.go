@@ -0,0 +1,259 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"math"
+)
+
+// CompositeOp is how drawing is combined with what is already on the canvas, as canvas globalCompositeOperation.
+// The first group are the Porter-Duff operators, the rest are blend modes, which draw source-over with the colours mixed.
+type CompositeOp int
+
+const (
+	OpSourceOver      CompositeOp = iota // Draw over the top (the default)
+	OpSourceIn                           // Only where there already is something, clearing everything else
+	OpSourceOut                          // Only where there is nothing yet, clearing everything else
+	OpSourceAtop                         // Only on top of what is already there
+	OpDestinationOver                    // Behind what is already there
+	OpDestinationIn                      // Keep what is there only where drawing covers it
+	OpDestinationOut                     // Erase where drawing covers
+	OpDestinationAtop                    // Keep what is there only where drawing covers it, with the drawing behind
+	OpLighter                            // Add the colours
+	OpCopy                               // Replace the canvas with the drawing
+	OpXor                                // Either the drawing or what is there, but not both
+
+	OpMultiply
+	OpScreen
+	OpOverlay
+	OpDarken
+	OpLighten
+	OpColorDodge
+	OpColorBurn
+	OpHardLight
+	OpSoftLight
+	OpDifference
+	OpExclusion
+	OpHue
+	OpSaturation
+	OpColor
+	OpLuminosity
+)
+
+var compositeNames = [...]string{
+	"source-over", "source-in", "source-out", "source-atop",
+	"destination-over", "destination-in", "destination-out", "destination-atop",
+	"lighter", "copy", "xor",
+	"multiply", "screen", "overlay", "darken", "lighten", "color-dodge", "color-burn",
+	"hard-light", "soft-light", "difference", "exclusion", "hue", "saturation", "color", "luminosity",
+}
+
+// String returns the canvas name of the operation, such as "destination-out".
+func (op CompositeOp) String() string {
+	if op < 0 || int(op) >= len(compositeNames) {
+		return "source-over"
+	}
+	return compositeNames[op]
+}
+
+// ParseCompositeOp returns the operation for a canvas globalCompositeOperation name.
+func ParseCompositeOp(name string) (CompositeOp, bool) {
+	for i, n := range compositeNames {
+		if n == name {
+			return CompositeOp(i), true
+		}
+	}
+	return OpSourceOver, false
+}
+
+// unbounded reports whether the operation changes the canvas outside of what is drawn, where the source is transparent.
+func (op CompositeOp) unbounded() bool {
+	switch op {
+	case OpSourceIn, OpSourceOut, OpDestinationIn, OpDestinationAtop, OpCopy:
+		return true
+	}
+	return false
+}
+
+// composite combines a premultiplied source and destination pixel, all values 0 to 1, and returns the premultiplied result.
+func composite(op CompositeOp, s, d [4]float64) [4]float64 {
+	sa, da := s[3], d[3]
+	var fa, fb float64
+	switch op {
+	case OpSourceOver:
+		fa, fb = 1, 1-sa
+	case OpSourceIn:
+		fa, fb = da, 0
+	case OpSourceOut:
+		fa, fb = 1-da, 0
+	case OpSourceAtop:
+		fa, fb = da, 1-sa
+	case OpDestinationOver:
+		fa, fb = 1-da, 1
+	case OpDestinationIn:
+		fa, fb = 0, sa
+	case OpDestinationOut:
+		fa, fb = 0, 1-sa
+	case OpDestinationAtop:
+		fa, fb = 1-da, sa
+	case OpLighter:
+		return [4]float64{math.Min(1, s[0]+d[0]), math.Min(1, s[1]+d[1]), math.Min(1, s[2]+d[2]), math.Min(1, sa+da)}
+	case OpCopy:
+		return s
+	case OpXor:
+		fa, fb = 1-da, 1-sa
+	default:
+		return blend(op, s, d)
+	}
+	return [4]float64{s[0]*fa + d[0]*fb, s[1]*fa + d[1]*fb, s[2]*fa + d[2]*fb, sa*fa + da*fb}
+}
+
+// blend draws s over d with a blend mode, following the W3C compositing spec:
+// where both are opaque the colour is B(cb, cs), fading to plain source-over where either is transparent.
+func blend(op CompositeOp, s, d [4]float64) [4]float64 {
+	sa, da := s[3], d[3]
+	if sa == 0 {
+		return d
+	}
+	var cs, cb [3]float64 // Unpremultiplied
+	for i := 0; i < 3; i++ {
+		cs[i] = s[i] / sa
+		if da > 0 {
+			cb[i] = d[i] / da
+		}
+	}
+	var b [3]float64
+	switch op {
+	case OpHue:
+		b = setLum(setSat(cs, sat(cb)), lum(cb))
+	case OpSaturation:
+		b = setLum(setSat(cb, sat(cs)), lum(cb))
+	case OpColor:
+		b = setLum(cs, lum(cb))
+	case OpLuminosity:
+		b = setLum(cb, lum(cs))
+	default:
+		for i := range b {
+			b[i] = blendChannel(op, cb[i], cs[i])
+		}
+	}
+	var out [4]float64
+	for i := 0; i < 3; i++ {
+		out[i] = s[i]*(1-da) + d[i]*(1-sa) + sa*da*b[i]
+	}
+	out[3] = sa + da - sa*da
+	return out
+}
+
+// blendChannel is the separable blend function B(cb, cs) for one colour channel.
+func blendChannel(op CompositeOp, cb, cs float64) float64 {
+	switch op {
+	case OpMultiply:
+		return cb * cs
+	case OpScreen:
+		return cb + cs - cb*cs
+	case OpOverlay:
+		return blendChannel(OpHardLight, cs, cb)
+	case OpDarken:
+		return math.Min(cb, cs)
+	case OpLighten:
+		return math.Max(cb, cs)
+	case OpColorDodge:
+		if cb == 0 {
+			return 0
+		}
+		if cs >= 1 {
+			return 1
+		}
+		return math.Min(1, cb/(1-cs))
+	case OpColorBurn:
+		if cb >= 1 {
+			return 1
+		}
+		if cs <= 0 {
+			return 0
+		}
+		return 1 - math.Min(1, (1-cb)/cs)
+	case OpHardLight:
+		if cs <= 0.5 {
+			return cb * 2 * cs
+		}
+		return blendChannel(OpScreen, cb, 2*cs-1)
+	case OpSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		dc := math.Sqrt(cb)
+		if cb <= 0.25 {
+			dc = ((16*cb-12)*cb + 4) * cb
+		}
+		return cb + (2*cs-1)*(dc-cb)
+	case OpDifference:
+		return math.Abs(cb - cs)
+	case OpExclusion:
+		return cb + cs - 2*cb*cs
+	}
+	return cs
+}
+
+// The non-separable blend mode helpers from the compositing spec
+
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+func clipColor(c [3]float64) [3]float64 {
+	l := lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	return clipColor([3]float64{c[0] + d, c[1] + d, c[2] + d})
+}
+
+func sat(c [3]float64) float64 {
+	return math.Max(c[0], math.Max(c[1], c[2])) - math.Min(c[0], math.Min(c[1], c[2]))
+}
+
+func setSat(c [3]float64, s float64) [3]float64 {
+	// Order the channels by value, then stretch them to the new range
+	lo, mid, hi := 0, 1, 2
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+	if c[mid] > c[hi] {
+		mid, hi = hi, mid
+	}
+	if c[lo] > c[mid] {
+		lo, mid = mid, lo
+	}
+	var out [3]float64
+	if c[hi] > c[lo] {
+		out[mid] = (c[mid] - c[lo]) * s / (c[hi] - c[lo])
+		out[hi] = s
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/draw"
+	"math"
+
+	"github.com/llgcode/draw2d"
+	xdraw "golang.org/x/image/draw"
+)
+
+// ImageQuality says how images are resampled when drawn scaled or turned, like canvas imageSmoothingEnabled / imageSmoothingQuality.
+type ImageQuality int
+
+const (
+	QualityBilinear   ImageQuality = iota // Smooth, and quick; the default
+	QualityNearest                        // No smoothing, so pixel art stays sharp
+	QualityCatmullRom                     // Sharper than bilinear, and averages properly when shrinking without turning; the slowest
+)
+
+// drawImage draws the sr part of img, its top left corner at the origin, placed by tr on top of the graphic context's transform.
+// opacity multiplies the global alpha.
+// Whole pixel moves, and scales landing on whole pixels, are drawn without going through the rasterizer.
+func (p *painter) drawImage(img image.Image, sr image.Rectangle, tr draw2d.Matrix, opacity float64) {
+	sr = sr.Intersect(img.Bounds())
+	if sr.Empty() || opacity <= 0 {
+		return
+	}
+	defer func(alpha float64) { p.alpha = alpha }(p.alpha)
+	p.alpha *= math.Min(opacity, 1)
+
+	m := p.gc.Current.Tr.Copy()
+	m.Compose(tr)
+	w, h := float64(sr.Dx()), float64(sr.Dy())
+	if m[1] == 0 && m[2] == 0 && m[0] > 0 && m[3] > 0 {
+		x0, y0 := m[4], m[5]
+		x1, y1 := x0+m[0]*w, y0+m[3]*h
+		if whole(x0) && whole(y0) && whole(x1) && whole(y1) {
+			dr := image.Rect(int(math.Round(x0)), int(math.Round(y0)), int(math.Round(x1)), int(math.Round(y1)))
+			dst := p.begin()
+			p.bound(dr)
+			if dr.Size() == sr.Size() {
+				draw.Draw(dst, dr, img, sr.Min, draw.Over)
+			} else {
+				scaler(p.quality).Scale(dst, dr, img, sr, draw.Over, nil)
+			}
+			p.end()
+			return
+		}
+	}
+
+	// Anything else is filled as a path with the image as a pattern, so the edges are anti-aliased
+	pat := &Pattern{src: rgbaRect(img, sr), repeat: NoRepeat, quality: p.quality}
+	pat.SetTransform(tr)
+	path := &draw2d.Path{}
+	path.MoveTo(tr.TransformPoint(0, 0))
+	path.LineTo(tr.TransformPoint(w, 0))
+	path.LineTo(tr.TransformPoint(w, h))
+	path.LineTo(tr.TransformPoint(0, h))
+	path.Close()
+	gc := p.gc
+	gc.Save()
+	gc.BeginPath()
+	gc.SetFillColor(pat)
+	gc.Fill(path)
+	gc.Restore()
+}
+
+// scaler returns the x/image kernel for a quality.
+func scaler(q ImageQuality) xdraw.Scaler {
+	switch q {
+	case QualityNearest:
+		return xdraw.NearestNeighbor
+	case QualityCatmullRom:
+		return xdraw.CatmullRom
+	}
+	return xdraw.BiLinear
+}
+
+// whole reports whether v is, near enough, a whole number.
+func whole(v float64) bool {
+	return math.Abs(v-math.Round(v)) < 1e-6
+}
+
+// rgbaRect returns the r part of img as an RGBA image with its top left corner at the origin.
+// RGBA images are shared rather than copied.
+func rgbaRect(img image.Image, r image.Rectangle) *image.RGBA {
+	if m, ok := img.(*image.RGBA); ok {
+		sub := m.SubImage(r).(*image.RGBA)
+		return &image.RGBA{Pix: sub.Pix, Stride: sub.Stride, Rect: image.Rect(0, 0, r.Dx(), r.Dy())}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Rect, img, r.Min, draw.Src)
+	return dst
+}
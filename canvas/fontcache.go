@@ -23,16 +23,123 @@ import (
 	"github.com/llgcode/draw2d"
 )
 
-type FontCache map[string]*truetype.Font
+// Font returned by Load when the requested font has not been stored
+const defaultFontName = "roboto"
 
-func (f FontCache) Load(fd draw2d.FontData) (*truetype.Font, error) {
-	font, ok := f[fd.Name]
+// FontCache holds the fonts available to the canvas, keyed by FontData name.
+// It implements draw2d.FontCache so it can be handed straight to the GraphicContext.
+//
+// It also holds an ordered fallback chain.  When the font being drawn has no glyph for a rune (CJK, Arabic, symbols etc.)
+// each fallback font is tried in turn, so mixed script strings render instead of showing empty boxes.
+type FontCache struct {
+	fonts    map[string]*truetype.Font
+	raw      map[*truetype.Font]*sfntFont // Raw tables, for fonts added with StoreData
+	fallback []string                     // Names of fonts tried, in order, for runes missing from the primary font
+	noShape  bool                         // Disables OpenType shaping, leaving just the truetype kern table
+}
+
+// NewFontCache creates an empty FontCache.  The zero value is also ready to use.
+func NewFontCache() *FontCache {
+	return &FontCache{
+		fonts: make(map[string]*truetype.Font),
+		raw:   make(map[*truetype.Font]*sfntFont),
+	}
+}
+
+// Load returns the font stored under fd.Name, or the default (roboto) font if there is none.
+func (f *FontCache) Load(fd draw2d.FontData) (*truetype.Font, error) {
+	font, ok := f.fonts[fd.Name]
 	if !ok {
-		return f["roboto"], nil
+		return f.fonts[defaultFontName], nil
 	}
 	return font, nil
 }
 
+// Store adds or replaces the font under fd.Name.
 func (f *FontCache) Store(fd draw2d.FontData, tf *truetype.Font) {
-	(*f)[fd.Name] = tf
+	if f.fonts == nil {
+		f.fonts = make(map[string]*truetype.Font)
+	}
+	f.fonts[fd.Name] = tf
+}
+
+// Fonts returns the stored fonts, keyed by name.  This is the map FontCache used to be, so code that indexed or ranged over it
+// can call Fonts() instead.  It is the cache's own map; fonts put in it are stored, though without the raw tables StoreData keeps.
+func (f *FontCache) Fonts() map[string]*truetype.Font {
+	if f.fonts == nil {
+		f.fonts = make(map[string]*truetype.Font)
+	}
+	return f.fonts
+}
+
+// StoreData parses a TrueType font file and stores it under fd.Name.
+// Unlike Store, the raw font tables are kept as well, giving access to the extra metrics and features truetype.Font does not expose.
+func (f *FontCache) StoreData(fd draw2d.FontData, data []byte) (*truetype.Font, error) {
+	tf, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := parseSFNT(data)
+	if err != nil {
+		return nil, err
+	}
+	f.Store(fd, tf)
+	if f.raw == nil {
+		f.raw = make(map[*truetype.Font]*sfntFont)
+	}
+	f.raw[tf] = raw
+	return tf, nil
+}
+
+// SetShaping turns OpenType shaping (GPOS kerning, ligatures and mark positioning) on or off.  It is on by default.
+// Shaping needs the raw font tables, so only applies to fonts added with StoreData.
+func (f *FontCache) SetShaping(enabled bool) {
+	f.noShape = !enabled
+}
+
+// shaping returns the shaping tables for tf, or nil if shaping is off or unavailable for it.
+func (f *FontCache) shaping(tf *truetype.Font) *otLayout {
+	if f == nil || f.noShape {
+		return nil
+	}
+	return f.rawFont(tf).layout()
+}
+
+// rawFont returns the raw tables for tf, or nil if it was stored without them.
+func (f *FontCache) rawFont(tf *truetype.Font) *sfntFont {
+	if f == nil {
+		return nil
+	}
+	return f.raw[tf]
+}
+
+// SetFallback sets the ordered list of font names tried for glyphs missing from the primary font.
+// Names not (yet) stored in the cache are skipped at lookup time, so fonts may be stored after the chain is set.
+func (f *FontCache) SetFallback(names ...string) {
+	f.fallback = append([]string(nil), names...)
+}
+
+// Fallback returns the current fallback chain.
+func (f *FontCache) Fallback() []string {
+	return append([]string(nil), f.fallback...)
+}
+
+// GlyphFont returns the font that should draw rune r, along with its glyph index in that font.
+// primary is used if it has the glyph, otherwise the first fallback font that does.
+// If no font has the glyph, primary's missing glyph (index 0) is returned so the gap is still visible.
+// A nil FontCache just uses primary.
+func (f *FontCache) GlyphFont(primary *truetype.Font, r rune) (*truetype.Font, truetype.Index) {
+	if index := primary.Index(r); index != 0 || f == nil {
+		return primary, index
+	}
+	for _, name := range f.fallback {
+		font := f.fonts[name]
+		if font == nil || font == primary {
+			continue
+		}
+		if index := font.Index(r); index != 0 {
+			return font, index
+		}
+	}
+	return primary, 0
 }
@@ -0,0 +1,323 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/golang/freetype/raster"
+	"github.com/golang/freetype/truetype"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/fixed"
+)
+
+// Number of sub pixel positions a glyph is cached at.  Horizontal positioning matters most for text quality,
+// vertical is snapped to the pixel grid as most text sits on an integer baseline anyway.
+const (
+	glyphSubPixelsX = 4
+	glyphSubPixelsY = 1
+)
+
+// DefaultGlyphAtlasSize is the number of glyph masks kept by the atlas created for each canvas.
+const DefaultGlyphAtlasSize = 2048
+
+// GlyphAtlas caches rasterized glyph alpha masks, keyed by font, size, glyph and sub pixel offset.
+// Each glyph outline is rasterized once, then subsequent draws just blit the mask into the destination with the requested colour.
+// Least recently used masks are evicted once the atlas holds more than its capacity.
+//
+// Not safe for concurrent use, same as the draw2d GraphicContext it sits beside.
+type GlyphAtlas struct {
+	capacity int
+	entries  map[glyphKey]*list.Element
+	lru      *list.List // Front is most recently used
+
+	rast *raster.Rasterizer
+	buf  truetype.GlyphBuf
+
+	hits   uint64
+	misses uint64
+}
+
+type glyphKey struct {
+	font   *truetype.Font
+	scale  fixed.Int26_6 // Pixels per em, 26.6
+	index  truetype.Index
+	fx, fy uint8 // Sub pixel bucket
+	color  bool  // Colour bitmap rather than an outline mask
+}
+
+type glyphMask struct {
+	key    glyphKey
+	mask   *image.Alpha
+	color  *image.RGBA // Scaled colour bitmap, for emoji
+	offset image.Point // Top left of the mask relative to the integer pen position
+}
+
+// NewGlyphAtlas creates an atlas holding at most capacity glyph masks.  A capacity <= 0 uses DefaultGlyphAtlasSize.
+func NewGlyphAtlas(capacity int) *GlyphAtlas {
+	if capacity <= 0 {
+		capacity = DefaultGlyphAtlasSize
+	}
+	return &GlyphAtlas{
+		capacity: capacity,
+		entries:  make(map[glyphKey]*list.Element, capacity),
+		lru:      list.New(),
+		rast:     raster.NewRasterizer(0, 0),
+	}
+}
+
+// Len returns the number of glyph masks currently cached.
+func (a *GlyphAtlas) Len() int {
+	return a.lru.Len()
+}
+
+// Stats returns the number of cache hits and misses since the atlas was created or last Reset.
+func (a *GlyphAtlas) Stats() (hits, misses uint64) {
+	return a.hits, a.misses
+}
+
+// SetCapacity changes the maximum number of cached masks, evicting the least recently used if required.
+func (a *GlyphAtlas) SetCapacity(capacity int) {
+	if capacity <= 0 {
+		capacity = DefaultGlyphAtlasSize
+	}
+	a.capacity = capacity
+	a.evict()
+}
+
+// Reset drops all cached glyph masks.  Useful after swapping fonts out of the FontCache.
+func (a *GlyphAtlas) Reset() {
+	a.entries = make(map[glyphKey]*list.Element, a.capacity)
+	a.lru.Init()
+	a.hits, a.misses = 0, 0
+}
+
+// DrawString draws s into dst with its baseline starting at x, y, using font f at size pixels per em, in colour c.
+// Only f itself is used, with its truetype kerning.  Returns the advance width of the string in pixels.
+func (a *GlyphAtlas) DrawString(dst draw.Image, f *truetype.Font, size float64, s string, x, y float64, c color.Color) float64 {
+	return a.drawRun(dst, layoutText(nil, f, size, s, DirectionAuto), size, x, y, c)
+}
+
+// DrawText is like DrawString, but lays the text out with fc, so it gets the fallback chain and OpenType shaping.
+// It matches the measurements from fc.Measure.
+func (a *GlyphAtlas) DrawText(dst draw.Image, fc *FontCache, f *truetype.Font, size float64, s string, x, y float64, c color.Color) float64 {
+	return a.drawRun(dst, layoutText(fc, f, size, s, DirectionAuto), size, x, y, c)
+}
+
+// drawRun blits each glyph of an already laid out run, with the run's baseline starting at x, y.
+func (a *GlyphAtlas) drawRun(dst draw.Image, run glyphRun, size float64, x, y float64, c color.Color) float64 {
+	src := image.NewUniform(c)
+	scale := fixed.Int26_6(size * 64)
+	for _, g := range run.glyphs {
+		if g.bitmap != nil {
+			drawBitmapGlyph(dst, src, g.bitmap, int(math.Round(x))+int(g.x), int(math.Round(y))+int(g.y))
+			continue
+		}
+		if g.color != nil {
+			if a.drawColorGlyph(dst, g, size, c, x+g.x, y+g.y) {
+				continue
+			}
+		}
+		a.drawGlyph(dst, src, g.font, scale, g.index, x+g.x, y+g.y)
+	}
+	return run.advance
+}
+
+// drawGlyph blits a single glyph with its origin at x, y.
+func (a *GlyphAtlas) drawGlyph(dst draw.Image, src image.Image, f *truetype.Font, scale fixed.Int26_6, index truetype.Index, x, y float64) {
+	ix, fx := splitSubPixel(x, glyphSubPixelsX)
+	iy, fy := splitSubPixel(y, glyphSubPixelsY)
+	g := a.lookup(glyphKey{font: f, scale: scale, index: index, fx: fx, fy: fy})
+	if g.mask == nil {
+		return
+	}
+	r := g.mask.Bounds().Add(g.offset).Add(image.Pt(ix, iy))
+	draw.DrawMask(dst, r, src, image.ZP, g.mask, image.ZP, draw.Over)
+}
+
+// drawColorGlyph draws a COLR or bitmap colour glyph with its origin at x, y, reporting false if g isn't one.
+// Layers of COLR glyphs go through the mask cache like any other glyph.  Bitmaps are scaled to size once and cached.
+func (a *GlyphAtlas) drawColorGlyph(dst draw.Image, g layoutGlyph, size float64, c color.Color, x, y float64) bool {
+	scale := fixed.Int26_6(size * 64)
+	if layers := g.color.layers(g.index); layers != nil {
+		for _, l := range layers {
+			var src image.Image = image.NewUniform(l.color)
+			if l.foreground {
+				src = image.NewUniform(c)
+			}
+			a.drawGlyph(dst, src, g.font, scale, l.index, x, y)
+		}
+		return true
+	}
+	if !g.color.hasBitmaps() {
+		return false
+	}
+	m := a.lookupColor(glyphKey{font: g.font, scale: scale, index: g.index, color: true}, g.color)
+	if m.color == nil {
+		return false
+	}
+	ix, iy := int(math.Round(x)), int(math.Round(y))
+	r := m.color.Bounds().Add(m.offset).Add(image.Pt(ix, iy))
+	draw.Draw(dst, r, m.color, image.ZP, draw.Over)
+	return true
+}
+
+// lookupColor is lookup for colour bitmaps.  Glyphs without a bitmap are cached with a nil image.
+func (a *GlyphAtlas) lookupColor(key glyphKey, cf *colorFont) *glyphMask {
+	if e, ok := a.entries[key]; ok {
+		a.hits++
+		a.lru.MoveToFront(e)
+		return e.Value.(*glyphMask)
+	}
+	a.misses++
+	g := &glyphMask{key: key}
+	size := fixedToFloat64(key.scale)
+	if b := cf.bitmap(key.index, size); b != nil {
+		ink := b.ink(size)
+		r := image.Rect(int(math.Round(ink.Left)), int(math.Round(ink.Top)), int(math.Round(ink.Right)), int(math.Round(ink.Bottom)))
+		if !r.Empty() {
+			g.color = image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+			xdraw.CatmullRom.Scale(g.color, g.color.Rect, b.img, b.img.Bounds(), draw.Src, nil)
+			g.offset = r.Min
+		}
+	}
+	a.entries[key] = a.lru.PushFront(g)
+	a.evict()
+	return g
+}
+
+// lookup returns the cached mask for key, rasterizing it on a miss.  Empty glyphs (e.g. space) have a nil mask.
+func (a *GlyphAtlas) lookup(key glyphKey) *glyphMask {
+	if e, ok := a.entries[key]; ok {
+		a.hits++
+		a.lru.MoveToFront(e)
+		return e.Value.(*glyphMask)
+	}
+	a.misses++
+	g := a.rasterize(key)
+	a.entries[key] = a.lru.PushFront(g)
+	a.evict()
+	return g
+}
+
+func (a *GlyphAtlas) evict() {
+	for a.lru.Len() > a.capacity {
+		e := a.lru.Back()
+		delete(a.entries, e.Value.(*glyphMask).key)
+		a.lru.Remove(e)
+	}
+}
+
+// rasterize renders the glyph outline for key into a new alpha mask.
+// Empty glyphs are still cached (with a nil mask) so they are not re-loaded every time.
+func (a *GlyphAtlas) rasterize(key glyphKey) *glyphMask {
+	g := &glyphMask{key: key}
+	if err := loadGlyph(&a.buf, key.font, key.scale, key.index); err != nil {
+		return g
+	}
+	dx := fixed.Int26_6(int(key.fx) * 64 / glyphSubPixelsX)
+	dy := fixed.Int26_6(int(key.fy) * 64 / glyphSubPixelsY)
+
+	// Integer pixel bounds of the glyph, with Y going downwards
+	xmin := int(dx+a.buf.Bounds.Min.X) >> 6
+	ymin := int(dy-a.buf.Bounds.Max.Y) >> 6
+	xmax := int(dx+a.buf.Bounds.Max.X+0x3f) >> 6
+	ymax := int(dy-a.buf.Bounds.Min.Y+0x3f) >> 6
+	if xmin >= xmax || ymin >= ymax {
+		return g
+	}
+	// Shift so the glyph sits inside the rasterizer's positive space
+	dx -= fixed.Int26_6(xmin << 6)
+	dy -= fixed.Int26_6(ymin << 6)
+
+	g.mask = image.NewAlpha(image.Rect(0, 0, xmax-xmin, ymax-ymin))
+	g.offset = image.Pt(xmin, ymin)
+
+	a.rast.SetBounds(xmax-xmin, ymax-ymin) // Also clears
+	e0 := 0
+	for _, e1 := range a.buf.Ends {
+		drawContour(a.rast, a.buf.Points[e0:e1], dx, dy)
+		e0 = e1
+	}
+	a.rast.Rasterize(raster.NewAlphaSrcPainter(g.mask))
+	return g
+}
+
+// drawContour adds a closed truetype contour to the rasterizer at the given offset.
+// Truetype glyphs only use quadratic curves, and two consecutive off curve points imply an on curve point between them.
+func drawContour(r *raster.Rasterizer, ps []truetype.Point, dx, dy fixed.Int26_6) {
+	if len(ps) == 0 {
+		return
+	}
+	pt := func(p truetype.Point) fixed.Point26_6 {
+		return fixed.Point26_6{X: dx + p.X, Y: dy - p.Y}
+	}
+	mid := func(a, b fixed.Point26_6) fixed.Point26_6 {
+		return fixed.Point26_6{X: (a.X + b.X) / 2, Y: (a.Y + b.Y) / 2}
+	}
+
+	start := pt(ps[0])
+	others := ps[1:]
+	if ps[0].Flags&0x01 == 0 {
+		last := pt(ps[len(ps)-1])
+		if ps[len(ps)-1].Flags&0x01 != 0 {
+			start = last
+			others = ps[:len(ps)-1]
+		} else {
+			start = mid(start, last)
+			others = ps
+		}
+	}
+	r.Start(start)
+	q0, on0 := start, true
+	for _, p := range others {
+		q, on := pt(p), p.Flags&0x01 != 0
+		if on {
+			if on0 {
+				r.Add1(q)
+			} else {
+				r.Add2(q0, q)
+			}
+		} else if !on0 {
+			r.Add2(q0, mid(q0, q))
+		}
+		q0, on0 = q, on
+	}
+	if on0 {
+		r.Add1(start)
+	} else {
+		r.Add2(q0, start)
+	}
+}
+
+// splitSubPixel splits v into an integer pixel and a sub pixel bucket out of n.
+func splitSubPixel(v float64, n int) (int, uint8) {
+	if n <= 1 {
+		return int(math.Floor(v + 0.5)), 0
+	}
+	// Round to the nearest bucket first, so 0.99 goes to the next pixel rather than the last bucket
+	q := math.Floor(v*float64(n) + 0.5)
+	i := math.Floor(q / float64(n))
+	return int(i), uint8(q - i*float64(n))
+}
+
+// fixedToFloat64 converts a 26.6 fixed point value to float64 pixels.
+func fixedToFloat64(x fixed.Int26_6) float64 {
+	return float64(x) / 64
+}
@@ -0,0 +1,134 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+)
+
+const benchText = "The quick brown fox jumps over the lazy dog 0123456789"
+
+var testFontData = draw2d.FontData{Name: "test"}
+
+// testFonts returns a font cache holding the embedded font, as a canvas sets one up, and the font itself.
+func testFonts(tb testing.TB) (*FontCache, *truetype.Font) {
+	tb.Helper()
+	f, err := truetype.Parse(FontData["font.ttf"])
+	if err != nil {
+		tb.Fatal(err)
+	}
+	fc := &FontCache{}
+	fc.Store(testFontData, f)
+	return fc, f
+}
+
+// newTestContext returns a draw2d context drawing into dst with the embedded font at size 16.
+func newTestContext(fc *FontCache, dst *image.RGBA) *draw2dimg.GraphicContext {
+	gc := draw2dimg.NewGraphicContext(dst)
+	gc.FontCache = fc
+	gc.SetFontData(testFontData)
+	gc.SetFontSize(16)
+	gc.SetDPI(72)
+	gc.SetFillColor(color.Black)
+	return gc
+}
+
+func TestGlyphAtlasEviction(t *testing.T) {
+	_, f := testFonts(t)
+	dst := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	a := NewGlyphAtlas(3)
+	draw := func(s string) {
+		a.DrawString(dst, f, 16, s, 10, 30, color.Black)
+	}
+
+	draw("a")
+	draw("b")
+	draw("c")
+	draw("a") // a is now the most recently used, leaving b the least
+	if hits, misses := a.Stats(); hits != 1 || misses != 3 {
+		t.Fatalf("after a b c a: hits %d misses %d, want 1 3", hits, misses)
+	}
+	draw("d") // Evicts b
+	if a.Len() != 3 {
+		t.Fatalf("Len %d, want 3", a.Len())
+	}
+	draw("a")
+	draw("c")
+	if hits, misses := a.Stats(); hits != 3 || misses != 4 {
+		t.Fatalf("a and c should still be cached: hits %d misses %d, want 3 4", hits, misses)
+	}
+	draw("b")
+	if hits, misses := a.Stats(); hits != 3 || misses != 5 {
+		t.Fatalf("b should have been evicted: hits %d misses %d, want 3 5", hits, misses)
+	}
+
+	a.SetCapacity(1)
+	if a.Len() != 1 {
+		t.Fatalf("Len %d after SetCapacity(1), want 1", a.Len())
+	}
+	a.Reset()
+	if hits, misses := a.Stats(); a.Len() != 0 || hits != 0 || misses != 0 {
+		t.Fatalf("Reset left %d masks, hits %d misses %d", a.Len(), hits, misses)
+	}
+}
+
+func TestGlyphAtlasMatchesAdvance(t *testing.T) {
+	fc, f := testFonts(t)
+	dst := image.NewRGBA(image.Rect(0, 0, 600, 40))
+	a := NewGlyphAtlas(0)
+	w := a.DrawString(dst, f, 16, benchText, 0, 30, color.Black)
+	if want := newTestContext(fc, image.NewRGBA(dst.Rect)).FillStringAt(benchText, 0, 30); w != want {
+		t.Errorf("DrawString advanced %v, draw2d %v", w, want)
+	}
+	inked := false
+	for _, v := range dst.Pix {
+		if v != 0 {
+			inked = true
+			break
+		}
+	}
+	if !inked {
+		t.Error("DrawString drew nothing")
+	}
+}
+
+// BenchmarkFillText draws a line of text through the glyph atlas, as Canvas2d.FillText does once the masks are cached.
+func BenchmarkFillText(b *testing.B) {
+	_, f := testFonts(b)
+	dst := image.NewRGBA(image.Rect(0, 0, 600, 40))
+	a := NewGlyphAtlas(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.DrawString(dst, f, 16, benchText, 0, 30, color.Black)
+	}
+}
+
+// BenchmarkFillStringAt draws the same line with draw2d, which rasterizes each glyph's outline every time.
+func BenchmarkFillStringAt(b *testing.B) {
+	fc, _ := testFonts(b)
+	gc := newTestContext(fc, image.NewRGBA(image.Rect(0, 0, 600, 40)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gc.FillStringAt(benchText, 0, 30)
+	}
+}
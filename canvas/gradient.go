@@ -0,0 +1,234 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/llgcode/draw2d"
+)
+
+// Paint is a colour that varies across the canvas.  Pass one to SetFillColor or SetStrokeColor of the graphic context
+// and paths are filled or stroked with it, instead of a solid colour.
+// As a plain color.Color (for the odd draw2d call that needs one) it gives a representative solid colour.
+type Paint interface {
+	color.Color
+	// Shade fills dst with the premultiplied colours of the pixels from x, y rightwards.
+	// inv maps canvas pixels back to the space the paint was defined in, which is the graphic context's space when the path was drawn.
+	Shade(dst []color.RGBA, x, y int, inv draw2d.Matrix)
+}
+
+// SpreadMode says how a gradient carries on past its first and last colour stops.
+type SpreadMode int
+
+const (
+	SpreadPad     SpreadMode = iota // The end colours carry on forever (the canvas behaviour)
+	SpreadRepeat                    // The gradient starts over
+	SpreadReflect                   // The gradient runs back and forth
+)
+
+type gradientKind int
+
+const (
+	linearGradient gradientKind = iota
+	radialGradient
+	conicGradient
+)
+
+// Number of pre-computed colours along a gradient
+const gradientSteps = 1024
+
+// ColorStop is a colour at an offset from 0 to 1 along a gradient.
+type ColorStop struct {
+	Offset float64
+	Color  color.Color
+}
+
+// Gradient is a linear, radial or conic gradient paint, as from the HTML canvas createXXXGradient functions.
+// Colours are interpolated unpremultiplied between the stops, like the browser does.
+type Gradient struct {
+	kind       gradientKind
+	x0, y0, r0 float64
+	x1, y1, r1 float64
+	angle      float64
+	stops      []ColorStop
+	spread     SpreadMode
+	lut        []color.RGBA // Premultiplied colours, built on first use
+}
+
+// NewLinearGradient returns a gradient along the line from x0, y0 to x1, y1.
+func NewLinearGradient(x0, y0, x1, y1 float64) *Gradient {
+	return &Gradient{kind: linearGradient, x0: x0, y0: y0, x1: x1, y1: y1}
+}
+
+// NewRadialGradient returns a gradient between the circle at x0, y0 with radius r0 and the one at x1, y1 with radius r1.
+// Like canvas, the circles need not be concentric, which gives cone and spotlight shapes.
+func NewRadialGradient(x0, y0, r0, x1, y1, r1 float64) *Gradient {
+	return &Gradient{kind: radialGradient, x0: x0, y0: y0, r0: math.Max(r0, 0), x1: x1, y1: y1, r1: math.Max(r1, 0)}
+}
+
+// NewConicGradient returns a gradient sweeping clockwise around x, y, starting at angle radians from the x axis.
+func NewConicGradient(angle, x, y float64) *Gradient {
+	return &Gradient{kind: conicGradient, x0: x, y0: y, angle: angle}
+}
+
+// AddColorStop adds a colour at offset, from 0 to 1, along the gradient.  Stops at the same offset give a hard edge,
+// in the order they were added.
+func (g *Gradient) AddColorStop(offset float64, c color.Color) *Gradient {
+	g.stops = append(g.stops, ColorStop{math.Max(0, math.Min(1, offset)), c})
+	sort.SliceStable(g.stops, func(a, b int) bool { return g.stops[a].Offset < g.stops[b].Offset })
+	g.lut = nil
+	return g
+}
+
+// SetSpread sets how the gradient carries on past its ends.  The default is SpreadPad.
+func (g *Gradient) SetSpread(s SpreadMode) *Gradient {
+	g.spread = s
+	return g
+}
+
+// Stops returns the colour stops, in offset order.
+func (g *Gradient) Stops() []ColorStop {
+	return g.stops
+}
+
+// RGBA gives the colour halfway along the gradient.
+func (g *Gradient) RGBA() (r, gr, b, a uint32) {
+	return g.table()[gradientSteps/2].RGBA()
+}
+
+// Shade fills dst with the gradient's colours along a row of pixels.
+func (g *Gradient) Shade(dst []color.RGBA, x, y int, inv draw2d.Matrix) {
+	lut := g.table()
+	px, py := inv.TransformPoint(float64(x)+0.5, float64(y)+0.5)
+	dx, dy := inv[0], inv[1] // Step in paint space for one pixel right
+	for i := range dst {
+		t, ok := g.offset(px+float64(i)*dx, py+float64(i)*dy)
+		if !ok {
+			dst[i] = color.RGBA{}
+			continue
+		}
+		dst[i] = lut[g.index(t)]
+	}
+}
+
+// offset returns where on the gradient a point falls, before spreading.  Radial gradients don't cover everywhere, which gives false.
+func (g *Gradient) offset(x, y float64) (float64, bool) {
+	switch g.kind {
+	case linearGradient:
+		dx, dy := g.x1-g.x0, g.y1-g.y0
+		l := dx*dx + dy*dy
+		if l == 0 {
+			return 0, false // Canvas paints nothing for a zero length gradient
+		}
+		return ((x-g.x0)*dx + (y-g.y0)*dy) / l, true
+	case radialGradient:
+		return g.radialOffset(x, y)
+	default:
+		t := (math.Atan2(y-g.y0, x-g.x0) - g.angle) / (2 * math.Pi)
+		return t - math.Floor(t), true
+	}
+}
+
+// radialOffset finds the largest t where the interpolated circle, with a radius that isn't negative, passes through x, y.
+func (g *Gradient) radialOffset(x, y float64) (float64, bool) {
+	cdx, cdy, dr := g.x1-g.x0, g.y1-g.y0, g.r1-g.r0
+	pdx, pdy := x-g.x0, y-g.y0
+	a := cdx*cdx + cdy*cdy - dr*dr
+	b := pdx*cdx + pdy*cdy + g.r0*dr
+	c := pdx*pdx + pdy*pdy - g.r0*g.r0
+	if math.Abs(a) < 1e-9 {
+		if b == 0 {
+			return 0, false
+		}
+		t := c / (2 * b)
+		return t, g.r0+t*dr >= 0
+	}
+	disc := b*b - a*c
+	if disc < 0 {
+		return 0, false
+	}
+	s := math.Sqrt(disc)
+	t0, t1 := (b+s)/a, (b-s)/a
+	if t1 > t0 {
+		t0, t1 = t1, t0
+	}
+	if g.r0+t0*dr >= 0 {
+		return t0, true
+	}
+	if g.r0+t1*dr >= 0 {
+		return t1, true
+	}
+	return 0, false
+}
+
+// index spreads an offset and turns it into an entry of the colour table.
+func (g *Gradient) index(t float64) int {
+	switch g.spread {
+	case SpreadRepeat:
+		t -= math.Floor(t)
+	case SpreadReflect:
+		t = math.Mod(math.Abs(t), 2)
+		if t > 1 {
+			t = 2 - t
+		}
+	}
+	i := int(t*(gradientSteps-1) + 0.5)
+	if i < 0 {
+		return 0
+	}
+	if i >= gradientSteps {
+		return gradientSteps - 1
+	}
+	return i
+}
+
+// table returns the pre-computed colours along the gradient, building it if the stops changed.
+func (g *Gradient) table() []color.RGBA {
+	if g.lut != nil {
+		return g.lut
+	}
+	g.lut = make([]color.RGBA, gradientSteps)
+	if len(g.stops) == 0 {
+		return g.lut // Transparent, as canvas draws with no stops
+	}
+	stops := make([]color.NRGBA, len(g.stops))
+	for i, s := range g.stops {
+		stops[i] = color.NRGBAModel.Convert(s.Color).(color.NRGBA)
+	}
+	k := 0
+	for i := range g.lut {
+		t := float64(i) / (gradientSteps - 1)
+		for k < len(g.stops)-1 && g.stops[k+1].Offset <= t {
+			k++
+		}
+		c := stops[k]
+		if k < len(g.stops)-1 && t > g.stops[k].Offset {
+			f := (t - g.stops[k].Offset) / (g.stops[k+1].Offset - g.stops[k].Offset)
+			c = lerpNRGBA(stops[k], stops[k+1], f)
+		} else if t < g.stops[0].Offset {
+			c = stops[0]
+		}
+		g.lut[i] = color.RGBAModel.Convert(c).(color.RGBA)
+	}
+	return g.lut
+}
+
+func lerpNRGBA(a, b color.NRGBA, f float64) color.NRGBA {
+	l := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5) }
+	return color.NRGBA{l(a.R, b.R), l(a.G, b.G), l(a.B, b.B), l(a.A, b.A)}
+}
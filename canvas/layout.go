@@ -0,0 +1,223 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+	"golang.org/x/image/math/fixed"
+)
+
+// glyphRun is a single line of text laid out into positioned glyphs.
+// Drawing and measuring both work from the same run, so the two always agree, even when glyphs come from several fonts.
+type glyphRun struct {
+	glyphs  []layoutGlyph
+	advance float64 // Total advance width in pixels
+}
+
+type layoutGlyph struct {
+	font    *truetype.Font
+	index   truetype.Index
+	r       rune    // First rune the glyph was made from.  Ligatures cover several
+	cluster int     // Byte offset of r in the source string
+	x, y    float64 // Glyph origin relative to the start of the run, in pixels.  Y goes downwards
+	advance float64 // Pen advance, including any kerning / positioning adjustments
+
+	// Shaping state, resolved into x, y once the run is positioned
+	dx, dy   float64 // Placement offset from the pen position, or from the base glyph when attached
+	attached bool    // Mark attached to glyph base, rather than placed at the pen
+	base     int
+
+	bitmap *BitmapGlyph // Set instead of font for glyphs from a BitmapFont, already scaled
+	color  *colorFont   // Colour tables of font, if it has any
+}
+
+// layoutText lays out s as a single line using primary at size pixels per em, taking missing glyphs from the fallback chain of fc (which may be nil).
+// The text is reordered for display with the bidirectional algorithm, using dir as the paragraph direction.
+func layoutText(fc *FontCache, primary *truetype.Font, size float64, s string, dir TextDirection) glyphRun {
+	p := resolveBidi(s, dir)
+	return layoutLine(fc, primary, size, p, 0, len(p.runes))
+}
+
+// layoutLine lays out runes [start, end) of a resolved paragraph as one line, in visual order.
+// Each directional run is shaped in logical order, one stretch of same font glyphs at a time, then reversed if it is right to left.
+func layoutLine(fc *FontCache, primary *truetype.Font, size float64, p *bidiParagraph, start, end int) glyphRun {
+	var run glyphRun
+	if primary == nil {
+		return run
+	}
+	order, levels := p.visualOrder(start, end)
+
+	for k := 0; k < len(order); {
+		// Visual run of one level, which is a contiguous logical range
+		rtl := levels[k]&1 == 1
+		step := 1
+		if rtl {
+			step = -1
+		}
+		e := k + 1
+		for e < len(order) && levels[e] == levels[k] && order[e] == order[e-1]+step {
+			e++
+		}
+		first, last := order[k], order[e-1]
+		if rtl {
+			first, last = last, first
+		}
+		k = e
+
+		glyphs := make([]layoutGlyph, 0, last-first+1)
+		for i := first; i <= last; i++ {
+			if p.isBidiControl(i) {
+				continue
+			}
+			r := p.runes[i]
+			if rtl {
+				r = mirrorRune(r)
+			}
+			f, index := fc.GlyphFont(primary, r)
+			// Joiners and variation selectors stay with the font of the glyph before, so emoji sequences can form ligatures
+			if n := len(glyphs); n > 0 && isJoiner(r) && glyphs[n-1].font != f {
+				if prev := glyphs[n-1].font; prev.Index(r) != 0 {
+					f, index = prev, prev.Index(r)
+				}
+			}
+			glyphs = append(glyphs, layoutGlyph{font: f, index: index, r: p.runes[i], cluster: p.offsets[i], color: fc.rawFont(f).colors()})
+		}
+
+		offset := len(run.glyphs)
+		// Shape each stretch of one font and script
+		for a := 0; a < len(glyphs); {
+			script := scriptTag(glyphs[a].r)
+			b := a + 1
+			for ; b < len(glyphs) && glyphs[b].font == glyphs[a].font; b++ {
+				if s := scriptTag(glyphs[b].r); s != "" && s != script {
+					if script != "" {
+						break
+					}
+					script = s // Leading spaces and punctuation go with the script after them
+				}
+			}
+			shaped := shapeText(fc, glyphs[a:b:b], script, size, len(run.glyphs)-offset, rtl)
+			run.glyphs = append(run.glyphs, shaped...)
+			a = b
+		}
+		if rtl {
+			shaped := run.glyphs[offset:]
+			n := len(shaped)
+			for a, b := 0, n-1; a < b; a, b = a+1, b-1 {
+				shaped[a], shaped[b] = shaped[b], shaped[a]
+			}
+			for i := range shaped {
+				if shaped[i].attached {
+					shaped[i].base = n - 1 - shaped[i].base
+				}
+			}
+		}
+		for i := offset; i < len(run.glyphs); i++ {
+			run.glyphs[i].base += offset
+		}
+	}
+
+	// Resolve pen positions.  Attached marks are placed relative to their base afterwards, as in right to left runs the base comes later
+	pen := 0.0
+	for i := range run.glyphs {
+		g := &run.glyphs[i]
+		if !g.attached {
+			g.x, g.y = pen+g.dx, g.dy
+		}
+		pen += g.advance
+	}
+	for i := range run.glyphs {
+		run.placeMark(i, 0)
+	}
+	run.advance = pen
+	return run
+}
+
+// placeMark positions an attached mark from its base, placing the base first if it is also a mark.
+func (run glyphRun) placeMark(i, depth int) {
+	g := &run.glyphs[i]
+	if !g.attached || depth > len(run.glyphs) {
+		return
+	}
+	run.placeMark(g.base, depth+1)
+	b := run.glyphs[g.base]
+	g.x, g.y = b.x+g.dx, b.y+g.dy
+}
+
+// shapeText substitutes and positions glyphs that all come from the same font, in logical order.
+// script is the OpenType script tag the font's features are picked for.
+// offset is the index the first glyph has within its directional run, so attached marks can refer to their base.
+// For right to left text, kerning is moved onto the following glyph, as the glyphs will be reversed and the pen then moves left to right over them.
+func shapeText(fc *FontCache, glyphs []layoutGlyph, script string, size float64, offset int, rtl bool) []layoutGlyph {
+	f := glyphs[0].font
+	scale := fixed.Int26_6(size * 64)
+	ot := fc.shaping(f)
+	if ot != nil {
+		glyphs = ot.substitute(glyphs, script)
+	}
+	nominal := make([]float64, len(glyphs))
+	for i := range glyphs {
+		nominal[i] = fixedToFloat64(f.HMetric(scale, glyphs[i].index).AdvanceWidth)
+		glyphs[i].advance = nominal[i]
+	}
+	if ot != nil {
+		ot.position(glyphs, script, size/float64(f.FUnitsPerEm()))
+	}
+	if ot == nil || !ot.features(script).kern {
+		for i := 1; i < len(glyphs); i++ {
+			glyphs[i-1].advance += fixedToFloat64(f.Kern(scale, glyphs[i-1].index, glyphs[i].index))
+		}
+	}
+	if rtl {
+		for i := len(glyphs) - 2; i >= 0; i-- {
+			if glyphs[i].attached || glyphs[i+1].attached {
+				continue
+			}
+			kern := glyphs[i].advance - nominal[i]
+			glyphs[i].advance -= kern
+			glyphs[i+1].advance += kern
+		}
+	}
+	for i := range glyphs {
+		if glyphs[i].attached {
+			glyphs[i].base += offset
+		}
+	}
+	return glyphs
+}
+
+// appendPath adds the outlines of the run to path with the run's baseline starting at x, y.
+// Used when text has to go through the vector path (e.g. rotated or scaled), rather than the glyph atlas.
+func (run glyphRun) appendPath(path *draw2d.Path, size float64, x, y float64) error {
+	for _, g := range run.glyphs {
+		if g.bitmap != nil {
+			g.bitmap.appendPath(path, x+g.x, y+g.y)
+			continue
+		}
+		if g.color.bitmap(g.index, size) != nil {
+			continue // Colour bitmaps have no outline
+		}
+		if err := GlyphPath(path, g.font, size, g.index, x+g.x, y+g.y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isJoiner reports whether r only modifies the characters around it: zero width (non) joiners, variation selectors and emoji skin tones.
+func isJoiner(r rune) bool {
+	return r == 0x200c || r == 0x200d || (r >= 0xfe00 && r <= 0xfe0f) || (r >= 0x1f3fb && r <= 0x1f3ff) || (r >= 0xe0100 && r <= 0xe01ef)
+}
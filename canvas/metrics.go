@@ -0,0 +1,170 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"math"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontMetrics are the font wide metrics at a given size.  All values are in pixels, and positive.
+type FontMetrics struct {
+	Size       float64 // Pixels per em
+	Ascent     float64 // Distance from the baseline to the top of the line
+	Descent    float64 // Distance from the baseline to the bottom of the line
+	LineGap    float64 // Extra spacing the font asks for between lines
+	LineHeight float64 // Baseline to baseline distance.  Ascent + Descent + LineGap
+	XHeight    float64 // Height of lower case letters such as 'x'
+	CapHeight  float64 // Height of flat capital letters such as 'H'
+	UnitsPerEm int     // Design units per em of the font
+}
+
+// TextBounds is a box relative to the text origin on the baseline, with Y going downwards (so Top is usually negative).
+type TextBounds struct {
+	Left, Top, Right, Bottom float64
+}
+
+// Empty reports whether the bounds contain no ink, e.g. for a string of spaces.
+func (b TextBounds) Empty() bool {
+	return b.Left >= b.Right || b.Top >= b.Bottom
+}
+
+// GlyphPosition is the placement of a single glyph within a measured string.
+// Usually there is one glyph per rune, but shaping may merge several runes into a ligature, or split one rune into several glyphs.
+type GlyphPosition struct {
+	Rune    rune       // First rune the glyph was made from
+	Offset  int        // Byte offset of Rune in the string
+	X, Y    float64    // Glyph origin relative to the text origin, after kerning and mark positioning
+	Advance float64    // Pen advance of the glyph, including kerning with the next glyph
+	Ink     TextBounds // Ink bounds of this glyph, relative to the text origin
+}
+
+// TextExtents is the measurement of a single line of text.
+type TextExtents struct {
+	Advance float64    // Total pen advance, which is where the next piece of text would start
+	Ink     TextBounds // Union of the ink bounds of every glyph
+	Glyphs  []GlyphPosition
+}
+
+// Metrics returns the font wide metrics for tf at size pixels per em.
+// Line gap, x-height and cap height come from the hhea and OS/2 tables when tf was added with StoreData,
+// otherwise they are derived from the outlines of 'x' and 'H'.
+func (f *FontCache) Metrics(tf *truetype.Font, size float64) FontMetrics {
+	m := FontMetrics{Size: size}
+	if tf == nil {
+		return m
+	}
+	upem := float64(tf.FUnitsPerEm())
+	m.UnitsPerEm = int(upem)
+	scale := size / upem
+
+	raw := f.rawFont(tf)
+	hhea, os2 := raw.table("hhea"), raw.table("OS/2")
+	if len(hhea) >= 10 {
+		m.Ascent = float64(si16(hhea, 4)) * scale
+		m.Descent = -float64(si16(hhea, 6)) * scale
+		m.LineGap = float64(si16(hhea, 8)) * scale
+	} else {
+		fm := truetype.NewFace(tf, &truetype.Options{Size: size, DPI: 72}).Metrics()
+		m.Ascent = fixedToFloat64(fm.Ascent)
+		m.Descent = fixedToFloat64(fm.Descent)
+	}
+	// USE_TYPO_METRICS asks for the OS/2 typographic values to be used instead of hhea
+	if len(os2) >= 78 && su16(os2, 62)&(1<<7) != 0 {
+		m.Ascent = float64(si16(os2, 68)) * scale
+		m.Descent = -float64(si16(os2, 70)) * scale
+		m.LineGap = float64(si16(os2, 72)) * scale
+	}
+	m.LineHeight = m.Ascent + m.Descent + m.LineGap
+
+	// x-height and cap height were added in OS/2 version 2
+	if len(os2) >= 90 && su16(os2, 0) >= 2 {
+		m.XHeight = float64(si16(os2, 86)) * scale
+		m.CapHeight = float64(si16(os2, 88)) * scale
+	}
+	if m.XHeight == 0 {
+		m.XHeight = -glyphInk(tf, size, tf.Index('x')).Top
+	}
+	if m.CapHeight == 0 {
+		m.CapHeight = -glyphInk(tf, size, tf.Index('H')).Top
+	}
+	return m
+}
+
+// Measure lays out s in tf at size pixels per em, using the fallback chain for missing runes, exactly as the text drawing functions do.
+// Mixed left to right and right to left text is reordered, with the base direction taken from the first strong character.
+func (f *FontCache) Measure(tf *truetype.Font, size float64, s string) TextExtents {
+	return layoutText(f, tf, size, s, DirectionAuto).extents(size)
+}
+
+// extents measures an already laid out run.
+func (run glyphRun) extents(size float64) TextExtents {
+	te := TextExtents{
+		Advance: run.advance,
+		Glyphs:  make([]GlyphPosition, len(run.glyphs)),
+	}
+	first := true
+	for i, g := range run.glyphs {
+		var ink TextBounds
+		if g.bitmap != nil {
+			ink = g.bitmap.ink()
+		} else if b := g.color.bitmap(g.index, size); b != nil {
+			ink = b.ink(size)
+		} else {
+			ink = glyphInk(g.font, size, g.index)
+		}
+		if !ink.Empty() {
+			ink.Left += g.x
+			ink.Right += g.x
+			ink.Top += g.y
+			ink.Bottom += g.y
+			if first {
+				te.Ink, first = ink, false
+			} else {
+				te.Ink = TextBounds{
+					Left:   math.Min(te.Ink.Left, ink.Left),
+					Top:    math.Min(te.Ink.Top, ink.Top),
+					Right:  math.Max(te.Ink.Right, ink.Right),
+					Bottom: math.Max(te.Ink.Bottom, ink.Bottom),
+				}
+			}
+		}
+		te.Glyphs[i] = GlyphPosition{
+			Rune:    g.r,
+			Offset:  g.cluster,
+			X:       g.x,
+			Y:       g.y,
+			Advance: g.advance,
+			Ink:     ink,
+		}
+	}
+	return te
+}
+
+// glyphInk returns the outline bounds of a glyph drawn at the origin, with Y going downwards.
+func glyphInk(tf *truetype.Font, size float64, index truetype.Index) TextBounds {
+	var buf truetype.GlyphBuf
+	if err := loadGlyph(&buf, tf, fixed.Int26_6(size*64), index); err != nil || len(buf.Points) == 0 {
+		return TextBounds{}
+	}
+	return TextBounds{
+		Left:   fixedToFloat64(buf.Bounds.Min.X),
+		Top:    fixedToFloat64(-buf.Bounds.Max.Y),
+		Right:  fixedToFloat64(buf.Bounds.Max.X),
+		Bottom: fixedToFloat64(-buf.Bounds.Min.Y),
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextPath returns the outlines of s as a vector path, with the baseline starting at x, y, in tf at size pixels per em.
+// The text is laid out exactly as the drawing functions do, with fallback fonts, shaping and bidi reordering.
+// Glyph contours are kept as the font's quadratic curves, so the path can be filled, stroked, used as a clip or exported at any scale.
+func (f *FontCache) TextPath(tf *truetype.Font, size float64, s string, x, y float64) (*draw2d.Path, error) {
+	path := new(draw2d.Path)
+	if tf == nil {
+		return path, nil
+	}
+	err := layoutText(f, tf, size, s, DirectionAuto).appendPath(path, size, x, y)
+	return path, err
+}
+
+// GlyphPath appends the outline of a single glyph of tf to path, with its origin at x, y.
+// Use it with truetype.Font.Index for glyphs that aren't reachable through a string.
+func GlyphPath(path draw2d.PathBuilder, tf *truetype.Font, size float64, index truetype.Index, x, y float64) error {
+	var buf truetype.GlyphBuf
+	if err := loadGlyph(&buf, tf, fixed.Int26_6(size*64), index); err != nil {
+		return err
+	}
+	e0 := 0
+	for _, e1 := range buf.Ends {
+		draw2dimg.DrawContour(path, buf.Points[e0:e1], x, y)
+		e0 = e1
+	}
+	return nil
+}
+
+// loadGlyph loads an unhinted glyph outline into buf.  Fonts without glyf outlines, such as bitmap emoji fonts,
+// can make truetype panic rather than return an error, so that is turned into an error here.
+func loadGlyph(buf *truetype.GlyphBuf, tf *truetype.Font, scale fixed.Int26_6, index truetype.Index) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errBadSFNT
+		}
+	}()
+	return buf.Load(tf, scale, index, font.HintingNone)
+}
@@ -0,0 +1,273 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/golang/freetype/raster"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+)
+
+// painter is the draw2dimg.Painter behind the canvas graphic context.  It does what raster.RGBAPainter does for solid colours,
+// and also paints Paint sources (gradients, patterns) a row at a time.
+//
+// Plain source-over drawing goes straight onto the image.  Anything else (other composite operations, global alpha on text)
+// is drawn source-over into a transparent layer first, and the layer is then composited onto the image in one go,
+// which is how canvas defines it.
+type painter struct {
+	img   *image.RGBA
+	gc    *draw2dimg.GraphicContext // For the transform to map paints with; set once the context exists
+	solid [4]uint32                 // 16 bit premultiplied solid colour
+	paint Paint                     // Non nil when painting a Paint rather than a solid colour
+	row   []color.RGBA              // Scratch row for paint colours
+
+	paintState
+	stack []paintState
+
+	layer     *image.RGBA     // Scratch layer for drawing that can't go straight onto img
+	dirty     image.Rectangle // Part of the layer drawn on
+	group     int             // Depth of begin calls; the layer is composited by the outermost end
+	layered   bool            // Spans are going into the layer
+	shadowBuf []float32       // Scratch for blurring shadows
+}
+
+// paintState is the canvas drawing state that draw2d doesn't know about, saved and restored with it.
+type paintState struct {
+	op      CompositeOp
+	alpha   float64
+	shadow  Shadow
+	clip    *clipMask // Coverage allowed to be drawn on, or nil for everywhere; never changed once made, so states can share it
+	quality ImageQuality
+}
+
+// newGraphicContext returns a graphic context drawing onto img through a painter, so it accepts Paint fill and stroke colours.
+func newGraphicContext(img *image.RGBA) (*draw2dimg.GraphicContext, *painter) {
+	p := &painter{img: img, paintState: paintState{alpha: 1}}
+	gc := draw2dimg.NewGraphicContextWithPainter(img, p)
+	p.gc = gc
+	return gc, p
+}
+
+// save pushes the painter state.
+func (p *painter) save() {
+	p.stack = append(p.stack, p.paintState)
+}
+
+// restore pops the painter state, if there is one saved.
+func (p *painter) restore() {
+	if n := len(p.stack); n > 0 {
+		p.paintState = p.stack[n-1]
+		p.stack = p.stack[:n-1]
+	}
+}
+
+// direct reports whether drawing can go straight onto the image.
+func (p *painter) direct() bool {
+	return p.op == OpSourceOver && !p.shadow.visible() && p.clip == nil
+}
+
+// begin starts drawing that is composited as a whole, such as a line of text, and returns the image to draw it on.
+// Spans painted before the matching end go there too.
+func (p *painter) begin() *image.RGBA {
+	p.group++
+	if p.group == 1 {
+		p.layered = !p.direct() || p.alpha < 1
+	}
+	if !p.layered {
+		return p.img
+	}
+	p.dirty = p.img.Bounds() // Whatever is drawn on the returned image isn't tracked
+	return p.target()
+}
+
+// bound tells the outermost group it only draws within r, so flush needn't search the whole layer for what was drawn.
+func (p *painter) bound(r image.Rectangle) {
+	if p.layered && p.group == 1 {
+		p.dirty = r.Intersect(p.img.Rect)
+	}
+}
+
+// end finishes drawing started with begin.
+func (p *painter) end() {
+	if p.group--; p.group == 0 && p.layered {
+		p.flush()
+		p.layered = false
+	}
+}
+
+// target returns the layer, making it if the image size changed.  flush leaves it clear.
+func (p *painter) target() *image.RGBA {
+	if p.layer == nil || p.layer.Rect != p.img.Rect {
+		p.layer = image.NewRGBA(p.img.Rect)
+	}
+	return p.layer
+}
+
+// SetColor sets the colour, or Paint, for the spans that follow.
+func (p *painter) SetColor(c color.Color) {
+	if pt, ok := c.(Paint); ok {
+		p.paint = pt
+		return
+	}
+	p.paint = nil
+	r, g, b, a := c.RGBA()
+	p.solid = [4]uint32{r, g, b, a}
+}
+
+// inverse returns the matrix from canvas pixels back to the graphic context's current space.
+func (p *painter) inverse() draw2d.Matrix {
+	tr := draw2d.NewIdentityMatrix()
+	if p.gc != nil {
+		tr = p.gc.Current.Tr.Copy()
+	}
+	if tr.Determinant() != 0 {
+		tr.Inverse()
+	}
+	return tr
+}
+
+// Paint blends the spans over the image, or into the layer, and composites the layer when a path is done.
+func (p *painter) Paint(ss []raster.Span, done bool) {
+	dst, alpha := p.img, p.alpha
+	if p.group == 0 {
+		p.layered = !p.direct()
+	}
+	if p.layered {
+		dst, alpha = p.target(), 1
+	}
+	var inv draw2d.Matrix
+	if p.paint != nil {
+		inv = p.inverse()
+	}
+	b := dst.Bounds()
+	for _, s := range ss {
+		if s.Y < b.Min.Y {
+			continue
+		}
+		if s.Y >= b.Max.Y {
+			break
+		}
+		if s.X0 < b.Min.X {
+			s.X0 = b.Min.X
+		}
+		if s.X1 > b.Max.X {
+			s.X1 = b.Max.X
+		}
+		if s.X0 >= s.X1 {
+			continue
+		}
+		if p.layered {
+			p.dirty = p.dirty.Union(image.Rect(s.X0, s.Y, s.X1, s.Y+1))
+		}
+		ma := uint32(float64(s.Alpha) * alpha)
+		i0 := dst.PixOffset(s.X0, s.Y)
+		pix := dst.Pix[i0 : i0+(s.X1-s.X0)*4]
+		if p.paint == nil {
+			blendSpan(pix, p.solid, ma)
+			continue
+		}
+		if n := s.X1 - s.X0; cap(p.row) < n {
+			p.row = make([]color.RGBA, n)
+		}
+		row := p.row[:s.X1-s.X0]
+		p.paint.Shade(row, s.X0, s.Y, inv)
+		for i, c := range row {
+			if c.A == 0 {
+				continue
+			}
+			blendSpan(pix[4*i:4*i+4], [4]uint32{uint32(c.R) * 0x101, uint32(c.G) * 0x101, uint32(c.B) * 0x101, uint32(c.A) * 0x101}, ma)
+		}
+	}
+	if done && p.group == 0 && p.layered {
+		p.flush()
+		p.layered = false
+	}
+}
+
+// flush composites the layer onto the image with the current operation and global alpha, and clears it for next time.
+func (p *painter) flush() {
+	src, dst := p.target(), p.img
+	r := inkBounds(src, p.dirty.Intersect(dst.Rect))
+	p.dirty = image.Rectangle{}
+	if p.shadow.visible() {
+		p.drawShadow(r)
+	}
+	if p.op.unbounded() {
+		r = r.Union(p.clipBounds()) // These change the image where nothing was drawn too
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		si, di := src.PixOffset(r.Min.X, y), dst.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x, si, di = x+1, si+4, di+4 {
+			sp := src.Pix[si : si+4 : si+4]
+			if sp[3] == 0 && !p.op.unbounded() {
+				continue
+			}
+			a := p.alpha / 255
+			p.put(dst.Pix[di:di+4:di+4], [4]float64{float64(sp[0]) * a, float64(sp[1]) * a, float64(sp[2]) * a, float64(sp[3]) * a}, x, y)
+			sp[0], sp[1], sp[2], sp[3] = 0, 0, 0, 0
+		}
+	}
+}
+
+// put composites a premultiplied source colour, 0 to 1, onto the image pixel dp at x, y, within the clip.
+func (p *painter) put(dp []uint8, s [4]float64, x, y int) {
+	k := 1.0
+	if p.clip != nil {
+		if k = float64(p.clip.mask.AlphaAt(x, y).A) / 255; k == 0 {
+			return
+		}
+	}
+	d := [4]float64{float64(dp[0]) / 255, float64(dp[1]) / 255, float64(dp[2]) / 255, float64(dp[3]) / 255}
+	o := composite(p.op, s, d)
+	for i := range o {
+		dp[i] = uint8(clamp01(d[i]+(o[i]-d[i])*k)*255 + 0.5)
+	}
+}
+
+// inkBounds returns the smallest rectangle within r holding all the pixels of m that aren't transparent.
+func inkBounds(m *image.RGBA, r image.Rectangle) image.Rectangle {
+	ink := image.Rectangle{}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := m.Pix[m.PixOffset(r.Min.X, y):m.PixOffset(r.Max.X, y)]
+		x0, x1 := -1, -1
+		for i := 3; i < len(row); i += 4 {
+			if row[i] != 0 {
+				if x0 < 0 {
+					x0 = i / 4
+				}
+				x1 = i / 4
+			}
+		}
+		if x0 >= 0 {
+			ink = ink.Union(image.Rect(r.Min.X+x0, y, r.Min.X+x1+1, y+1))
+		}
+	}
+	return ink
+}
+
+// blendSpan draws a 16 bit premultiplied colour over pix with coverage ma, as raster.RGBAPainter does.
+func blendSpan(pix []uint8, c [4]uint32, ma uint32) {
+	const m = 1<<16 - 1
+	a := (m - (c[3] * ma / m)) * 0x101
+	for i := 0; i < len(pix); i += 4 {
+		pix[i+0] = uint8((uint32(pix[i+0])*a + c[0]*ma) / m >> 8)
+		pix[i+1] = uint8((uint32(pix[i+1])*a + c[1]*ma) / m >> 8)
+		pix[i+2] = uint8((uint32(pix[i+2])*a + c[2]*ma) / m >> 8)
+		pix[i+3] = uint8((uint32(pix[i+3])*a + c[3]*ma) / m >> 8)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// TextAlign is the horizontal alignment of each line of a paragraph.
+type TextAlign int
+
+const (
+	AlignStart TextAlign = iota // Left for left to right paragraphs, right for right to left ones
+	AlignEnd                    // Right for left to right paragraphs, left for right to left ones
+	AlignLeft
+	AlignRight
+	AlignCenter
+)
+
+// ParagraphOptions control how text is wrapped and aligned by LayoutParagraph.
+type ParagraphOptions struct {
+	Width      float64 // Wrap lines longer than this many pixels, at spaces.  0 only breaks at newlines
+	Align      TextAlign
+	Direction  TextDirection // Base direction of each paragraph.  Auto takes it from the first strong character of each one
+	LineHeight float64       // Baseline to baseline distance in pixels.  0 uses the font's line height
+}
+
+// TextLine is a single laid out line of a paragraph.
+type TextLine struct {
+	Start, End int     // Byte range of the line in the text, including any trailing space it was broken at
+	X, Y       float64 // Left end of the line's baseline, relative to the baseline of the first line
+	RTL        bool    // Whether the paragraph containing the line is right to left
+	Extents    TextExtents
+
+	run  glyphRun
+	size float64
+}
+
+// LayoutParagraph wraps text into lines no wider than opts.Width and aligns them.
+// Newlines start a new paragraph, each with its own base direction when opts.Direction is DirectionAuto.
+// Within a line, text is reordered with the bidirectional algorithm.  Words wider than a whole line are left to overflow.
+func (f *FontCache) LayoutParagraph(tf *truetype.Font, size float64, text string, opts ParagraphOptions) []TextLine {
+	lineHeight := opts.LineHeight
+	if lineHeight <= 0 {
+		lineHeight = f.Metrics(tf, size).LineHeight
+	}
+	return layoutParagraph(text, opts, lineHeight, size, func(p *bidiParagraph, start, end int) glyphRun {
+		return layoutLine(f, tf, size, p, start, end)
+	})
+}
+
+// layoutParagraph does the wrapping and alignment for any font, with line laying out part of a paragraph as one line.
+func layoutParagraph(text string, opts ParagraphOptions, lineHeight, size float64, line func(p *bidiParagraph, start, end int) glyphRun) []TextLine {
+	var lines []TextLine
+	offset := 0
+	for _, para := range strings.Split(text, "\n") {
+		p := resolveBidi(para, opts.Direction)
+		for _, br := range breakLines(p, opts.Width, line) {
+			run := line(p, br[0], br[1])
+			l := TextLine{
+				Start:   offset + runeOffset(p, br[0], len(para)),
+				End:     offset + runeOffset(p, br[2], len(para)),
+				Y:       float64(len(lines)) * lineHeight,
+				RTL:     p.base == 1,
+				Extents: run.extents(size),
+				run:     run,
+				size:    size,
+			}
+			l.X = alignLine(opts.Align, l.RTL, opts.Width, run.advance)
+			lines = append(lines, l)
+		}
+		offset += len(para) + 1
+	}
+	return lines
+}
+
+// DrawParagraph draws lines from LayoutParagraph with the baseline of the first line starting at x, y.
+func (a *GlyphAtlas) DrawParagraph(dst draw.Image, lines []TextLine, x, y float64, c color.Color) {
+	for _, l := range lines {
+		a.drawRun(dst, l.run, l.size, x+l.X, y+l.Y, c)
+	}
+}
+
+// breakLines greedily splits the runes of a paragraph into lines at spaces.
+// Each line is {start, end of the visible text, end including trailing spaces}, as rune indexes.
+func breakLines(p *bidiParagraph, width float64, line func(p *bidiParagraph, start, end int) glyphRun) [][3]int {
+	n := len(p.runes)
+	if width <= 0 || n == 0 {
+		return [][3]int{{0, trimSpace(p, 0, n), n}}
+	}
+
+	var lines [][3]int
+	start, lineWidth := 0, 0.0
+	for i := 0; i < n; {
+		// Next word, and the spaces after it
+		wordEnd := i
+		for wordEnd < n && !unicode.IsSpace(p.runes[wordEnd]) {
+			wordEnd++
+		}
+		spaceEnd := wordEnd
+		for spaceEnd < n && unicode.IsSpace(p.runes[spaceEnd]) {
+			spaceEnd++
+		}
+		wordWidth := line(p, i, wordEnd).advance
+		spaceWidth := line(p, wordEnd, spaceEnd).advance
+
+		if i > start && lineWidth+wordWidth > width {
+			lines = append(lines, [3]int{start, trimSpace(p, start, i), i})
+			start, lineWidth = i, 0
+		}
+		lineWidth += wordWidth + spaceWidth
+		i = spaceEnd
+	}
+	return append(lines, [3]int{start, trimSpace(p, start, n), n})
+}
+
+// trimSpace returns the end of runes [start, end) without trailing spaces.
+func trimSpace(p *bidiParagraph, start, end int) int {
+	for end > start && unicode.IsSpace(p.runes[end-1]) {
+		end--
+	}
+	return end
+}
+
+// runeOffset converts a rune index of p to a byte offset, where n is the byte length of the paragraph.
+func runeOffset(p *bidiParagraph, i, n int) int {
+	if i >= len(p.offsets) {
+		return n
+	}
+	return p.offsets[i]
+}
+
+// alignLine returns the x of a line of the given advance.  With no width, lines are aligned around x = 0.
+func alignLine(align TextAlign, rtl bool, width, advance float64) float64 {
+	switch align {
+	case AlignStart:
+		if rtl {
+			align = AlignRight
+		} else {
+			align = AlignLeft
+		}
+	case AlignEnd:
+		if rtl {
+			align = AlignLeft
+		} else {
+			align = AlignRight
+		}
+	}
+	switch align {
+	case AlignRight:
+		return width - advance
+	case AlignCenter:
+		return (width - advance) / 2
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/llgcode/draw2d"
+)
+
+// PatternRepeat says which directions a pattern's image tiles in, as for canvas createPattern.
+type PatternRepeat int
+
+const (
+	Repeat   PatternRepeat = iota // Tile in both directions
+	RepeatX                       // Tile across only
+	RepeatY                       // Tile down only
+	NoRepeat                      // Draw the image once, with nothing around it
+)
+
+// Pattern is a Paint that tiles an image, for textured fills and strokes.
+// The image is copied when the pattern is made, so later changes to it don't show.
+type Pattern struct {
+	src     *image.RGBA
+	repeat  PatternRepeat
+	tr      draw2d.Matrix // Pattern space to the graphic context's space
+	inv     draw2d.Matrix
+	quality ImageQuality
+}
+
+// NewPattern returns a pattern of img, with its top left corner at the origin.
+func NewPattern(img image.Image, repeat PatternRepeat) *Pattern {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	return &Pattern{src: src, repeat: repeat, tr: draw2d.NewIdentityMatrix(), inv: draw2d.NewIdentityMatrix()}
+}
+
+// SetTransform places the pattern with an affine transform, on top of the graphic context's own, like canvas pattern.setTransform.
+func (p *Pattern) SetTransform(tr draw2d.Matrix) *Pattern {
+	p.tr, p.inv = tr, tr.Copy()
+	if p.inv.Determinant() != 0 {
+		p.inv.Inverse()
+	}
+	return p
+}
+
+// Transform returns the pattern's transform.
+func (p *Pattern) Transform() draw2d.Matrix {
+	return p.tr
+}
+
+// SetQuality picks how the pattern's image is sampled when it is scaled or turned.
+func (p *Pattern) SetQuality(q ImageQuality) *Pattern {
+	p.quality = q
+	return p
+}
+
+// RGBA gives the colour at the centre of the pattern's image.
+func (p *Pattern) RGBA() (r, g, b, a uint32) {
+	s := p.src.Bounds().Size()
+	if s.X == 0 || s.Y == 0 {
+		return 0, 0, 0, 0
+	}
+	return p.src.RGBAAt(s.X/2, s.Y/2).RGBA()
+}
+
+// Shade fills dst with the pattern's colours along a row of pixels.
+func (p *Pattern) Shade(dst []color.RGBA, x, y int, inv draw2d.Matrix) {
+	m := p.inv.Copy()
+	m.Compose(inv)
+	px, py := m.TransformPoint(float64(x)+0.5, float64(y)+0.5)
+	dx, dy := m[0], m[1]
+	for i := range dst {
+		u, v := px+float64(i)*dx, py+float64(i)*dy
+		switch p.quality {
+		case QualityNearest:
+			dst[i] = p.at(int(math.Floor(u)), int(math.Floor(v)))
+		case QualityCatmullRom:
+			dst[i] = p.bicubic(u-0.5, v-0.5)
+		default:
+			dst[i] = p.bilinear(u-0.5, v-0.5)
+		}
+	}
+}
+
+// at returns the texel at x, y, wrapped in the tiling directions and transparent outside the image in the others.
+func (p *Pattern) at(x, y int) color.RGBA {
+	w, h := p.src.Rect.Dx(), p.src.Rect.Dy()
+	if w == 0 || h == 0 {
+		return color.RGBA{}
+	}
+	if p.repeat == Repeat || p.repeat == RepeatX {
+		x = wrap(x, w)
+	} else if x < 0 || x >= w {
+		return color.RGBA{}
+	}
+	if p.repeat == Repeat || p.repeat == RepeatY {
+		y = wrap(y, h)
+	} else if y < 0 || y >= h {
+		return color.RGBA{}
+	}
+	i := y*p.src.Stride + 4*x
+	s := p.src.Pix[i : i+4 : i+4]
+	return color.RGBA{s[0], s[1], s[2], s[3]}
+}
+
+// bilinear blends the four texels around x, y, in texel space.
+func (p *Pattern) bilinear(x, y float64) color.RGBA {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	c00, c10 := p.at(ix, iy), p.at(ix+1, iy)
+	c01, c11 := p.at(ix, iy+1), p.at(ix+1, iy+1)
+	mix := func(a, b, c, d uint8) uint8 {
+		top := float64(a) + (float64(b)-float64(a))*fx
+		bot := float64(c) + (float64(d)-float64(c))*fx
+		return uint8(top + (bot-top)*fy + 0.5)
+	}
+	return color.RGBA{
+		mix(c00.R, c10.R, c01.R, c11.R),
+		mix(c00.G, c10.G, c01.G, c11.G),
+		mix(c00.B, c10.B, c01.B, c11.B),
+		mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
+
+// bicubic blends the sixteen texels around x, y with Catmull-Rom weights, which keeps edges sharper than bilinear.
+func (p *Pattern) bicubic(x, y float64) color.RGBA {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	wx, wy := catmullRom(x-x0), catmullRom(y-y0)
+	ix, iy := int(x0)-1, int(y0)-1
+	var sum [4]float64
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			c := p.at(ix+i, iy+j)
+			w := wx[i] * wy[j]
+			sum[0] += float64(c.R) * w
+			sum[1] += float64(c.G) * w
+			sum[2] += float64(c.B) * w
+			sum[3] += float64(c.A) * w
+		}
+	}
+	// The negative lobes can overshoot; keep the colour premultiplied
+	a := math.Max(0, math.Min(255, sum[3]))
+	ch := func(v float64) uint8 {
+		return uint8(math.Max(0, math.Min(a, v)) + 0.5)
+	}
+	return color.RGBA{ch(sum[0]), ch(sum[1]), ch(sum[2]), uint8(a + 0.5)}
+}
+
+// catmullRom returns the weights of the four texels around a point t of the way between the middle two.
+func catmullRom(t float64) [4]float64 {
+	t2, t3 := t*t, t*t*t
+	return [4]float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
+
+// wrap returns i modulo n, for n > 0, as a positive number.
+func wrap(i, n int) int {
+	i %= n
+	if i < 0 {
+		i += n
+	}
+	return i
+}
@@ -0,0 +1,260 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/markfarnan/go-canvas/filter"
+)
+
+// Built in PostPass effects
+
+// Vignette darkens the frame towards its corners.
+type Vignette struct {
+	Strength float64     // How dark the corners get, 0 to 1
+	Radius   float64     // Fraction of the half diagonal, from the centre, left untouched
+	Color    color.Color // What the edges fade to; nil is black
+}
+
+func (v Vignette) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	var vr, vg, vb float64
+	if v.Color != nil {
+		cr, cg, cb, _ := v.Color.RGBA()
+		vr, vg, vb = float64(cr)/0x101, float64(cg)/0x101, float64(cb)/0x101
+	}
+	cx, cy := float64(r.Min.X+r.Max.X)/2, float64(r.Min.Y+r.Max.Y)/2
+	diag := math.Hypot(float64(r.Dx()), float64(r.Dy())) / 2
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		s, d := src.Pix[src.PixOffset(r.Min.X, y):], dst.Pix[dst.PixOffset(r.Min.X, y):]
+		for x, i := r.Min.X, 0; x < r.Max.X; x, i = x+1, i+4 {
+			t := (math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)/diag - v.Radius) / math.Max(1-v.Radius, 1e-6)
+			k := v.Strength * smoothstep(clamp01(t))
+			a := float64(s[i+3]) / 255
+			d[i] = uint8(float64(s[i])*(1-k) + vr*a*k + 0.5)
+			d[i+1] = uint8(float64(s[i+1])*(1-k) + vg*a*k + 0.5)
+			d[i+2] = uint8(float64(s[i+2])*(1-k) + vb*a*k + 0.5)
+			d[i+3] = s[i+3]
+		}
+	}
+}
+
+// CRT imitates an old monitor: a bulging screen, dark scanlines and colour fringes.
+type CRT struct {
+	Curvature  float64 // Barrel distortion; 0.1 is gentle
+	Scanlines  float64 // How dark the gaps between lines are, 0 to 1
+	Period     int     // Scanline spacing in pixels; 0 means 3
+	Aberration float64 // Red and blue offset, in pixels
+}
+
+func (c CRT) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	period := c.Period
+	if period <= 0 {
+		period = 3
+	}
+	w, h := float64(r.Dx()), float64(r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		line := 1 - c.Scanlines*(0.5+0.5*math.Cos(2*math.Pi*float64(y-r.Min.Y)/float64(period)))
+		d := dst.Pix[dst.PixOffset(r.Min.X, y):]
+		for x, i := r.Min.X, 0; x < r.Max.X; x, i = x+1, i+4 {
+			// Position from -1 to 1, pushed outwards further from the centre
+			u := (float64(x-r.Min.X)+0.5)/w*2 - 1
+			v := (float64(y-r.Min.Y)+0.5)/h*2 - 1
+			k := 1 + c.Curvature*(u*u+v*v)
+			sx := float64(r.Min.X) + (u*k+1)/2*w
+			sy := float64(r.Min.Y) + (v*k+1)/2*h
+			red, rok := sampleNearest(src, r, sx+c.Aberration, sy)
+			mid, ok := sampleNearest(src, r, sx, sy)
+			blue, bok := sampleNearest(src, r, sx-c.Aberration, sy)
+			if !ok {
+				d[i], d[i+1], d[i+2], d[i+3] = 0, 0, 0, 0xff
+				continue
+			}
+			if !rok {
+				red = mid
+			}
+			if !bok {
+				blue = mid
+			}
+			d[i] = uint8(float64(red[0])*line + 0.5)
+			d[i+1] = uint8(float64(mid[1])*line + 0.5)
+			d[i+2] = uint8(float64(blue[2])*line + 0.5)
+			d[i+3] = mid[3]
+		}
+	}
+}
+
+// sampleNearest returns the pixel of m at x, y, if it falls within r.
+func sampleNearest(m *image.RGBA, r image.Rectangle, x, y float64) ([]uint8, bool) {
+	ix, iy := int(math.Floor(x)), int(math.Floor(y))
+	if !(image.Point{ix, iy}).In(r) {
+		return nil, false
+	}
+	i := m.PixOffset(ix, iy)
+	return m.Pix[i : i+4 : i+4], true
+}
+
+// ColorLUT grades colours through a 3D lookup table, as exported by photo and video editors.
+type ColorLUT struct {
+	size int
+	data []float32 // r, g, b for each entry, red changing fastest
+}
+
+// NewColorLUT builds a size x size x size table from a grading function taking and returning colours from 0 to 1.
+func NewColorLUT(size int, grade func(r, g, b float64) (float64, float64, float64)) *ColorLUT {
+	if size < 2 {
+		size = 2
+	}
+	l := &ColorLUT{size: size, data: make([]float32, 0, 3*size*size*size)}
+	s := float64(size - 1)
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				nr, ng, nb := grade(float64(r)/s, float64(g)/s, float64(b)/s)
+				l.data = append(l.data, float32(nr), float32(ng), float32(nb))
+			}
+		}
+	}
+	return l
+}
+
+// ParseCubeLUT reads a 3D table in the Adobe / Resolve .cube format.
+func ParseCubeLUT(rd io.Reader) (*ColorLUT, error) {
+	l := &ColorLUT{}
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		f := strings.Fields(line)
+		switch {
+		case f[0] == "LUT_3D_SIZE" && len(f) == 2:
+			n, err := strconv.Atoi(f[1])
+			if err != nil || n < 2 || n > 256 {
+				return nil, fmt.Errorf("canvas: bad LUT_3D_SIZE %q", f[1])
+			}
+			l.size = n
+		case len(f) == 3 && (f[0][0] == '-' || f[0][0] == '.' || (f[0][0] >= '0' && f[0][0] <= '9')):
+			for _, s := range f {
+				v, err := strconv.ParseFloat(s, 32)
+				if err != nil {
+					return nil, fmt.Errorf("canvas: bad LUT entry %q", line)
+				}
+				l.data = append(l.data, float32(v))
+			}
+		}
+		// TITLE, DOMAIN_MIN / MAX and LUT_1D_SIZE lines are ignored; the domain is taken to be 0 to 1
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if l.size == 0 || len(l.data) != 3*l.size*l.size*l.size {
+		return nil, errors.New("canvas: not a 3D .cube LUT")
+	}
+	return l, nil
+}
+
+// Apply grades the colours of src into dst, interpolating between table entries.
+func (l *ColorLUT) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	n := l.size
+	s := float32(n - 1)
+	at := func(ri, gi, bi int) []float32 {
+		i := 3 * ((bi*n+gi)*n + ri)
+		return l.data[i : i+3 : i+3]
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sp, dp := src.Pix[src.PixOffset(r.Min.X, y):], dst.Pix[dst.PixOffset(r.Min.X, y):]
+		for i := 0; i < 4*r.Dx(); i += 4 {
+			a := sp[i+3]
+			dp[i+3] = a
+			if a == 0 {
+				dp[i], dp[i+1], dp[i+2] = 0, 0, 0
+				continue
+			}
+			// Unpremultiply into table coordinates
+			k := s / float32(a)
+			fr, fg, fb := float32(sp[i])*k, float32(sp[i+1])*k, float32(sp[i+2])*k
+			r0, g0, b0 := int(fr), int(fg), int(fb)
+			if r0 >= n-1 {
+				r0 = n - 2
+			}
+			if g0 >= n-1 {
+				g0 = n - 2
+			}
+			if b0 >= n-1 {
+				b0 = n - 2
+			}
+			tr, tg, tb := fr-float32(r0), fg-float32(g0), fb-float32(b0)
+			var out [3]float32
+			for c := 0; c < 3; c++ {
+				c00 := at(r0, g0, b0)[c]*(1-tr) + at(r0+1, g0, b0)[c]*tr
+				c10 := at(r0, g0+1, b0)[c]*(1-tr) + at(r0+1, g0+1, b0)[c]*tr
+				c01 := at(r0, g0, b0+1)[c]*(1-tr) + at(r0+1, g0, b0+1)[c]*tr
+				c11 := at(r0, g0+1, b0+1)[c]*(1-tr) + at(r0+1, g0+1, b0+1)[c]*tr
+				out[c] = (c00*(1-tg)+c10*tg)*(1-tb) + (c01*(1-tg)+c11*tg)*tb
+			}
+			fa := float32(a)
+			for c := 0; c < 3; c++ {
+				dp[i+c] = uint8(float32(clamp01(float64(out[c])))*fa + 0.5)
+			}
+		}
+	}
+}
+
+// Bloom makes bright parts of the frame glow, by blurring what is over a brightness threshold and adding it back.
+type Bloom struct {
+	Threshold float64 // Brightness, 0 to 1, above which pixels glow
+	Intensity float64 // How strongly the glow is added
+	Radius    float64 // Blur standard deviation, in pixels
+
+	bright, blurred *image.RGBA
+}
+
+func (b *Bloom) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	if b.bright == nil || b.bright.Rect != src.Rect {
+		b.bright, b.blurred = image.NewRGBA(src.Rect), image.NewRGBA(src.Rect)
+	}
+	// Bright pass: keep what is over the threshold, scaled up from 0 there
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sp, bp := src.Pix[src.PixOffset(r.Min.X, y):], b.bright.Pix[b.bright.PixOffset(r.Min.X, y):]
+		for i := 0; i < 4*r.Dx(); i += 4 {
+			l := (0.2126*float64(sp[i]) + 0.7152*float64(sp[i+1]) + 0.0722*float64(sp[i+2])) / 255
+			k := clamp01((l - b.Threshold) / math.Max(1-b.Threshold, 1e-6))
+			bp[i], bp[i+1], bp[i+2], bp[i+3] = uint8(float64(sp[i])*k), uint8(float64(sp[i+1])*k), uint8(float64(sp[i+2])*k), uint8(float64(sp[i+3])*k)
+		}
+	}
+	filter.Blur(b.Radius).Apply(b.blurred, b.bright, r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		sp, gp, dp := src.Pix[src.PixOffset(r.Min.X, y):], b.blurred.Pix[b.blurred.PixOffset(r.Min.X, y):], dst.Pix[dst.PixOffset(r.Min.X, y):]
+		for i := 0; i < 4*r.Dx(); i += 4 {
+			for c := 0; c < 4; c++ {
+				dp[i+c] = uint8(math.Min(255, float64(sp[i+c])+b.Intensity*float64(gp[i+c])))
+			}
+		}
+	}
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
@@ -0,0 +1,145 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+)
+
+// PostPass is a full frame effect run over the finished frame before it goes to the browser.
+// It reads src and writes all of r in dst; the two are the same size and never the same image.
+// Any filter.Filter from the filter package works as a PostPass.
+type PostPass interface {
+	Apply(dst, src *image.RGBA, r image.Rectangle)
+}
+
+// PostFunc makes a function into a PostPass.
+type PostFunc func(dst, src *image.RGBA, r image.Rectangle)
+
+func (f PostFunc) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	f(dst, src, r)
+}
+
+type postEntry struct {
+	name    string
+	pass    PostPass
+	enabled bool
+}
+
+// PostProcess is an ordered chain of named passes, each of which can be switched on and off at any time.
+// Passes work on scratch copies, so the drawn frame itself is left as it was for the next render to carry on from.
+type PostProcess struct {
+	passes  []postEntry
+	a, b    *image.RGBA
+	changed bool // The chain changed since the last frame went out, so it needs showing again
+}
+
+// NewPostProcess returns an empty chain.
+func NewPostProcess() *PostProcess {
+	return &PostProcess{}
+}
+
+// Add appends a pass to the end of the chain, enabled, replacing any existing pass of the same name in its place.
+func (p *PostProcess) Add(name string, pass PostPass) {
+	p.changed = true
+	for i := range p.passes {
+		if p.passes[i].name == name {
+			p.passes[i] = postEntry{name, pass, true}
+			return
+		}
+	}
+	p.passes = append(p.passes, postEntry{name, pass, true})
+}
+
+// Remove takes a pass out of the chain.
+func (p *PostProcess) Remove(name string) {
+	for i := range p.passes {
+		if p.passes[i].name == name {
+			p.passes = append(p.passes[:i], p.passes[i+1:]...)
+			p.changed = true
+			return
+		}
+	}
+}
+
+// Enable switches a pass on or off, returning false if there is no pass of that name.
+func (p *PostProcess) Enable(name string, on bool) bool {
+	for i := range p.passes {
+		if p.passes[i].name == name {
+			if p.passes[i].enabled != on {
+				p.passes[i].enabled = on
+				p.changed = true
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether the named pass exists and is switched on.
+func (p *PostProcess) Enabled(name string) bool {
+	for _, e := range p.passes {
+		if e.name == name {
+			return e.enabled
+		}
+	}
+	return false
+}
+
+// Names returns the names of the passes, in order.
+func (p *PostProcess) Names() []string {
+	names := make([]string, len(p.passes))
+	for i, e := range p.passes {
+		names[i] = e.name
+	}
+	return names
+}
+
+// Run applies the enabled passes to frame and returns the result, which is frame itself if none are enabled.
+// frame is not changed.  The result is only valid until the next Run.
+func (p *PostProcess) Run(frame *image.RGBA) *image.RGBA {
+	p.changed = false
+	return p.apply(frame)
+}
+
+// apply is Run without marking the passes as shown, for screenshots taken between frames.
+func (p *PostProcess) apply(frame *image.RGBA) *image.RGBA {
+	src := frame
+	for _, e := range p.passes {
+		if !e.enabled {
+			continue
+		}
+		dst := p.scratch(frame.Rect, src)
+		e.pass.Apply(dst, src, frame.Rect)
+		src = dst
+	}
+	return src
+}
+
+// scratch returns whichever scratch image isn't src, sized to r.
+func (p *PostProcess) scratch(r image.Rectangle, src *image.RGBA) *image.RGBA {
+	if p.a == nil || p.a.Rect != r {
+		p.a, p.b = image.NewRGBA(r), image.NewRGBA(r)
+	}
+	if src == p.a {
+		return p.b
+	}
+	return p.a
+}
+
+// Changed reports whether passes were added, removed or switched since the last Run, so the frame needs showing again.
+func (p *PostProcess) Changed() bool {
+	return p.changed
+}
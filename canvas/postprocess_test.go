@@ -0,0 +1,52 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/markfarnan/go-canvas/filter"
+)
+
+func TestPostProcessChanged(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(frame.Pix); i += 4 {
+		frame.Pix[i] = 255 // Opaque black
+	}
+	p := NewPostProcess()
+	p.Add("invert", filter.Invert(1))
+	p.Run(frame)
+	if p.Changed() {
+		t.Fatal("changed after Run")
+	}
+
+	// A screenshot of the processed frame, taken after a pass is switched, leaves the change for the render loop to show
+	p.Enable("invert", false)
+	if m := p.apply(frame); m != frame {
+		t.Error("no passes enabled, but apply gave a copy")
+	}
+	if !p.Changed() {
+		t.Error("apply hid the switched pass from the render loop")
+	}
+	p.Enable("invert", true)
+	if m := p.apply(frame); m.RGBAAt(0, 0) != (color.RGBA{255, 255, 255, 255}) || frame.RGBAAt(0, 0) != (color.RGBA{A: 255}) {
+		t.Errorf("inverted %v from %v, want white from the untouched frame", m.RGBAAt(0, 0), frame.RGBAAt(0, 0))
+	}
+	if p.Run(frame); p.Changed() {
+		t.Error("changed after Run")
+	}
+}
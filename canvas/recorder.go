@@ -0,0 +1,141 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"io"
+	"time"
+)
+
+// Default limit on the memory a Recorder's frames take
+const DefaultRecorderBytes = 256 << 20
+
+// Recorder captures the frames the canvas shows, with their timestamps, to save as an animated GIF or APNG.
+// Canvas2d captures each frame it copies to the browser into its recorder while it is recording.
+// Once MaxBytes is reached the oldest frames are dropped, so it keeps the last stretch of a long session, handy for bug reports.
+type Recorder struct {
+	MaxBytes int             // Memory the frames may take; 0 means DefaultRecorderBytes
+	Rect     image.Rectangle // Part of the frame to record; empty means all of it
+
+	frames    []*image.RGBA
+	times     []float64 // Timestamp of each frame, in milliseconds
+	bytes     int
+	recording bool
+	spare     *image.RGBA // A dropped frame, reused for the next one
+}
+
+// NewRecorder returns a recorder, not yet recording.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start throws away anything recorded and starts recording.
+func (r *Recorder) Start() {
+	r.Reset()
+	r.recording = true
+}
+
+// Stop stops recording, keeping what was recorded.
+func (r *Recorder) Stop() {
+	r.recording = false
+}
+
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+// Reset throws away the recorded frames.
+func (r *Recorder) Reset() {
+	r.frames, r.times, r.bytes, r.spare = nil, nil, 0, nil
+}
+
+// Len returns the number of frames recorded.
+func (r *Recorder) Len() int {
+	return len(r.frames)
+}
+
+// Duration returns the time from the first frame recorded to the last.
+func (r *Recorder) Duration() time.Duration {
+	if len(r.times) < 2 {
+		return 0
+	}
+	return time.Duration((r.times[len(r.times)-1] - r.times[0]) * float64(time.Millisecond))
+}
+
+// Capture copies frame, shown at timestamp milliseconds, into the recording, if recording.
+func (r *Recorder) Capture(frame *image.RGBA, timestamp float64) {
+	if !r.recording {
+		return
+	}
+	rect := frame.Rect
+	if !r.Rect.Empty() {
+		rect = r.Rect.Intersect(frame.Rect)
+	}
+	if rect.Empty() || (len(r.frames) > 0 && r.frames[0].Rect.Size() != rect.Size()) {
+		return // Frames must all be the same size; the canvas was resized
+	}
+	limit := r.MaxBytes
+	if limit <= 0 {
+		limit = DefaultRecorderBytes
+	}
+	size := 4 * rect.Dx() * rect.Dy()
+	for len(r.frames) > 0 && r.bytes+size > limit {
+		r.spare = r.frames[0]
+		r.frames, r.times = r.frames[1:], r.times[1:]
+		r.bytes -= len(r.spare.Pix)
+	}
+
+	m := r.spare
+	r.spare = nil
+	if m == nil || len(m.Pix) != size {
+		m = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		copy(m.Pix[(y-rect.Min.Y)*m.Stride:], frame.Pix[frame.PixOffset(rect.Min.X, y):frame.PixOffset(rect.Max.X, y)])
+	}
+	r.frames = append(r.frames, m)
+	r.times = append(r.times, timestamp)
+	r.bytes += size
+}
+
+// Animation returns the recording as an animation that plays forever, each frame showing until the next was captured.
+// The last frame shows for as long as the one before it.
+func (r *Recorder) Animation() *AnimatedImage {
+	a := &AnimatedImage{Frames: append([]*image.RGBA(nil), r.frames...)}
+	for i := range r.frames {
+		var d float64
+		switch {
+		case i+1 < len(r.times):
+			d = r.times[i+1] - r.times[i]
+		case i > 0:
+			d = r.times[i] - r.times[i-1]
+		default:
+			d = float64(DefaultFrameDuration / time.Millisecond)
+		}
+		a.Delays = append(a.Delays, time.Duration(d*float64(time.Millisecond)))
+	}
+	return a
+}
+
+// EncodeGIF writes the recording as an animated GIF.
+func (r *Recorder) EncodeGIF(w io.Writer, opts GIFOptions) error {
+	return EncodeGIF(w, r.Animation(), opts)
+}
+
+// EncodeAPNG writes the recording as an animated PNG, which keeps every colour but is bigger.
+func (r *Recorder) EncodeAPNG(w io.Writer) error {
+	return EncodeAPNG(w, r.Animation())
+}
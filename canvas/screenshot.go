@@ -0,0 +1,135 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ImageFormat is the file format a screenshot is encoded in.
+type ImageFormat int
+
+const (
+	FormatPNG  ImageFormat = iota // Lossless, keeps transparency
+	FormatJPEG                    // Lossy and smaller; transparent pixels come out black, as with the browser's canvas.toDataURL
+)
+
+// MIME returns the format's media type, as used in data URLs and downloads.
+func (f ImageFormat) MIME() string {
+	if f == FormatJPEG {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// FormatForName returns the format a file name's extension asks for: JPEG for .jpg or .jpeg, otherwise PNG.
+func FormatForName(filename string) ImageFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG
+	}
+	return FormatPNG
+}
+
+// ScreenshotOptions says what part of an image a screenshot takes, and how it is encoded.
+type ScreenshotOptions struct {
+	Format  ImageFormat
+	Quality int             // JPEG quality, 1 to 100; 0 means jpeg.DefaultQuality
+	Rect    image.Rectangle // Part of the image to take; empty means all of it
+	Scale   int             // Whole number to enlarge by, each pixel becoming a Scale x Scale block; 0 or 1 means none
+
+	// Take the frame as shown, after the post-processing passes, rather than as drawn.  Only Canvas2d screenshots have passes.
+	PostProcessed bool
+}
+
+// Snapshot copies the r part of img, enlarged scale times with each pixel a scale x scale block, into a new image
+// with its top left corner at 0, 0.  An empty r means all of img, and scale below 1 counts as 1.
+func Snapshot(img *image.RGBA, r image.Rectangle, scale int) *image.RGBA {
+	if r.Empty() {
+		r = img.Rect
+	}
+	r = r.Intersect(img.Rect)
+	if scale < 1 {
+		scale = 1
+	}
+	out := image.NewRGBA(image.Rect(0, 0, r.Dx()*scale, r.Dy()*scale))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := img.Pix[img.PixOffset(r.Min.X, y):img.PixOffset(r.Max.X, y)]
+		row := out.Pix[(y-r.Min.Y)*scale*out.Stride:]
+		if scale == 1 {
+			copy(row, src)
+			continue
+		}
+		// Widen the row once, then copy it down for the rest of the block
+		for x := 0; x < len(src); x += 4 {
+			for i := 0; i < scale; i++ {
+				copy(row[(x*scale)+i*4:], src[x:x+4])
+			}
+		}
+		for i := 1; i < scale; i++ {
+			copy(row[i*out.Stride:(i+1)*out.Stride], row[:out.Stride])
+		}
+	}
+	return out
+}
+
+// EncodeScreenshot writes the part of img opts asks for, as a PNG or JPEG.
+func EncodeScreenshot(w io.Writer, img *image.RGBA, opts ScreenshotOptions) error {
+	if !opts.Rect.Empty() && opts.Rect.Intersect(img.Rect).Empty() {
+		return fmt.Errorf("canvas: screenshot rectangle %v is outside the image %v", opts.Rect, img.Rect)
+	}
+	m := img
+	if opts.Scale > 1 || (!opts.Rect.Empty() && opts.Rect != img.Rect) {
+		m = Snapshot(img, opts.Rect, opts.Scale)
+	}
+	switch opts.Format {
+	case FormatPNG:
+		return png.Encode(w, m)
+	case FormatJPEG:
+		q := opts.Quality
+		if q <= 0 {
+			q = jpeg.DefaultQuality
+		}
+		return jpeg.Encode(w, m, &jpeg.Options{Quality: q})
+	}
+	return fmt.Errorf("canvas: unknown screenshot format %d", opts.Format)
+}
+
+// ScreenshotDataURL returns the part of img opts asks for as a data: URL, to set as an <img> src or send to a server.
+func ScreenshotDataURL(img *image.RGBA, opts ScreenshotOptions) (string, error) {
+	var buf bytes.Buffer
+	if err := EncodeScreenshot(&buf, img, opts); err != nil {
+		return "", err
+	}
+	return "data:" + opts.Format.MIME() + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// Screenshot writes the surface, or the part of it opts asks for, as a PNG or JPEG.
+func (s *Surface) Screenshot(w io.Writer, opts ScreenshotOptions) error {
+	return EncodeScreenshot(w, s.image, opts)
+}
+
+// ScreenshotDataURL returns the surface, or the part of it opts asks for, as a data: URL.
+func (s *Surface) ScreenshotDataURL(opts ScreenshotOptions) (string, error) {
+	return ScreenshotDataURL(s.image, opts)
+}
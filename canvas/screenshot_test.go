@@ -0,0 +1,71 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.SetRGBA(2, 1, color.RGBA{255, 0, 0, 255})
+	m := Snapshot(img, image.Rect(1, 1, 3, 3), 3)
+	if m.Rect != image.Rect(0, 0, 6, 6) {
+		t.Fatalf("snapshot is %v, want 6x6 at 0, 0", m.Rect)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			want := color.RGBA{}
+			if x >= 3 && y < 3 {
+				want = color.RGBA{255, 0, 0, 255}
+			}
+			if got := m.RGBAAt(x, y); got != want {
+				t.Fatalf("at %d, %d: %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestSurfaceScreenshot(t *testing.T) {
+	s := NewSurface(20, 10, nil)
+	s.Image().SetRGBA(5, 5, color.RGBA{0, 0, 255, 255})
+	var buf bytes.Buffer
+	if err := s.Screenshot(&buf, ScreenshotOptions{Rect: image.Rect(4, 4, 8, 8), Scale: 2}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 8, 8) {
+		t.Errorf("screenshot is %v, want 8x8", m.Bounds())
+	}
+	if _, _, b, _ := m.At(3, 3).RGBA(); b != 0xffff {
+		t.Errorf("pixel 5, 5 scaled to 2, 2 - 3, 3 is %v", m.At(3, 3))
+	}
+
+	if err := s.Screenshot(&buf, ScreenshotOptions{Rect: image.Rect(30, 30, 40, 40)}); err == nil {
+		t.Error("no error for a rectangle outside the surface")
+	}
+	url, err := s.ScreenshotDataURL(ScreenshotOptions{Format: FormatJPEG})
+	if err != nil || !strings.HasPrefix(url, "data:image/jpeg;base64,") {
+		t.Errorf("data URL %.30q, %v", url, err)
+	}
+}
@@ -0,0 +1,385 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+)
+
+// Defaults for the signed distance field atlas.  48px glyphs with a 6px spread hold up well from small labels to full screen text.
+const (
+	DefaultSDFSize   = 48
+	DefaultSDFSpread = 6
+)
+
+// Default limit on the memory the fields of an SDFAtlas take.  A 48px field is about 3KB, so this holds a couple of thousand glyphs.
+const DefaultSDFAtlasBytes = 8 << 20
+
+// SDFAtlas caches a signed distance field for each glyph, generated once at a fixed size.
+// As the field stores the distance to the outline rather than coverage, it can be drawn at any scale or rotation and still give sharp edges,
+// plus outlines and glows for free.  Fine detail smaller than a pixel of the field is lost, so very large text is better served by the glyph outlines.
+// Least recently used fields are evicted once they take more than the atlas's byte limit.
+//
+// Not safe for concurrent use.
+type SDFAtlas struct {
+	size     float64 // Pixels per em the fields are generated at
+	spread   float64 // Distance in field pixels covered by the full 0..255 range
+	maxBytes int
+	bytes    int
+	glyphs   map[sdfKey]*list.Element
+	lru      *list.List // Front is most recently used
+}
+
+type sdfKey struct {
+	font  *truetype.Font
+	index truetype.Index
+}
+
+// sdfGlyph is the field for one glyph.  Values are 128 on the outline, higher inside, lower outside.
+type sdfGlyph struct {
+	key    sdfKey
+	field  *image.Alpha
+	origin image.Point // Glyph origin position within field
+}
+
+// SDFStyle is how DrawText paints the text.  Outline and glow sizes are in destination pixels,
+// and are limited by the spread of the atlas times the scale the text is drawn at.
+type SDFStyle struct {
+	Color        color.Color
+	OutlineColor color.Color // Drawn around the text when OutlineWidth > 0
+	OutlineWidth float64
+	GlowColor    color.Color // Fades out over GlowRadius, outside the outline if there is one
+	GlowRadius   float64
+}
+
+// NewSDFAtlas creates an atlas generating fields at size pixels per em, covering spread pixels either side of the outline.
+// Zero values use DefaultSDFSize and DefaultSDFSpread.  It holds up to DefaultSDFAtlasBytes of fields; see SetMaxBytes.
+func NewSDFAtlas(size, spread float64) *SDFAtlas {
+	if size <= 0 {
+		size = DefaultSDFSize
+	}
+	if spread <= 0 {
+		spread = DefaultSDFSpread
+	}
+	return &SDFAtlas{size: size, spread: spread, maxBytes: DefaultSDFAtlasBytes, glyphs: make(map[sdfKey]*list.Element), lru: list.New()}
+}
+
+// Len returns the number of glyph fields cached.
+func (a *SDFAtlas) Len() int {
+	return a.lru.Len()
+}
+
+// Bytes returns the memory the cached fields take.
+func (a *SDFAtlas) Bytes() int {
+	return a.bytes
+}
+
+// SetMaxBytes changes the limit on the memory the cached fields take, evicting the least recently used if required.
+// A limit <= 0 uses DefaultSDFAtlasBytes.
+func (a *SDFAtlas) SetMaxBytes(n int) {
+	if n <= 0 {
+		n = DefaultSDFAtlasBytes
+	}
+	a.maxBytes = n
+	a.evict()
+}
+
+// Reset drops all generated fields.
+func (a *SDFAtlas) Reset() {
+	a.glyphs = make(map[sdfKey]*list.Element)
+	a.lru.Init()
+	a.bytes = 0
+}
+
+// Field returns the distance field for a glyph, generating it if needed, and the position of the glyph origin within it.
+// Useful for uploading the atlas to a GPU texture.  Empty glyphs return nil.
+func (a *SDFAtlas) Field(f *truetype.Font, index truetype.Index) (*image.Alpha, image.Point) {
+	g := a.lookup(f, index)
+	return g.field, g.origin
+}
+
+// DrawText draws s laid out with fc in f at size pixels per em.  tr maps text space, where the baseline starts at 0, 0, to dst,
+// so any scale, rotation or skew can be used.  Returns the advance of the text, in text space.
+func (a *SDFAtlas) DrawText(dst *image.RGBA, fc *FontCache, f *truetype.Font, size float64, s string, tr draw2d.Matrix, style SDFStyle) float64 {
+	if f == nil {
+		return 0
+	}
+	run := layoutText(fc, f, size, s, DirectionAuto)
+	k := size / a.size
+	for _, g := range run.glyphs {
+		sdf := a.lookup(g.font, g.index)
+		if sdf.field == nil {
+			continue
+		}
+		// Field pixels to destination
+		m := tr
+		m.Compose(draw2d.NewTranslationMatrix(g.x, g.y))
+		m.Compose(draw2d.NewScaleMatrix(k, k))
+		m.Compose(draw2d.NewTranslationMatrix(-float64(sdf.origin.X), -float64(sdf.origin.Y)))
+		a.drawField(dst, sdf.field, m, style)
+	}
+	return run.advance
+}
+
+// lookup returns the field for a glyph, generating it on a miss.  The field just looked up is never evicted, even if it alone is over the limit.
+func (a *SDFAtlas) lookup(f *truetype.Font, index truetype.Index) *sdfGlyph {
+	key := sdfKey{f, index}
+	if e, ok := a.glyphs[key]; ok {
+		a.lru.MoveToFront(e)
+		return e.Value.(*sdfGlyph)
+	}
+	g := a.generate(f, index)
+	g.key = key
+	a.glyphs[key] = a.lru.PushFront(g)
+	a.bytes += g.size()
+	a.evict()
+	return g
+}
+
+func (a *SDFAtlas) evict() {
+	for a.bytes > a.maxBytes && a.lru.Len() > 1 {
+		e := a.lru.Back()
+		g := e.Value.(*sdfGlyph)
+		delete(a.glyphs, g.key)
+		a.lru.Remove(e)
+		a.bytes -= g.size()
+	}
+}
+
+// size is the memory the field takes, plus a little for the entry itself so empty glyphs count too.
+func (g *sdfGlyph) size() int {
+	if g.field == nil {
+		return 64
+	}
+	return len(g.field.Pix) + 64
+}
+
+// generate builds the field for a glyph from its flattened outline: the distance to the nearest edge, with the sign from the winding number.
+func (a *SDFAtlas) generate(f *truetype.Font, index truetype.Index) *sdfGlyph {
+	var segs segmentCollector
+	if err := GlyphPath(&segs, f, a.size, index, 0, 0); err != nil || len(segs.segs) == 0 {
+		return &sdfGlyph{}
+	}
+	xmin, ymin, xmax, ymax := segs.bounds()
+	pad := int(math.Ceil(a.spread)) + 1
+	r := image.Rect(int(math.Floor(xmin))-pad, int(math.Floor(ymin))-pad, int(math.Ceil(xmax))+pad, int(math.Ceil(ymax))+pad)
+	g := &sdfGlyph{
+		field:  image.NewAlpha(image.Rect(0, 0, r.Dx(), r.Dy())),
+		origin: image.Pt(-r.Min.X, -r.Min.Y),
+	}
+	for y := 0; y < r.Dy(); y++ {
+		py := float64(y+r.Min.Y) + 0.5
+		for x := 0; x < r.Dx(); x++ {
+			px := float64(x+r.Min.X) + 0.5
+			d := segs.distance(px, py, a.spread)
+			if segs.winding(px, py) == 0 {
+				d = -d
+			}
+			v := 128 + d/a.spread*127
+			g.field.Pix[y*g.field.Stride+x] = uint8(math.Max(0, math.Min(255, math.Round(v))))
+		}
+	}
+	return g
+}
+
+// drawField paints a glyph field into dst, where m maps field pixels to dst pixels.
+func (a *SDFAtlas) drawField(dst *image.RGBA, field *image.Alpha, m draw2d.Matrix, style SDFStyle) {
+	// Destination area covered by the field
+	fw, fh := float64(field.Rect.Dx()), float64(field.Rect.Dy())
+	x0, y0, x1, y1 := m.TransformRectangle(0, 0, fw, fh)
+	area := image.Rect(int(math.Floor(x0)), int(math.Floor(y0)), int(math.Ceil(x1)), int(math.Ceil(y1))).Intersect(dst.Rect)
+	if area.Empty() {
+		return
+	}
+	inv := m
+	inv.Inverse()
+	// Field distances to destination pixels
+	scale := math.Sqrt(math.Abs(m.Determinant())) * a.spread / 127
+
+	fill := premultiplied(style.Color)
+	outline, glow := premultiplied(style.OutlineColor), premultiplied(style.GlowColor)
+	// Effects have to fade out before the edge of the field, where distances saturate
+	limit := 127 * scale
+	ow := 0.0
+	if style.OutlineColor != nil {
+		ow = math.Min(math.Max(0, style.OutlineWidth), limit)
+	}
+	glowR := 0.0
+	if style.GlowColor != nil {
+		glowR = math.Min(math.Max(0, style.GlowRadius), limit-ow)
+	}
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			fx, fy := inv.TransformPoint(float64(x)+0.5, float64(y)+0.5)
+			d := (sampleField(field, fx-0.5, fy-0.5) - 128) * scale
+			i := dst.PixOffset(x, y)
+			if glowR > 0 {
+				if e := -(d + ow); e > 0 && e < glowR {
+					t := 1 - e/glowR
+					blendPixel(dst.Pix[i:i+4], glow, t*t)
+				}
+			}
+			if ow > 0 {
+				blendPixel(dst.Pix[i:i+4], outline, clamp01(d+ow+0.5))
+			}
+			blendPixel(dst.Pix[i:i+4], fill, clamp01(d+0.5))
+		}
+	}
+}
+
+// sampleField bilinearly samples field at x, y (in pixel centre coordinates), treating everything outside as far outside the glyph.
+func sampleField(field *image.Alpha, x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	tx, ty := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= field.Rect.Dx() || y >= field.Rect.Dy() {
+			return 0
+		}
+		return float64(field.Pix[y*field.Stride+x])
+	}
+	top := at(ix, iy)*(1-tx) + at(ix+1, iy)*tx
+	bottom := at(ix, iy+1)*(1-tx) + at(ix+1, iy+1)*tx
+	return top*(1-ty) + bottom*ty
+}
+
+// premultiplied returns c as 0..1 premultiplied components.  A nil colour is transparent.
+func premultiplied(c color.Color) [4]float64 {
+	if c == nil {
+		return [4]float64{}
+	}
+	r, g, b, a := c.RGBA()
+	return [4]float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff, float64(a) / 0xffff}
+}
+
+// blendPixel draws c over the RGBA pixel p with the given coverage.
+func blendPixel(p []uint8, c [4]float64, coverage float64) {
+	if coverage <= 0 || c[3] == 0 {
+		return
+	}
+	ia := 1 - c[3]*coverage
+	for j := 0; j < 4; j++ {
+		p[j] = uint8(math.Min(255, c[j]*coverage*255+float64(p[j])*ia+0.5))
+	}
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// segmentCollector is a draw2d.PathBuilder that flattens closed outlines into line segments, for the distance field.
+type segmentCollector struct {
+	segs           [][4]float64
+	x, y           float64
+	startX, startY float64
+}
+
+func (s *segmentCollector) LastPoint() (x, y float64) {
+	return s.x, s.y
+}
+
+func (s *segmentCollector) MoveTo(x, y float64) {
+	s.x, s.y = x, y
+	s.startX, s.startY = x, y
+}
+
+func (s *segmentCollector) LineTo(x, y float64) {
+	if x != s.x || y != s.y {
+		s.segs = append(s.segs, [4]float64{s.x, s.y, x, y})
+	}
+	s.x, s.y = x, y
+}
+
+// Curves are split into a fixed number of pieces.  At glyph sizes that keeps them well within a tenth of a field pixel.
+func (s *segmentCollector) QuadCurveTo(cx, cy, x, y float64) {
+	x0, y0 := s.x, s.y
+	const n = 8
+	for i := 1; i <= n; i++ {
+		t := float64(i) / n
+		u := 1 - t
+		s.LineTo(u*u*x0+2*u*t*cx+t*t*x, u*u*y0+2*u*t*cy+t*t*y)
+	}
+}
+
+func (s *segmentCollector) CubicCurveTo(cx1, cy1, cx2, cy2, x, y float64) {
+	x0, y0 := s.x, s.y
+	const n = 16
+	for i := 1; i <= n; i++ {
+		t := float64(i) / n
+		u := 1 - t
+		s.LineTo(u*u*u*x0+3*u*u*t*cx1+3*u*t*t*cx2+t*t*t*x, u*u*u*y0+3*u*u*t*cy1+3*u*t*t*cy2+t*t*t*y)
+	}
+}
+
+// ArcTo isn't used by glyph outlines
+func (s *segmentCollector) ArcTo(cx, cy, rx, ry, startAngle, angle float64) {}
+
+func (s *segmentCollector) Close() {
+	s.LineTo(s.startX, s.startY)
+}
+
+func (s *segmentCollector) bounds() (xmin, ymin, xmax, ymax float64) {
+	xmin, ymin = math.Inf(1), math.Inf(1)
+	xmax, ymax = math.Inf(-1), math.Inf(-1)
+	for _, sg := range s.segs {
+		xmin = math.Min(xmin, math.Min(sg[0], sg[2]))
+		xmax = math.Max(xmax, math.Max(sg[0], sg[2]))
+		ymin = math.Min(ymin, math.Min(sg[1], sg[3]))
+		ymax = math.Max(ymax, math.Max(sg[1], sg[3]))
+	}
+	return
+}
+
+// distance returns the distance from x, y to the nearest segment, capped at limit.
+func (s *segmentCollector) distance(x, y, limit float64) float64 {
+	best := limit * limit
+	for _, sg := range s.segs {
+		dx, dy := sg[2]-sg[0], sg[3]-sg[1]
+		t := ((x-sg[0])*dx + (y-sg[1])*dy) / (dx*dx + dy*dy)
+		t = clamp01(t)
+		ex, ey := sg[0]+dx*t-x, sg[1]+dy*t-y
+		if d := ex*ex + ey*ey; d < best {
+			best = d
+		}
+	}
+	return math.Sqrt(best)
+}
+
+// winding returns the non zero winding number of the outline around x, y.
+func (s *segmentCollector) winding(x, y float64) int {
+	w := 0
+	for _, sg := range s.segs {
+		if (sg[1] <= y) == (sg[3] <= y) {
+			continue
+		}
+		// x where the segment crosses the horizontal line through y
+		cx := sg[0] + (y-sg[1])*(sg[2]-sg[0])/(sg[3]-sg[1])
+		if cx > x {
+			if sg[3] > sg[1] {
+				w++
+			} else {
+				w--
+			}
+		}
+	}
+	return w
+}
@@ -0,0 +1,82 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/llgcode/draw2d"
+)
+
+func TestSDFAtlasEviction(t *testing.T) {
+	_, f := testFonts(t)
+	a := NewSDFAtlas(0, 0)
+	field := func(r rune) *image.Alpha {
+		m, _ := a.Field(f, f.Index(r))
+		return m
+	}
+
+	// Room for H, L and T, but not I as well
+	sizes := NewSDFAtlas(0, 0)
+	limit := 0
+	for _, r := range "HLT" {
+		limit += sizes.lookup(f, f.Index(r)).size()
+	}
+	a.SetMaxBytes(limit)
+	first := field('H')
+	field('I')
+	field('H') // Most recently used again, leaving I the oldest
+	field('L')
+	field('T') // Over the limit, so I goes
+	if a.Bytes() > limit || a.Len() != 3 {
+		t.Fatalf("%d fields in %d bytes, want 3 within the limit of %d", a.Len(), a.Bytes(), limit)
+	}
+	if _, ok := a.glyphs[sdfKey{f, f.Index('I')}]; ok {
+		t.Error("least recently used field was kept")
+	}
+	if field('H') != first {
+		t.Error("recently used field was regenerated")
+	}
+
+	// A field bigger than the limit is still kept while it is the one being drawn
+	a.SetMaxBytes(1)
+	if a.Len() != 1 || field('W') == nil || a.Len() != 1 {
+		t.Errorf("%d fields kept over a 1 byte limit, want 1", a.Len())
+	}
+	a.Reset()
+	if a.Len() != 0 || a.Bytes() != 0 {
+		t.Errorf("Reset left %d fields in %d bytes", a.Len(), a.Bytes())
+	}
+}
+
+func TestSDFDrawText(t *testing.T) {
+	fc, f := testFonts(t)
+	dst := image.NewRGBA(image.Rect(0, 0, 200, 60))
+	a := NewSDFAtlas(0, 0)
+	tr := draw2d.NewTranslationMatrix(10, 40)
+	adv := a.DrawText(dst, fc, f, 24, "Hi", tr, SDFStyle{Color: color.Black})
+	if m := fc.Measure(f, 24, "Hi"); adv != m.Advance {
+		t.Errorf("advance %v, Measure says %v", adv, m.Advance)
+	}
+	// The stem of the H is solid
+	if got := dst.RGBAAt(13, 30); got.A < 200 {
+		t.Errorf("H stem alpha %d, want it filled", got.A)
+	}
+	if got := dst.RGBAAt(150, 10); got.A != 0 {
+		t.Errorf("pixel away from the text has alpha %d", got.A)
+	}
+}
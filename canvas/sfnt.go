@@ -0,0 +1,95 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"errors"
+)
+
+// sfntFont gives access to the raw tables of a TrueType / OpenType font file,
+// for the parts truetype.Font keeps private or ignores (hhea line gap, OS/2 metrics, layout and colour tables).
+// See https://docs.microsoft.com/en-us/typography/opentype/spec/otff for the layout.
+type sfntFont struct {
+	data   []byte
+	tables map[string][]byte
+
+	ot    *otLayout  // Shaping tables, parsed on first use
+	color *colorFont // Colour glyph tables, also parsed on first use
+}
+
+var errBadSFNT = errors.New("canvas: malformed font data")
+
+// parseSFNT reads the table directory of a font file.  For a collection (.ttc) it reads the first font, as truetype.Parse does.
+// Table contents are sliced from data, not copied.
+func parseSFNT(data []byte) (*sfntFont, error) {
+	if len(data) < 12 {
+		return nil, errBadSFNT
+	}
+	dir := 0
+	if string(data[:4]) == "ttcf" {
+		// Collection header: tag, version, number of fonts, then the offset of each font's table directory.
+		// Table offsets within each directory are from the start of the file, so tables can be shared.
+		if len(data) < 16 || u32(data, 8) == 0 {
+			return nil, errBadSFNT
+		}
+		dir = int(u32(data, 12))
+		if dir < 0 || dir+12 > len(data) {
+			return nil, errBadSFNT
+		}
+	}
+	numTables := int(u16(data, dir+4))
+	if len(data) < dir+12+16*numTables {
+		return nil, errBadSFNT
+	}
+	s := &sfntFont{data: data, tables: make(map[string][]byte, numTables)}
+	for i := 0; i < numTables; i++ {
+		rec := data[dir+12+16*i:]
+		offset, length := int(u32(rec, 8)), int(u32(rec, 12))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, errBadSFNT
+		}
+		s.tables[string(rec[:4])] = data[offset : offset+length]
+	}
+	return s, nil
+}
+
+// table returns the raw table for tag, or nil if the font doesn't have it.
+func (s *sfntFont) table(tag string) []byte {
+	if s == nil {
+		return nil
+	}
+	return s.tables[tag]
+}
+
+// Big endian readers.  Callers bounds check, or use the safe variants below where the data comes from an untrusted offset.
+func u16(b []byte, i int) uint16 {
+	return uint16(b[i])<<8 | uint16(b[i+1])
+}
+
+func u32(b []byte, i int) uint32 {
+	return uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
+}
+
+// Bounds checked readers, returning 0 past the end of b
+func su16(b []byte, i int) uint16 {
+	if i < 0 || i+2 > len(b) {
+		return 0
+	}
+	return u16(b, i)
+}
+
+func si16(b []byte, i int) int16 {
+	return int16(su16(b, i))
+}
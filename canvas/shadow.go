@@ -0,0 +1,114 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/markfarnan/go-canvas/filter"
+)
+
+// Shadow is drawn beneath everything filled, stroked or drawn while it is set, as canvas shadowColor, shadowBlur and shadowOffsetX / Y.
+// Offsets are in canvas pixels and ignore the current transform, like canvas.  With no offset and a bright colour it makes a glow.
+type Shadow struct {
+	Color            color.Color
+	Blur             float64 // As canvas shadowBlur: the Gaussian blur has a standard deviation of half this
+	OffsetX, OffsetY float64
+}
+
+// visible reports whether the shadow draws anything.
+func (s Shadow) visible() bool {
+	if s.Color == nil {
+		return false
+	}
+	if _, _, _, a := s.Color.RGBA(); a == 0 {
+		return false
+	}
+	return s.Blur > 0 || s.OffsetX != 0 || s.OffsetY != 0
+}
+
+// drawShadow composites the shadow of the layer's contents within r onto the image.
+func (p *painter) drawShadow(r image.Rectangle) {
+	sh := p.shadow
+	sigma := sh.Blur / 2
+	m := int(math.Ceil(3 * sigma))
+	ar := r.Inset(-m)
+	w, h := ar.Dx(), ar.Dy()
+	if w <= 0 || h <= 0 {
+		return
+	}
+	if cap(p.shadowBuf) < 2*w*h {
+		p.shadowBuf = make([]float32, 2*w*h)
+	}
+	buf, tmp := p.shadowBuf[:w*h], p.shadowBuf[w*h:2*w*h]
+	for i := range buf {
+		buf[i] = 0
+	}
+	src := r.Intersect(p.layer.Rect)
+	for y := src.Min.Y; y < src.Max.Y; y++ {
+		li := p.layer.PixOffset(src.Min.X, y)
+		bi := (y-ar.Min.Y)*w + src.Min.X - ar.Min.X
+		for x := src.Min.X; x < src.Max.X; x, li, bi = x+1, li+4, bi+1 {
+			buf[bi] = float32(p.layer.Pix[li+3]) / 255
+		}
+	}
+	if sigma > 0 {
+		for _, box := range filter.GaussBoxes(sigma, 3) {
+			boxBlur(tmp, buf, h, w, box/2, 1, w) // Across
+			boxBlur(buf, tmp, w, h, box/2, w, 1) // Down
+		}
+	}
+
+	// Tint, offset and composite
+	cr, cg, cb, ca := sh.Color.RGBA()
+	c := [4]float64{float64(cr) / 0xffff, float64(cg) / 0xffff, float64(cb) / 0xffff, float64(ca) / 0xffff}
+	dx, dy := int(math.Round(sh.OffsetX)), int(math.Round(sh.OffsetY))
+	dr := ar.Add(image.Pt(dx, dy)).Intersect(p.img.Rect)
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		di := p.img.PixOffset(dr.Min.X, y)
+		bi := (y-dy-ar.Min.Y)*w + dr.Min.X - dx - ar.Min.X
+		for x := dr.Min.X; x < dr.Max.X; x, di, bi = x+1, di+4, bi+1 {
+			a := float64(buf[bi]) * p.alpha
+			if a <= 0 {
+				continue
+			}
+			p.put(p.img.Pix[di:di+4:di+4], [4]float64{c[0] * a, c[1] * a, c[2] * a, c[3] * a}, x, y)
+		}
+	}
+}
+
+// boxBlur averages each value of src with the r values either side of it along lines, into dst.
+// There are count lines of n values, each value step apart and each line stride apart; values past the ends count as 0.
+func boxBlur(dst, src []float32, count, n, r, step, stride int) {
+	scale := 1 / float32(2*r+1)
+	for l := 0; l < count; l++ {
+		base := l * stride
+		var sum float32
+		for i := 0; i < r && i < n; i++ {
+			sum += src[base+i*step]
+		}
+		for i := 0; i < n; i++ {
+			if j := i + r; j < n {
+				sum += src[base+j*step]
+			}
+			dst[base+i*step] = sum * scale
+			if j := i - r; j >= 0 {
+				sum -= src[base+j*step]
+			}
+		}
+	}
+}
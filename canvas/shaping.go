@@ -0,0 +1,575 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// Basic OpenType shaping from the GSUB / GPOS tables of fonts added with FontCache.StoreData.
+//
+// Supported:
+//  - GSUB single, multiple and ligature substitution, for the ccmp, rlig, liga and clig features
+//  - GPOS single and pair adjustment (kern), mark to base and mark to mark attachment (mark, mkmk)
+//
+// Features are taken from the default language of the text's script in the ScriptList, falling back to DFLT, then latn.
+//
+// Not supported: contextual lookups, mark to ligature, cursive attachment, and script specific shaping such as Arabic joining forms.
+// Fonts without a GPOS kern feature fall back to the truetype kern table.
+// Table layouts are documented at https://docs.microsoft.com/en-us/typography/opentype/spec/chapter2
+
+var (
+	gsubFeatures = []string{"ccmp", "rlig", "liga", "clig"}
+	gposFeatures = []string{"kern", "mark", "mkmk"}
+)
+
+// GDEF glyph classes
+const (
+	glyphClassBase     = 1
+	glyphClassLigature = 2
+	glyphClassMark     = 3
+)
+
+// Lookup flags
+const (
+	lookupIgnoreBase      = 0x02
+	lookupIgnoreLigatures = 0x04
+	lookupIgnoreMarks     = 0x08
+)
+
+// otLayout is the parsed shaping data of one font.
+type otLayout struct {
+	glyphClass []byte // GDEF glyph ClassDef, or nil
+	gsubTable  []byte
+	gposTable  []byte
+	scripts    map[string]*otFeatures // Lookups for each script shaped so far
+}
+
+// otFeatures are the lookups the features we shape with use for one script.
+type otFeatures struct {
+	gsub []otLookup
+	gpos []otLookup
+	kern bool // GPOS has a kern feature, so the truetype kern table is not used
+}
+
+type otLookup struct {
+	kind      uint16
+	flag      uint16
+	subtables [][]byte
+}
+
+// layout returns the parsed shaping tables, parsing them on first use.
+func (s *sfntFont) layout() *otLayout {
+	if s == nil {
+		return nil
+	}
+	if s.ot == nil {
+		s.ot = &otLayout{gsubTable: s.table("GSUB"), gposTable: s.table("GPOS"), scripts: make(map[string]*otFeatures)}
+		if gdef := s.table("GDEF"); len(gdef) >= 6 {
+			if off := int(u16(gdef, 4)); off != 0 && off < len(gdef) {
+				s.ot.glyphClass = gdef[off:]
+			}
+		}
+	}
+	return s.ot
+}
+
+// features returns the lookups for text in script, an OpenType script tag such as "latn", or "" for text of no particular script.
+// "*" gives the lookups of every script and language, for subsetting.
+func (ot *otLayout) features(script string) *otFeatures {
+	if f, ok := ot.scripts[script]; ok {
+		return f
+	}
+	f := &otFeatures{}
+	f.gsub, _ = parseLookups(ot.gsubTable, script, gsubFeatures, 7)
+	f.gpos, f.kern = parseLookups(ot.gposTable, script, gposFeatures, 9)
+	ot.scripts[script] = f
+	return f
+}
+
+// langSys returns the LangSys tables of a ScriptList to use for script: its default language, or failing that DFLT's,
+// or failing that latn's, as fonts often only fill in latn.  Language specific LangSys are not used, except for "*".
+func langSys(scriptList []byte, script string) [][]byte {
+	n := int(su16(scriptList, 0))
+	find := func(tag string) []byte {
+		for i := 0; i < n; i++ {
+			rec := 2 + 6*i
+			if rec+6 > len(scriptList) {
+				break
+			}
+			if string(scriptList[rec:rec+4]) != tag {
+				continue
+			}
+			st := scriptList[minInt(int(u16(scriptList, rec+4)), len(scriptList)):]
+			if off := int(su16(st, 0)); off != 0 {
+				return st[minInt(off, len(st)):]
+			}
+		}
+		return nil
+	}
+	if script == "*" {
+		var all [][]byte
+		for i := 0; i < n && 2+6*i+6 <= len(scriptList); i++ {
+			st := scriptList[minInt(int(u16(scriptList, 2+6*i+4)), len(scriptList)):]
+			if off := int(su16(st, 0)); off != 0 {
+				all = append(all, st[minInt(off, len(st)):])
+			}
+			for j, m := 0, int(su16(st, 2)); j < m; j++ {
+				all = append(all, st[minInt(int(su16(st, 4+6*j+4)), len(st)):])
+			}
+		}
+		return all
+	}
+	for _, tag := range []string{script, "DFLT", "latn"} {
+		if ls := find(tag); ls != nil {
+			return [][]byte{ls}
+		}
+	}
+	return nil
+}
+
+// parseLookups returns the lookups used by any of the features in script's LangSys, in lookup list order (which is the order
+// they must be applied in).  ext is the extension lookup type for the table, whose subtables are unwrapped.
+// Also reports whether the first feature was present.
+func parseLookups(t []byte, script string, features []string, ext uint16) ([]otLookup, bool) {
+	if len(t) < 10 {
+		return nil, false
+	}
+	scriptList := t[minInt(int(u16(t, 4)), len(t)):]
+	featureList, lookupList := t[minInt(int(u16(t, 6)), len(t)):], t[minInt(int(u16(t, 8)), len(t)):]
+
+	wanted := make(map[int]bool)
+	first := false
+	addFeature := func(i int) {
+		rec := 2 + 6*i
+		if i >= int(su16(featureList, 0)) || rec+6 > len(featureList) {
+			return
+		}
+		tag := string(featureList[rec : rec+4])
+		for j, f := range features {
+			if tag != f {
+				continue
+			}
+			first = first || j == 0
+			feature := featureList[minInt(int(u16(featureList, rec+4)), len(featureList)):]
+			for k, m := 0, int(su16(feature, 2)); k < m; k++ {
+				wanted[int(su16(feature, 4+2*k))] = true
+			}
+		}
+	}
+	for _, ls := range langSys(scriptList, script) {
+		if req := su16(ls, 2); req != 0xffff {
+			addFeature(int(req))
+		}
+		for k, m := 0, int(su16(ls, 4)); k < m; k++ {
+			addFeature(int(su16(ls, 6+2*k)))
+		}
+	}
+	indexes := make([]int, 0, len(wanted))
+	for i := range wanted {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var lookups []otLookup
+	for _, i := range indexes {
+		if i >= int(su16(lookupList, 0)) {
+			continue
+		}
+		lt := lookupList[minInt(int(su16(lookupList, 2+2*i)), len(lookupList)):]
+		lookupType := su16(lt, 0)
+		l := otLookup{kind: lookupType, flag: su16(lt, 2)}
+		for j, n := 0, int(su16(lt, 4)); j < n; j++ {
+			st := lt[minInt(int(su16(lt, 6+2*j)), len(lt)):]
+			if lookupType == ext { // Extension, each subtable points to the real one with a 32 bit offset
+				if len(st) < 8 {
+					continue
+				}
+				off := int(u32(st, 4))
+				if off < 0 || off > len(st) {
+					continue
+				}
+				// They must all wrap the same type, so the lookup takes the first one's
+				if len(l.subtables) == 0 {
+					l.kind = u16(st, 2)
+				} else if u16(st, 2) != l.kind {
+					continue
+				}
+				st = st[off:]
+			}
+			l.subtables = append(l.subtables, st)
+		}
+		lookups = append(lookups, l)
+	}
+	return lookups, first
+}
+
+// otScripts maps Unicode scripts to OpenType script tags, for the scripts fonts commonly have features for.
+var otScripts = []struct {
+	table *unicode.RangeTable
+	tag   string
+}{
+	{unicode.Latin, "latn"}, {unicode.Greek, "grek"}, {unicode.Cyrillic, "cyrl"}, {unicode.Armenian, "armn"},
+	{unicode.Hebrew, "hebr"}, {unicode.Arabic, "arab"}, {unicode.Syriac, "syrc"}, {unicode.Thaana, "thaa"},
+	{unicode.Devanagari, "deva"}, {unicode.Bengali, "beng"}, {unicode.Gurmukhi, "guru"}, {unicode.Gujarati, "gujr"},
+	{unicode.Tamil, "taml"}, {unicode.Telugu, "telu"}, {unicode.Kannada, "knda"}, {unicode.Malayalam, "mlym"},
+	{unicode.Thai, "thai"}, {unicode.Lao, "lao "}, {unicode.Tibetan, "tibt"}, {unicode.Georgian, "geor"},
+	{unicode.Hangul, "hang"}, {unicode.Hiragana, "kana"}, {unicode.Katakana, "kana"}, {unicode.Han, "hani"},
+}
+
+// scriptTag returns the OpenType script tag for r, or "" for runes used by all scripts (spaces, digits, punctuation
+// and combining marks), which go with the text around them.  Scripts without a tag here shape with DFLT.
+func scriptTag(r rune) string {
+	if r < 0x80 {
+		if 'a' <= r|0x20 && r|0x20 <= 'z' {
+			return "latn"
+		}
+		return ""
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for _, s := range otScripts {
+		if unicode.Is(s.table, r) {
+			return s.tag
+		}
+	}
+	return "DFLT"
+}
+
+// class returns the GDEF glyph class of g, or 0 if the font has no GDEF.
+func (ot *otLayout) class(g truetype.Index) int {
+	if ot.glyphClass == nil {
+		return 0
+	}
+	return classOf(ot.glyphClass, uint16(g))
+}
+
+// skip reports whether glyph g is ignored by a lookup with the given flags.
+func (ot *otLayout) skip(g truetype.Index, flag uint16) bool {
+	switch ot.class(g) {
+	case glyphClassBase:
+		return flag&lookupIgnoreBase != 0
+	case glyphClassLigature:
+		return flag&lookupIgnoreLigatures != 0
+	case glyphClassMark:
+		return flag&lookupIgnoreMarks != 0
+	}
+	return false
+}
+
+// next returns the index of the next glyph after i not skipped by flag, or -1.
+func (ot *otLayout) next(glyphs []layoutGlyph, i int, flag uint16) int {
+	for i++; i < len(glyphs); i++ {
+		if !ot.skip(glyphs[i].index, flag) {
+			return i
+		}
+	}
+	return -1
+}
+
+// substitute applies the GSUB lookups for script to a run of glyphs from this font.
+func (ot *otLayout) substitute(glyphs []layoutGlyph, script string) []layoutGlyph {
+	for _, l := range ot.features(script).gsub {
+		for i := 0; i < len(glyphs); i++ {
+			if ot.skip(glyphs[i].index, l.flag) {
+				continue
+			}
+			for _, st := range l.subtables {
+				var n int
+				if glyphs, n = ot.substituteOne(l, st, glyphs, i); n > 0 {
+					i += n - 1 // Output of a lookup is not fed back into the same lookup
+					break
+				}
+			}
+		}
+	}
+	return glyphs
+}
+
+// substituteOne applies a single GSUB subtable at glyph i.
+// Returns the number of glyphs it produced at i, or 0 if the subtable didn't match.
+func (ot *otLayout) substituteOne(l otLookup, st []byte, glyphs []layoutGlyph, i int) ([]layoutGlyph, int) {
+	cov := coverageIndex(st[minInt(int(su16(st, 2)), len(st)):], uint16(glyphs[i].index))
+	if cov < 0 {
+		return glyphs, 0
+	}
+	format := su16(st, 0)
+	switch {
+	case l.kind == 1 && format == 1: // Single, delta
+		glyphs[i].index = truetype.Index(int(glyphs[i].index) + int(si16(st, 4)))
+		return glyphs, 1
+
+	case l.kind == 1 && format == 2: // Single, array
+		if cov < int(su16(st, 4)) {
+			glyphs[i].index = truetype.Index(su16(st, 6+2*cov))
+			return glyphs, 1
+		}
+
+	case l.kind == 2 && format == 1: // Multiple, one glyph becomes several
+		if cov >= int(su16(st, 4)) {
+			break
+		}
+		seq := st[minInt(int(su16(st, 6+2*cov)), len(st)):]
+		n := int(su16(seq, 0))
+		if n == 0 {
+			break
+		}
+		out := make([]layoutGlyph, n)
+		for k := range out {
+			out[k] = glyphs[i]
+			out[k].index = truetype.Index(su16(seq, 2+2*k))
+		}
+		glyphs = append(glyphs[:i], append(out, glyphs[i+1:]...)...)
+		return glyphs, n
+
+	case l.kind == 4 && format == 1: // Ligature
+		if cov >= int(su16(st, 4)) {
+			break
+		}
+		set := st[minInt(int(su16(st, 6+2*cov)), len(st)):]
+		for k, n := 0, int(su16(set, 0)); k < n; k++ {
+			lig := set[minInt(int(su16(set, 2+2*k)), len(set)):]
+			comps := int(su16(lig, 2))
+			if comps < 1 {
+				continue
+			}
+			// Match the remaining components against the following (non skipped) glyphs
+			matched := []int{i}
+			for c, j := 1, i; c < comps; c++ {
+				if j = ot.next(glyphs, j, l.flag); j < 0 || uint16(glyphs[j].index) != su16(lig, 4+2*(c-1)) {
+					matched = nil
+					break
+				}
+				matched = append(matched, j)
+			}
+			if matched == nil {
+				continue
+			}
+			// The ligature takes the place (and cluster) of the first component, the rest are removed.
+			// Skipped marks in between stay where they are.
+			glyphs[i].index = truetype.Index(su16(lig, 0))
+			for c := len(matched) - 1; c > 0; c-- {
+				j := matched[c]
+				glyphs = append(glyphs[:j], glyphs[j+1:]...)
+			}
+			return glyphs, 1
+		}
+	}
+	return glyphs, 0
+}
+
+// position applies the GPOS lookups for script to a run of glyphs from this font, whose advances are already set.
+// scale converts font units to pixels.
+func (ot *otLayout) position(glyphs []layoutGlyph, script string, scale float64) {
+	for _, l := range ot.features(script).gpos {
+		for i := range glyphs {
+			if ot.skip(glyphs[i].index, l.flag) {
+				continue
+			}
+			for _, st := range l.subtables {
+				if ot.positionOne(l, st, glyphs, i, scale) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// positionOne applies a single GPOS subtable at glyph i, reporting whether it matched.
+func (ot *otLayout) positionOne(l otLookup, st []byte, glyphs []layoutGlyph, i int, scale float64) bool {
+	format := su16(st, 0)
+	switch {
+	case l.kind == 1: // Single adjustment
+		cov := coverageIndex(st[minInt(int(su16(st, 2)), len(st)):], uint16(glyphs[i].index))
+		if cov < 0 {
+			return false
+		}
+		vf := su16(st, 4)
+		off := 6
+		if format == 2 {
+			if cov >= int(su16(st, 6)) {
+				return false
+			}
+			off = 8 + cov*valueSize(vf)
+		}
+		applyValue(&glyphs[i], st, off, vf, scale)
+		return true
+
+	case l.kind == 2: // Pair adjustment, i.e. kerning
+		cov := coverageIndex(st[minInt(int(su16(st, 2)), len(st)):], uint16(glyphs[i].index))
+		if cov < 0 {
+			return false
+		}
+		j := ot.next(glyphs, i, l.flag)
+		if j < 0 {
+			return false
+		}
+		vf1, vf2 := su16(st, 4), su16(st, 6)
+		size1, size2 := valueSize(vf1), valueSize(vf2)
+		second := uint16(glyphs[j].index)
+		switch format {
+		case 1:
+			if cov >= int(su16(st, 8)) {
+				return false
+			}
+			set := st[minInt(int(su16(st, 10+2*cov)), len(st)):]
+			rec := 2 + size1 + size2
+			// Pair value records are sorted by second glyph
+			n := int(su16(set, 0))
+			k := sort.Search(n, func(k int) bool { return su16(set, 2+k*rec) >= second })
+			if k == n || su16(set, 2+k*rec) != second {
+				return false
+			}
+			applyValue(&glyphs[i], set, 2+k*rec+2, vf1, scale)
+			applyValue(&glyphs[j], set, 2+k*rec+2+size1, vf2, scale)
+			return true
+		case 2:
+			c1 := classOf(st[minInt(int(su16(st, 8)), len(st)):], uint16(glyphs[i].index))
+			c2 := classOf(st[minInt(int(su16(st, 10)), len(st)):], second)
+			n1, n2 := int(su16(st, 12)), int(su16(st, 14))
+			if c1 >= n1 || c2 >= n2 {
+				return false
+			}
+			off := 16 + (c1*n2+c2)*(size1+size2)
+			applyValue(&glyphs[i], st, off, vf1, scale)
+			applyValue(&glyphs[j], st, off+size1, vf2, scale)
+			return true
+		}
+
+	case (l.kind == 4 || l.kind == 6) && format == 1: // Mark to base, mark to mark
+		markCov := coverageIndex(st[minInt(int(su16(st, 2)), len(st)):], uint16(glyphs[i].index))
+		if markCov < 0 {
+			return false
+		}
+		// Find what the mark attaches to, the previous base (or mark, for mark to mark)
+		baseCovTable := st[minInt(int(su16(st, 4)), len(st)):]
+		b := i - 1
+		for ; b >= 0; b-- {
+			class := ot.class(glyphs[b].index)
+			if l.kind == 4 && (class == glyphClassMark || (class == 0 && coverageIndex(st[minInt(int(su16(st, 2)), len(st)):], uint16(glyphs[b].index)) >= 0)) {
+				continue // Marks are skipped looking for the base
+			}
+			break
+		}
+		if b < 0 {
+			return false
+		}
+		baseCov := coverageIndex(baseCovTable, uint16(glyphs[b].index))
+		if baseCov < 0 {
+			return false
+		}
+		classCount := int(su16(st, 6))
+		markArray := st[minInt(int(su16(st, 8)), len(st)):]
+		baseArray := st[minInt(int(su16(st, 10)), len(st)):]
+		if markCov >= int(su16(markArray, 0)) || baseCov >= int(su16(baseArray, 0)) {
+			return false
+		}
+		markClass := int(su16(markArray, 2+4*markCov))
+		if markClass >= classCount {
+			return false
+		}
+		markAnchor := int(su16(markArray, 2+4*markCov+2))
+		baseAnchor := int(su16(baseArray, 2+2*(baseCov*classCount+markClass)))
+		if markAnchor == 0 || baseAnchor == 0 {
+			return false
+		}
+		mx, my := anchor(markArray, markAnchor)
+		bx, by := anchor(baseArray, baseAnchor)
+		g := &glyphs[i]
+		g.attached, g.base = true, b
+		g.dx = float64(bx-mx) * scale
+		g.dy = -float64(by-my) * scale // Font units are Y up
+		g.advance = 0
+		return true
+	}
+	return false
+}
+
+// valueSize returns the size in bytes of a ValueRecord with the given format.
+func valueSize(vf uint16) int {
+	n := 0
+	for b := vf & 0xff; b != 0; b &= b - 1 {
+		n++
+	}
+	return 2 * n
+}
+
+// applyValue adds the placement and advance adjustments of a ValueRecord to g.  Device tables are ignored.
+func applyValue(g *layoutGlyph, b []byte, off int, vf uint16, scale float64) {
+	field := func(bit uint16) float64 {
+		if vf&bit == 0 {
+			return 0
+		}
+		v := float64(si16(b, off)) * scale
+		off += 2
+		return v
+	}
+	g.dx += field(0x01)
+	g.dy -= field(0x02) // Font units are Y up
+	g.advance += field(0x04)
+}
+
+// anchor returns the x, y of the anchor table at off within b.  All anchor formats start with the same coordinates.
+func anchor(b []byte, off int) (int, int) {
+	return int(si16(b, off+2)), int(si16(b, off+4))
+}
+
+// coverageIndex returns the coverage index of glyph g, or -1 if the coverage table doesn't include it.
+func coverageIndex(c []byte, g uint16) int {
+	switch su16(c, 0) {
+	case 1:
+		n := int(su16(c, 2))
+		k := sort.Search(n, func(k int) bool { return su16(c, 4+2*k) >= g })
+		if k < n && su16(c, 4+2*k) == g {
+			return k
+		}
+	case 2:
+		n := int(su16(c, 2))
+		k := sort.Search(n, func(k int) bool { return su16(c, 4+6*k+2) >= g }) // First range ending at or after g
+		if k < n && su16(c, 4+6*k) <= g {
+			return int(su16(c, 4+6*k+4)) + int(g-su16(c, 4+6*k))
+		}
+	}
+	return -1
+}
+
+// classOf returns the class of glyph g in a ClassDef table, 0 if it isn't listed.
+func classOf(c []byte, g uint16) int {
+	switch su16(c, 0) {
+	case 1:
+		start, n := su16(c, 2), int(su16(c, 4))
+		if g >= start && int(g-start) < n {
+			return int(su16(c, 6+2*int(g-start)))
+		}
+	case 2:
+		n := int(su16(c, 2))
+		k := sort.Search(n, func(k int) bool { return su16(c, 4+6*k+2) >= g })
+		if k < n && su16(c, 4+6*k) <= g {
+			return int(su16(c, 4+6*k+4))
+		}
+	}
+	return 0
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
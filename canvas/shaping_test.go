@@ -0,0 +1,185 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+)
+
+// shapingFont loads testdata/shaping.ttf, made by testdata/mkshaping.go, which has kerning, a ligature and a mark.
+// At 1000 pixels per em, pixels are font units.
+func shapingFont(t *testing.T) (*FontCache, *truetype.Font) {
+	t.Helper()
+	data, err := ioutil.ReadFile("testdata/shaping.ttf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := NewFontCache()
+	f, err := fc.StoreData(draw2d.FontData{Name: "shaping"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fc, f
+}
+
+func glyphIndexes(run glyphRun) []truetype.Index {
+	var out []truetype.Index
+	for _, g := range run.glyphs {
+		out = append(out, g.index)
+	}
+	return out
+}
+
+func sameIndexes(a, b []truetype.Index) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestShaping(t *testing.T) {
+	fc, f := shapingFont(t)
+	tests := []struct {
+		text    string
+		shaping bool
+		glyphs  []truetype.Index
+		advance float64
+	}{
+		{"AV", true, []truetype.Index{1, 2}, 1050}, // GPOS kern of -150
+		{"AV", false, []truetype.Index{1, 2}, 1200},
+		{"VA", true, []truetype.Index{2, 1}, 1100}, // From the extension lookup's second subtable
+		{"AVA", true, []truetype.Index{1, 2, 1}, 1550},
+		{"fi", true, []truetype.Index{5}, 520}, // The latn liga, not the cyrl one that would make A
+		{"fi", false, []truetype.Index{3, 4}, 550},
+		{"Afi", true, []truetype.Index{1, 5}, 1120},
+		{"A\u0301", true, []truetype.Index{1, 6}, 600}, // The mark attaches, taking no advance
+		{"A\u0301", false, []truetype.Index{1, 6}, 800},
+	}
+	for _, tt := range tests {
+		fc.SetShaping(tt.shaping)
+		run := layoutText(fc, f, 1000, tt.text, DirectionLTR)
+		if got := glyphIndexes(run); !sameIndexes(got, tt.glyphs) {
+			t.Errorf("%q shaping %v: glyphs %v, want %v", tt.text, tt.shaping, got, tt.glyphs)
+		}
+		if run.advance != tt.advance {
+			t.Errorf("%q shaping %v: advance %v, want %v", tt.text, tt.shaping, run.advance, tt.advance)
+		}
+		if m := fc.Measure(f, 1000, tt.text); m.Advance != tt.advance {
+			t.Errorf("%q shaping %v: Measure advance %v, want %v", tt.text, tt.shaping, m.Advance, tt.advance)
+		}
+	}
+}
+
+func TestShapingExtensionLookups(t *testing.T) {
+	fc, f := shapingFont(t)
+	gpos := fc.shaping(f).features("latn").gpos
+	if len(gpos) != 2 {
+		t.Fatalf("%d GPOS lookups, want 2", len(gpos))
+	}
+	// The kern lookup is an extension lookup wrapping two pair adjustments
+	if l := gpos[0]; l.kind != 2 || len(l.subtables) != 2 {
+		t.Errorf("kern lookup type %d with %d subtables, want type 2 with 2", l.kind, len(l.subtables))
+	}
+}
+
+func TestShapedTextThroughAtlas(t *testing.T) {
+	fc, f := shapingFont(t)
+	dst := image.NewRGBA(image.Rect(0, 0, 300, 40))
+	a := NewGlyphAtlas(0)
+	for _, s := range []string{"AV", "fi", "A\u0301V"} {
+		w := a.DrawText(dst, fc, f, 20, s, 0, 30, color.Black)
+		if m := fc.Measure(f, 20, s); w != m.Advance {
+			t.Errorf("%q: DrawText advanced %v, Measure says %v", s, w, m.Advance)
+		}
+	}
+}
+
+func TestShapingMarkAnchors(t *testing.T) {
+	fc, f := shapingFont(t)
+	tests := []struct {
+		text string
+		x, y float64 // Of the mark, which is the last glyph
+	}{
+		{"A\u0301", 200, -50},       // A's anchor (300, 700) less the mark's (100, 650), Y down
+		{"Af\u0301", 600 + 50, -50}, // f's anchor (150, 700), after A
+	}
+	for _, tt := range tests {
+		run := layoutText(fc, f, 1000, tt.text, DirectionLTR)
+		m := run.glyphs[len(run.glyphs)-1]
+		if m.index != 6 || m.x != tt.x || m.y != tt.y {
+			t.Errorf("%q: mark %d at %v, %v, want 6 at %v, %v", tt.text, m.index, m.x, m.y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestShapingScripts(t *testing.T) {
+	fc, f := shapingFont(t)
+	ot := fc.shaping(f)
+	ligature := func(script string) truetype.Index {
+		glyphs := []layoutGlyph{{font: f, index: 3}, {font: f, index: 4}}
+		glyphs = ot.substitute(glyphs, script)
+		if len(glyphs) != 1 {
+			return 0
+		}
+		return glyphs[0].index
+	}
+	tests := []struct {
+		script   string
+		ligature truetype.Index // 0 for none
+		kern     bool
+	}{
+		{"latn", 5, true},
+		{"cyrl", 1, true}, // cyrl has its own liga, and no GPOS entry so uses DFLT's kern
+		{"grek", 5, true}, // No grek and no GSUB DFLT, so latn's
+		{"", 5, true},
+	}
+	for _, tt := range tests {
+		if got := ligature(tt.script); got != tt.ligature {
+			t.Errorf("%q: ligature %d, want %d", tt.script, got, tt.ligature)
+		}
+		if got := ot.features(tt.script).kern; got != tt.kern {
+			t.Errorf("%q: kern %v, want %v", tt.script, got, tt.kern)
+		}
+	}
+	if n := len(ot.features("*").gsub); n != 2 {
+		t.Errorf("all scripts: %d GSUB lookups, want 2", n)
+	}
+}
+
+func TestScriptTag(t *testing.T) {
+	tests := []struct {
+		r   rune
+		tag string
+	}{
+		{'a', "latn"}, {'Z', "latn"}, {'é', "latn"}, {'1', ""}, {' ', ""}, {'\u0301', ""},
+		{'α', "grek"}, {'ж', "cyrl"}, {'ש', "hebr"}, {'ب', "arab"}, {'中', "hani"}, {'か', "kana"}, {'ሀ', "DFLT"},
+	}
+	for _, tt := range tests {
+		if got := scriptTag(tt.r); got != tt.tag {
+			t.Errorf("scriptTag(%q) = %q, want %q", tt.r, got, tt.tag)
+		}
+	}
+}
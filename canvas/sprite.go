@@ -0,0 +1,292 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/llgcode/draw2d"
+)
+
+// SpriteSheet is an atlas image holding many sprites, with the frame of each.
+// Load one exported by TexturePacker or Aseprite with ParseSpriteSheet, or pack loose images into one with PackSpriteSheet.
+type SpriteSheet struct {
+	image  *image.RGBA
+	frames []*SpriteFrame
+	names  map[string]*SpriteFrame
+	tags   []SpriteTag
+}
+
+// SpriteFrame is one sprite in a sheet.  Transparent borders may have been trimmed off when the sheet was packed;
+// Trim and Size keep where it was, so trimmed sprites still draw in the right place.
+type SpriteFrame struct {
+	Name     string
+	Rect     image.Rectangle // The frame's pixels in the sheet image
+	Rotated  bool            // The frame is stored turned 90° clockwise, so Rect is as wide as Trim is high
+	Trim     image.Rectangle // Where the stored pixels go in the untrimmed sprite
+	Size     image.Point     // Size of the untrimmed sprite
+	PivotX   float64         // The point drawn at the sprite's position, as a fraction of Size; 0, 0 is the top left
+	PivotY   float64
+	Duration time.Duration // How long the frame shows for in an animation, from Aseprite; 0 if not given
+}
+
+// SpriteTag is a named run of frames, From to To inclusive, as Aseprite's frame tags.
+type SpriteTag struct {
+	Name      string
+	From, To  int
+	Direction string // "forward", "reverse" or "pingpong"
+}
+
+// NewSpriteSheet makes a sheet from an atlas image and its frames.  The image is converted to RGBA if it isn't already.
+func NewSpriteSheet(img image.Image, frames []*SpriteFrame, tags []SpriteTag) (*SpriteSheet, error) {
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		b := img.Bounds()
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	}
+	s := &SpriteSheet{image: rgba, names: make(map[string]*SpriteFrame)}
+	for _, f := range frames {
+		if !f.Rect.In(rgba.Rect) {
+			return nil, fmt.Errorf("canvas: sprite %q at %v is outside the %v sheet image", f.Name, f.Rect, rgba.Rect.Size())
+		}
+		s.frames = append(s.frames, f)
+		s.names[f.Name] = f
+	}
+	for _, t := range tags {
+		if t.From < 0 || t.To >= len(frames) || t.From > t.To {
+			return nil, fmt.Errorf("canvas: sprite tag %q runs from frame %d to %d of %d", t.Name, t.From, t.To, len(frames))
+		}
+	}
+	s.tags = append(s.tags, tags...)
+	return s, nil
+}
+
+// Get the sheet's image
+func (s *SpriteSheet) Image() *image.RGBA {
+	return s.image
+}
+
+// Frame returns the named frame, or nil if there isn't one.
+func (s *SpriteSheet) Frame(name string) *SpriteFrame {
+	return s.names[name]
+}
+
+// Frames returns the frames in the order of the sheet's description.
+func (s *SpriteSheet) Frames() []*SpriteFrame {
+	return s.frames
+}
+
+// Tags returns the named runs of frames.
+func (s *SpriteSheet) Tags() []SpriteTag {
+	return s.tags
+}
+
+// Tag returns the named run of frames.
+func (s *SpriteSheet) Tag(name string) (SpriteTag, bool) {
+	for _, t := range s.tags {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return SpriteTag{}, false
+}
+
+// transform returns the matrix from the frame's pixels in the sheet to sprite space, where the pivot is at the origin.
+func (f *SpriteFrame) transform() draw2d.Matrix {
+	tr := draw2d.NewTranslationMatrix(float64(f.Trim.Min.X)-f.PivotX*float64(f.Size.X), float64(f.Trim.Min.Y)-f.PivotY*float64(f.Size.Y))
+	if f.Rotated {
+		tr.Compose(draw2d.Matrix{0, -1, 1, 0, 0, float64(f.Trim.Dy())}) // Turn back 90° anticlockwise
+	}
+	return tr
+}
+
+// drawSprite draws frame f of s with its pivot at the origin of tr, on top of the graphic context's transform.
+func (p *painter) drawSprite(s *SpriteSheet, f *SpriteFrame, tr draw2d.Matrix, opacity float64) {
+	m := tr.Copy()
+	m.Compose(f.transform())
+	p.drawImage(s.image, f.Rect, m, opacity)
+}
+
+// The JSON written by TexturePacker (JSON hash and JSON array formats) and Aseprite
+type spriteJSON struct {
+	Frames json.RawMessage `json:"frames"`
+	Meta   spriteMetaJSON  `json:"meta"`
+}
+
+type spriteMetaJSON struct {
+	App       string          `json:"app,omitempty"`
+	Image     string          `json:"image"`
+	Size      spriteSizeJSON  `json:"size"`
+	FrameTags []spriteTagJSON `json:"frameTags,omitempty"`
+}
+
+type spriteFrameJSON struct {
+	Filename         string           `json:"filename"`
+	Frame            spriteRectJSON   `json:"frame"`
+	Rotated          bool             `json:"rotated"`
+	Trimmed          bool             `json:"trimmed"`
+	SpriteSourceSize spriteRectJSON   `json:"spriteSourceSize"`
+	SourceSize       spriteSizeJSON   `json:"sourceSize"`
+	Pivot            *spritePivotJSON `json:"pivot,omitempty"`
+	Duration         int              `json:"duration,omitempty"` // Milliseconds
+}
+
+type spriteRectJSON struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type spriteSizeJSON struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type spritePivotJSON struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type spriteTagJSON struct {
+	Name      string `json:"name"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Direction string `json:"direction"`
+}
+
+// ParseSpriteSheet reads a sprite sheet's frames from TexturePacker JSON (hash or array) or Aseprite JSON, for the atlas image img.
+// Aseprite frame durations and frame tags are kept; slices are ignored.
+func ParseSpriteSheet(img image.Image, r io.Reader) (*SpriteSheet, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var sj spriteJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return nil, fmt.Errorf("canvas: bad sprite sheet JSON: %v", err)
+	}
+	fjs, err := spriteFramesJSON(sj.Frames)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]*SpriteFrame, len(fjs))
+	for i, fj := range fjs {
+		w, h := fj.Frame.W, fj.Frame.H
+		f := &SpriteFrame{
+			Name:     fj.Filename,
+			Rect:     image.Rect(fj.Frame.X, fj.Frame.Y, fj.Frame.X+w, fj.Frame.Y+h),
+			Rotated:  fj.Rotated,
+			Trim:     image.Rect(0, 0, w, h),
+			Size:     image.Pt(w, h),
+			Duration: time.Duration(fj.Duration) * time.Millisecond,
+		}
+		if fj.Rotated {
+			f.Rect.Max = image.Pt(fj.Frame.X+h, fj.Frame.Y+w) // Stored turned, so as wide as it is high
+		}
+		if fj.SourceSize.W > 0 && fj.SourceSize.H > 0 {
+			f.Size = image.Pt(fj.SourceSize.W, fj.SourceSize.H)
+			f.Trim = image.Rect(fj.SpriteSourceSize.X, fj.SpriteSourceSize.Y, fj.SpriteSourceSize.X+w, fj.SpriteSourceSize.Y+h)
+		}
+		if fj.Pivot != nil {
+			f.PivotX, f.PivotY = fj.Pivot.X, fj.Pivot.Y
+		}
+		frames[i] = f
+	}
+	var tags []SpriteTag
+	for _, t := range sj.Meta.FrameTags {
+		tags = append(tags, SpriteTag{t.Name, t.From, t.To, t.Direction})
+	}
+	return NewSpriteSheet(img, frames, tags)
+}
+
+// spriteFramesJSON decodes the frames as either an array or an object keyed by name, keeping the order they are written in,
+// which Aseprite's frame tags count by.
+func spriteFramesJSON(raw json.RawMessage) ([]spriteFrameJSON, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var fjs []spriteFrameJSON
+		if err := json.Unmarshal(raw, &fjs); err != nil {
+			return nil, fmt.Errorf("canvas: bad sprite sheet frames: %v", err)
+		}
+		return fjs, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("canvas: sprite sheet has no frames")
+	}
+	var fjs []spriteFrameJSON
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("canvas: bad sprite sheet frames: %v", err)
+		}
+		var fj spriteFrameJSON
+		if err := dec.Decode(&fj); err != nil {
+			return nil, fmt.Errorf("canvas: bad sprite sheet frame %q: %v", t, err)
+		}
+		fj.Filename = t.(string)
+		fjs = append(fjs, fj)
+	}
+	return fjs, nil
+}
+
+// WriteJSON writes the sheet's frames out as TexturePacker JSON (array format), naming imageName as the atlas image.
+// ParseSpriteSheet reads it back, as do most game engines.
+func (s *SpriteSheet) WriteJSON(w io.Writer, imageName string) error {
+	fjs := make([]spriteFrameJSON, len(s.frames))
+	for i, f := range s.frames {
+		fj := spriteFrameJSON{
+			Filename:         f.Name,
+			Frame:            spriteRectJSON{f.Rect.Min.X, f.Rect.Min.Y, f.Trim.Dx(), f.Trim.Dy()},
+			Rotated:          f.Rotated,
+			Trimmed:          f.Trim != image.Rect(0, 0, f.Size.X, f.Size.Y),
+			SpriteSourceSize: spriteRectJSON{f.Trim.Min.X, f.Trim.Min.Y, f.Trim.Dx(), f.Trim.Dy()},
+			SourceSize:       spriteSizeJSON{f.Size.X, f.Size.Y},
+			Duration:         int(f.Duration / time.Millisecond),
+		}
+		if f.PivotX != 0 || f.PivotY != 0 {
+			fj.Pivot = &spritePivotJSON{f.PivotX, f.PivotY}
+		}
+		fjs[i] = fj
+	}
+	frames, err := json.Marshal(fjs)
+	if err != nil {
+		return err
+	}
+	sj := spriteJSON{Frames: frames, Meta: spriteMetaJSON{
+		App:   "https://github.com/markfarnan/go-canvas",
+		Image: imageName,
+		Size:  spriteSizeJSON{s.image.Rect.Dx(), s.image.Rect.Dy()},
+	}}
+	for _, t := range s.tags {
+		sj.Meta.FrameTags = append(sj.Meta.FrameTags, spriteTagJSON{t.Name, t.From, t.To, t.Direction})
+	}
+	out, err := json.MarshalIndent(sj, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
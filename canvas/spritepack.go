@@ -0,0 +1,170 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// PackOptions controls how PackSpriteSheet lays sprites out.
+type PackOptions struct {
+	Padding    int  // Transparent pixels left between sprites, so smoothing doesn't bleed neighbours in
+	Trim       bool // Cut transparent borders off the sprites, keeping where they were as trim data
+	MaxWidth   int  // Widest the sheet may be; 0 means 4096
+	PowerOfTwo bool // Make the sheet's sides powers of two, for WebGL textures
+}
+
+// PackSpriteSheet packs images into one sheet, named by names, in the same order.
+// Sprites are placed in rows, tallest first, trying a few sheet widths and keeping whichever gives the smallest sheet.
+func PackSpriteSheet(names []string, imgs []image.Image, opts PackOptions) (*SpriteSheet, error) {
+	if len(names) != len(imgs) {
+		return nil, errors.New("canvas: sprite names and images don't match up")
+	}
+	maxWidth := opts.MaxWidth
+	if maxWidth <= 0 {
+		maxWidth = 4096
+	}
+	pad := opts.Padding
+	if pad < 0 {
+		pad = 0
+	}
+
+	frames := make([]*SpriteFrame, len(imgs))
+	area, widest := 0, 0
+	for i, img := range imgs {
+		b := img.Bounds()
+		trim := b
+		if opts.Trim {
+			trim = opaqueBounds(img)
+		}
+		frames[i] = &SpriteFrame{
+			Name: names[i],
+			Trim: trim.Sub(b.Min),
+			Size: b.Size(),
+		}
+		if trim.Dx()+pad > maxWidth {
+			return nil, fmt.Errorf("canvas: sprite %q is wider than the %d pixel sheet", names[i], maxWidth)
+		}
+		area += (trim.Dx() + pad) * (trim.Dy() + pad)
+		if trim.Dx()+pad > widest {
+			widest = trim.Dx() + pad
+		}
+	}
+
+	// Tallest first, then widest, keeps the rows even
+	order := make([]int, len(frames))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, tb := frames[order[a]].Trim, frames[order[b]].Trim
+		if ta.Dy() != tb.Dy() {
+			return ta.Dy() > tb.Dy()
+		}
+		return ta.Dx() > tb.Dx()
+	})
+
+	widths := []int{widest, int(math.Ceil(math.Sqrt(float64(area))))}
+	for w := 64; w <= maxWidth; w *= 2 {
+		widths = append(widths, w)
+	}
+	best, bestSize := []image.Point(nil), image.Point{}
+	for _, w := range widths {
+		if w < widest || w > maxWidth {
+			continue
+		}
+		pos, size := shelfPack(frames, order, w, pad)
+		if opts.PowerOfTwo {
+			size = image.Pt(nextPow2(size.X), nextPow2(size.Y))
+		}
+		if best == nil || size.X*size.Y < bestSize.X*bestSize.Y ||
+			(size.X*size.Y == bestSize.X*bestSize.Y && absInt(size.X-size.Y) < absInt(bestSize.X-bestSize.Y)) {
+			best, bestSize = pos, size
+		}
+	}
+
+	sheet := image.NewRGBA(image.Rectangle{Max: bestSize})
+	for i, f := range frames {
+		f.Rect = image.Rectangle{best[i], best[i].Add(f.Trim.Size())}
+		draw.Draw(sheet, f.Rect, imgs[i], imgs[i].Bounds().Min.Add(f.Trim.Min), draw.Src)
+	}
+	return NewSpriteSheet(sheet, frames, nil)
+}
+
+// shelfPack places the frames, in order, in rows across a sheet w wide, returning where each went and the size of sheet used.
+func shelfPack(frames []*SpriteFrame, order []int, w, pad int) ([]image.Point, image.Point) {
+	pos := make([]image.Point, len(frames))
+	x, y, rowH, used := 0, 0, 0, 0
+	for _, i := range order {
+		s := frames[i].Trim.Size()
+		if x > 0 && x+s.X > w {
+			x, y, rowH = 0, y+rowH+pad, 0
+		}
+		pos[i] = image.Pt(x, y)
+		x += s.X + pad
+		if s.Y > rowH {
+			rowH = s.Y
+		}
+		if x-pad > used {
+			used = x - pad
+		}
+	}
+	return pos, image.Pt(used, y+rowH)
+}
+
+// opaqueBounds returns the smallest rectangle of img holding all its pixels that aren't fully transparent.
+func opaqueBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	r := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+				r.Min.X, r.Max.X = minInt(r.Min.X, x), maxInt(r.Max.X, x+1)
+				r.Min.Y, r.Max.Y = minInt(r.Min.Y, y), maxInt(r.Max.Y, y+1)
+			}
+		}
+	}
+	if r.Empty() {
+		return image.Rectangle{Min: b.Min, Max: b.Min}
+	}
+	return r
+}
+
+func nextPow2(n int) int {
+	p := 1
+	for p < n {
+		p *= 2
+	}
+	return p
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,369 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+)
+
+// SubsetFont returns a copy of a TrueType font keeping only the outlines needed to draw runes.
+// Glyph ids are left as they are, so the shaping and metrics tables stay valid, and ligatures, accents made of
+// composite glyphs, and alternates reached through the shaping features the canvas applies are kept too.
+// The cmap is rewritten to only map runes, so anything else falls through to the FontCache fallback chain.
+// Glyph names and the outlines of every other glyph are dropped, which is where nearly all of the size is.
+func SubsetFont(data []byte, runes []rune) ([]byte, error) {
+	s, err := parseSFNT(data)
+	if err != nil {
+		return nil, err
+	}
+	tf, err := truetype.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	head, loca, glyf := s.table("head"), s.table("loca"), s.table("glyf")
+	if len(head) < 54 || loca == nil || glyf == nil {
+		return nil, errors.New("canvas: can only subset fonts with TrueType outlines")
+	}
+	numGlyphs := 0
+	if maxp := s.table("maxp"); len(maxp) >= 6 {
+		numGlyphs = int(u16(maxp, 4))
+	}
+	offsets, err := parseLoca(loca, int(si16(head, 50)), numGlyphs, len(glyf))
+	if err != nil {
+		return nil, err
+	}
+
+	// Glyphs reached directly from the runes, then everything they lead to
+	keep := map[truetype.Index]bool{0: true} // .notdef is always drawn for missing glyphs
+	cmap := make(map[rune]truetype.Index)
+	for _, r := range runes {
+		if i := tf.Index(r); i != 0 {
+			keep[i] = true
+			cmap[r] = i
+		}
+	}
+	closeGlyphs(s, keep, glyf, offsets)
+
+	// New glyf and loca, with empty entries for dropped glyphs
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for i := 0; i < numGlyphs; i++ {
+		binary.BigEndian.PutUint32(newLoca[4*i:], uint32(len(newGlyf)))
+		if keep[truetype.Index(i)] {
+			newGlyf = append(newGlyf, glyf[offsets[i]:offsets[i+1]]...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+
+	tables := make(map[string][]byte, len(s.tables))
+	for tag, t := range s.tables {
+		tables[tag] = t
+	}
+	tables["glyf"], tables["loca"] = newGlyf, newLoca
+	tables["cmap"] = buildCmap(cmap)
+	newHead := append([]byte(nil), head...)
+	binary.BigEndian.PutUint16(newHead[50:], 1) // Long loca offsets
+	tables["head"] = newHead
+	if post := s.table("post"); len(post) >= 32 {
+		newPost := append([]byte(nil), post[:32]...)
+		binary.BigEndian.PutUint32(newPost, 0x00030000) // Version 3, no glyph names
+		tables["post"] = newPost
+	}
+	// Bitmap and SVG glyph tables would carry every glyph, so only outline colour (COLR) survives
+	for _, tag := range []string{"CBDT", "CBLC", "sbix", "SVG ", "EBDT", "EBLC", "EBSC", "hdmx", "LTSH", "VDMX", "DSIG"} {
+		delete(tables, tag)
+	}
+	return writeSFNT(u32(data, 0), tables), nil
+}
+
+// parseLoca returns the numGlyphs+1 glyph offsets into glyf, for short (0) or long (1) loca formats.
+func parseLoca(loca []byte, format, numGlyphs, glyfLen int) ([]int, error) {
+	offsets := make([]int, numGlyphs+1)
+	for i := range offsets {
+		if format == 0 {
+			if 2*i+2 > len(loca) {
+				return nil, errBadSFNT
+			}
+			offsets[i] = 2 * int(u16(loca, 2*i))
+		} else {
+			if 4*i+4 > len(loca) {
+				return nil, errBadSFNT
+			}
+			offsets[i] = int(u32(loca, 4*i))
+		}
+		if offsets[i] > glyfLen || (i > 0 && offsets[i] < offsets[i-1]) {
+			return nil, errBadSFNT
+		}
+	}
+	return offsets, nil
+}
+
+// closeGlyphs adds to keep every glyph the kept ones can turn into or be built from, until nothing changes:
+// composite glyph components, GSUB substitutions for the features the canvas shapes with, and COLR layers.
+func closeGlyphs(s *sfntFont, keep map[truetype.Index]bool, glyf []byte, offsets []int) {
+	ot := s.layout()
+	colors := s.colors()
+	for {
+		before := len(keep)
+		for g := range keep {
+			if int(g) < len(offsets)-1 {
+				for _, c := range compositeComponents(glyf[offsets[g]:offsets[g+1]]) {
+					keep[c] = true
+				}
+			}
+			for _, l := range colors.layers(g) {
+				keep[l.index] = true
+			}
+		}
+		for _, l := range ot.features("*").gsub {
+			for _, st := range l.subtables {
+				closeSubstitution(l.kind, st, keep)
+			}
+		}
+		if len(keep) == before {
+			return
+		}
+	}
+}
+
+// closeSubstitution adds the output glyphs of a GSUB subtable whose input is entirely kept.
+func closeSubstitution(kind uint16, st []byte, keep map[truetype.Index]bool) {
+	cov := st[minInt(int(su16(st, 2)), len(st)):]
+	format := su16(st, 0)
+	var add []truetype.Index
+	for g := range keep {
+		c := coverageIndex(cov, uint16(g))
+		if c < 0 {
+			continue
+		}
+		switch {
+		case kind == 1 && format == 1:
+			add = append(add, truetype.Index(int(g)+int(si16(st, 4))))
+		case kind == 1 && format == 2:
+			if c < int(su16(st, 4)) {
+				add = append(add, truetype.Index(su16(st, 6+2*c)))
+			}
+		case kind == 2 && format == 1:
+			if c < int(su16(st, 4)) {
+				seq := st[minInt(int(su16(st, 6+2*c)), len(st)):]
+				for k, n := 0, int(su16(seq, 0)); k < n; k++ {
+					add = append(add, truetype.Index(su16(seq, 2+2*k)))
+				}
+			}
+		case kind == 4 && format == 1:
+			if c >= int(su16(st, 4)) {
+				continue
+			}
+			set := st[minInt(int(su16(st, 6+2*c)), len(st)):]
+			for k, n := 0, int(su16(set, 0)); k < n; k++ {
+				lig := set[minInt(int(su16(set, 2+2*k)), len(set)):]
+				all := true
+				for j, comps := 0, int(su16(lig, 2)); j < comps-1; j++ {
+					all = all && keep[truetype.Index(su16(lig, 4+2*j))]
+				}
+				if all {
+					add = append(add, truetype.Index(su16(lig, 0)))
+				}
+			}
+		}
+	}
+	for _, g := range add {
+		keep[g] = true
+	}
+}
+
+// compositeComponents returns the glyphs a composite glyph is built from, or nil for a simple glyph.
+func compositeComponents(g []byte) []truetype.Index {
+	if len(g) < 10 || si16(g, 0) >= 0 {
+		return nil
+	}
+	var out []truetype.Index
+	for p := 10; p+4 <= len(g); {
+		flags := u16(g, p)
+		out = append(out, truetype.Index(u16(g, p+2)))
+		p += 4
+		if flags&0x0001 != 0 { // Word arguments
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // Scale
+			p += 2
+		case flags&0x0040 != 0: // X and Y scale
+			p += 4
+		case flags&0x0080 != 0: // 2x2 matrix
+			p += 8
+		}
+		if flags&0x0020 == 0 { // No more components
+			break
+		}
+	}
+	return out
+}
+
+// buildCmap writes a cmap with a format 4 subtable for the Basic Multilingual Plane, plus format 12 if any runes are above it.
+func buildCmap(m map[rune]truetype.Index) []byte {
+	runes := make([]rune, 0, len(m))
+	for r := range m {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(a, b int) bool { return runes[a] < runes[b] })
+
+	// Runs of consecutive runes mapping to consecutive glyphs
+	type span struct {
+		start, end rune
+		glyph      truetype.Index
+	}
+	var spans []span
+	for _, r := range runes {
+		if n := len(spans); n > 0 && spans[n-1].end == r-1 && spans[n-1].glyph+truetype.Index(r-spans[n-1].start) == m[r] &&
+			(r <= 0xffff) == (spans[n-1].start <= 0xffff) {
+			spans[n-1].end = r
+			continue
+		}
+		spans = append(spans, span{r, r, m[r]})
+	}
+
+	// Format 4: segments with an idDelta, ending with the required 0xffff segment
+	var bmp []span
+	for _, sp := range spans {
+		if sp.start <= 0xffff && sp.end < 0xffff {
+			bmp = append(bmp, sp)
+		}
+	}
+	segs := len(bmp) + 1
+	f4 := make([]byte, 16+8*segs)
+	put16 := func(b []byte, i int, v uint16) { binary.BigEndian.PutUint16(b[i:], v) }
+	put16(f4, 0, 4)
+	put16(f4, 2, uint16(len(f4)))
+	put16(f4, 6, uint16(2*segs))
+	searchRange := 2
+	for searchRange*2 <= 2*segs {
+		searchRange *= 2
+	}
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= segs {
+		entrySelector++
+	}
+	put16(f4, 8, uint16(searchRange))
+	put16(f4, 10, uint16(entrySelector))
+	put16(f4, 12, uint16(2*segs-searchRange))
+	ends, starts, deltas := 14, 16+2*segs, 16+4*segs
+	for i, sp := range bmp {
+		put16(f4, ends+2*i, uint16(sp.end))
+		put16(f4, starts+2*i, uint16(sp.start))
+		put16(f4, deltas+2*i, uint16(int(sp.glyph)-int(sp.start)))
+	}
+	put16(f4, ends+2*len(bmp), 0xffff)
+	put16(f4, starts+2*len(bmp), 0xffff)
+	put16(f4, deltas+2*len(bmp), 1)
+
+	// Format 12 has every span, for fonts with runes past the BMP
+	var f12 []byte
+	if len(bmp) != len(spans) {
+		f12 = make([]byte, 16+12*len(spans))
+		put16(f12, 0, 12)
+		binary.BigEndian.PutUint32(f12[4:], uint32(len(f12)))
+		binary.BigEndian.PutUint32(f12[12:], uint32(len(spans)))
+		for i, sp := range spans {
+			o := 16 + 12*i
+			binary.BigEndian.PutUint32(f12[o:], uint32(sp.start))
+			binary.BigEndian.PutUint32(f12[o+4:], uint32(sp.end))
+			binary.BigEndian.PutUint32(f12[o+8:], uint32(sp.glyph))
+		}
+	}
+
+	// Windows Unicode BMP (3, 1) and, if needed, full repertoire (3, 10)
+	n := 1
+	if f12 != nil {
+		n = 2
+	}
+	out := make([]byte, 4+8*n)
+	put16(out, 2, uint16(n))
+	put16(out, 4, 3)
+	put16(out, 6, 1)
+	binary.BigEndian.PutUint32(out[8:], uint32(len(out)))
+	if f12 != nil {
+		put16(out, 12, 3)
+		put16(out, 14, 10)
+		binary.BigEndian.PutUint32(out[16:], uint32(len(out)+len(f4)))
+	}
+	out = append(out, f4...)
+	return append(out, f12...)
+}
+
+// writeSFNT assembles a font file from its tables, with the directory, padding and checksums the spec asks for.
+func writeSFNT(version uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= n {
+		searchRange *= 2
+		entrySelector++
+	}
+	out := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(out, version)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(16*searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(16*(n-searchRange)))
+
+	headAt := -1
+	for i, tag := range tags {
+		t := tables[tag]
+		if tag == "head" {
+			t = append([]byte(nil), t...)
+			binary.BigEndian.PutUint32(t[8:], 0) // checkSumAdjustment is worked out once the file is complete
+			headAt = len(out)
+		}
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], sfntChecksum(t))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t)))
+		out = append(out, t...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	if headAt >= 0 {
+		binary.BigEndian.PutUint32(out[headAt+8:], 0xb1b0afba-sfntChecksum(out))
+	}
+	return out
+}
+
+// sfntChecksum sums a table as big endian uint32s, padded with zeros.
+func sfntChecksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var w [4]byte
+		copy(w[:], b[i:])
+		sum += binary.BigEndian.Uint32(w[:])
+	}
+	return sum
+}
@@ -0,0 +1,190 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"image"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dimg"
+)
+
+// Surface is an offscreen image with its own graphic context.  Draw static parts of a scene (grids, legends, backgrounds)
+// on one once, then draw the surface onto the canvas each frame, which is a straight copy when it isn't scaled or turned.
+type Surface struct {
+	image   *image.RGBA
+	gc      *draw2dimg.GraphicContext
+	painter *painter
+	fonts   *FontCache
+}
+
+// NewSurface returns a transparent surface of the given size, drawing text with fonts, which may be nil.
+// Canvas2d.NewSurface shares the canvas's fonts.
+func NewSurface(width, height int, fonts *FontCache) *Surface {
+	s := &Surface{image: image.NewRGBA(image.Rect(0, 0, width, height)), fonts: fonts}
+	s.init()
+	return s
+}
+
+// init gives the surface a fresh graphic context and drawing state.
+func (s *Surface) init() {
+	var layer *image.RGBA
+	if s.painter != nil {
+		layer = s.painter.layer
+	}
+	s.gc, s.painter = newGraphicContext(s.image)
+	if s.fonts != nil {
+		s.gc.FontCache = s.fonts
+	}
+	if layer != nil && cap(layer.Pix) >= len(s.image.Pix) {
+		s.painter.layer = resizeRGBA(layer, s.image.Rect.Dx(), s.image.Rect.Dy()) // Left clear by the last flush
+	}
+}
+
+// Get the Drawing context for the surface
+func (s *Surface) Gc() *draw2dimg.GraphicContext {
+	return s.gc
+}
+
+// Get the surface's image, with its top left corner at 0, 0
+func (s *Surface) Image() *image.RGBA {
+	return s.image
+}
+
+func (s *Surface) Width() int {
+	return s.image.Rect.Dx()
+}
+
+func (s *Surface) Height() int {
+	return s.image.Rect.Dy()
+}
+
+// Clear makes the whole surface transparent, leaving the drawing state alone.
+func (s *Surface) Clear() {
+	for i := range s.image.Pix {
+		s.image.Pix[i] = 0
+	}
+}
+
+// Save pushes the drawing state, that of the graphic context along with the global alpha, composite operation, shadow, clip and image quality.
+func (s *Surface) Save() {
+	s.gc.Save()
+	s.painter.save()
+}
+
+// Restore pops the drawing state pushed by Save.
+func (s *Surface) Restore() {
+	s.gc.Restore()
+	s.painter.restore()
+}
+
+// Set the opacity, from 0 to 1, applied to everything drawn on the surface.
+func (s *Surface) SetGlobalAlpha(alpha float64) {
+	s.painter.alpha = clamp01(alpha)
+}
+
+// Set how drawing is combined with the surface, as Canvas2d.SetCompositeOperation.
+func (s *Surface) SetCompositeOperation(op CompositeOp) {
+	s.painter.op = op
+}
+
+// Set how images and surfaces drawn on this one are resampled when scaled or turned.
+func (s *Surface) SetImageQuality(q ImageQuality) {
+	s.painter.quality = q
+}
+
+// DrawImage draws img with its top left corner at x, y, through the surface's transform, as Canvas2d.DrawImage.
+func (s *Surface) DrawImage(img image.Image, x, y float64) {
+	s.painter.drawImage(img, img.Bounds(), draw2d.NewTranslationMatrix(x, y), 1)
+}
+
+// DrawSurface draws o onto this surface, placed by tr on top of the current transform, with opacity multiplying the global alpha.
+func (s *Surface) DrawSurface(o *Surface, tr draw2d.Matrix, opacity float64) {
+	s.painter.drawImage(o.image, o.image.Rect, tr, opacity)
+}
+
+// DrawSprite draws the named frame of sheet with its pivot at x, y, as Canvas2d.DrawSprite.
+func (s *Surface) DrawSprite(sheet *SpriteSheet, name string, x, y float64) {
+	if f := sheet.Frame(name); f != nil {
+		s.painter.drawSprite(sheet, f, draw2d.NewTranslationMatrix(x, y), 1)
+	}
+}
+
+// Default limit on the pixel memory a SurfacePool keeps
+const DefaultSurfacePoolBytes = 64 << 20
+
+// SurfacePool keeps surfaces that are finished with, to hand out again, so short lived surfaces don't make garbage
+// for the wasm garbage collector to chase.  A pooled surface of the right size is reused whole; otherwise the pixel memory
+// of a bigger one is.
+type SurfacePool struct {
+	MaxBytes int // Pixel memory kept for reuse; 0 means DefaultSurfacePoolBytes
+
+	fonts *FontCache
+	free  []*Surface
+	bytes int
+}
+
+// NewSurfacePool returns an empty pool handing out surfaces drawing text with fonts.
+func NewSurfacePool(fonts *FontCache) *SurfacePool {
+	return &SurfacePool{fonts: fonts}
+}
+
+// Get returns a transparent surface of the given size, with a fresh drawing state.
+func (p *SurfacePool) Get(width, height int) *Surface {
+	need, best := 4*width*height, -1
+	for i, s := range p.free {
+		if s.Width() == width && s.Height() == height {
+			best = i
+			break
+		}
+		if c := cap(s.image.Pix); c >= need && (best < 0 || c < cap(p.free[best].image.Pix)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return NewSurface(width, height, p.fonts)
+	}
+	s := p.free[best]
+	p.free = append(p.free[:best], p.free[best+1:]...)
+	p.bytes -= cap(s.image.Pix)
+	s.image = resizeRGBA(s.image, width, height)
+	s.Clear()
+	s.fonts = p.fonts
+	s.init()
+	return s
+}
+
+// Put hands a surface back for reuse.  It must not be used afterwards.  If the pool is full it is left for the garbage collector.
+func (p *SurfacePool) Put(s *Surface) {
+	limit := p.MaxBytes
+	if limit <= 0 {
+		limit = DefaultSurfacePoolBytes
+	}
+	if s == nil || p.bytes+cap(s.image.Pix) > limit {
+		return
+	}
+	p.free = append(p.free, s)
+	p.bytes += cap(s.image.Pix)
+}
+
+// Release drops all the pooled surfaces.
+func (p *SurfacePool) Release() {
+	p.free, p.bytes = nil, 0
+}
+
+// resizeRGBA returns m remade as a width x height image on the same pixel memory, which must be big enough.
+func resizeRGBA(m *image.RGBA, width, height int) *image.RGBA {
+	return &image.RGBA{Pix: m.Pix[:4*width*height], Stride: 4 * width, Rect: image.Rect(0, 0, width, height)}
+}
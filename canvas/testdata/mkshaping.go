@@ -0,0 +1,277 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+//go:build ignore
+// +build ignore
+
+// mkshaping writes shaping.ttf, a tiny font for the shaping tests, as none of the fonts in the repo have GPOS tables.
+// Glyphs are boxes.  1000 units per em.
+//
+//	gid  glyph      rune    advance
+//	0    .notdef            500
+//	1    A          U+0041  600
+//	2    V          U+0056  600
+//	3    f          U+0066  300
+//	4    i          U+0069  250
+//	5    f_i                520
+//	6    acutecomb  U+0301  200
+//
+// GSUB: liga f i -> f_i under latn, and a decoy liga f i -> A under cyrl only.  No DFLT script.
+// GPOS: kern A V -150 and V A -100 on the first glyph's advance, as two subtables of one extension lookup,
+// and mark to base for acutecomb on A and f, both under DFLT and latn.
+// GDEF: f_i is a ligature, acutecomb a mark, the rest bases.
+//
+//	go run testdata/mkshaping.go
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"sort"
+)
+
+var advances = []int{500, 600, 600, 300, 250, 520, 200}
+
+func main() {
+	tables := map[string][]byte{
+		"head": head(),
+		"hhea": hhea(),
+		"maxp": maxp(),
+		"hmtx": hmtx(),
+		"cmap": cmap(),
+		"GSUB": gsub(),
+		"GPOS": gpos(),
+		"GDEF": gdef(),
+	}
+	tables["loca"], tables["glyf"] = glyf()
+	if err := ioutil.WriteFile("testdata/shaping.ttf", sfnt(tables), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// b builds big endian data from uint16s (ints), int16s, uint32s and byte slices.
+func b(vs ...interface{}) []byte {
+	var out []byte
+	for _, v := range vs {
+		switch v := v.(type) {
+		case int:
+			out = append(out, byte(v>>8), byte(v))
+		case uint32:
+			out = append(out, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		case string:
+			out = append(out, v...)
+		case []byte:
+			out = append(out, v...)
+		}
+	}
+	return out
+}
+
+func head() []byte {
+	return b(uint32(0x00010000), uint32(0x00010000), uint32(0), uint32(0x5F0F3CF5), 0x000B, 1000,
+		uint32(0), uint32(0), uint32(0), uint32(0), // created, modified
+		0, 0, 600, 900, // bbox
+		0, 8, 2, 0, 0) // macStyle, lowestRecPPEM, direction hint, short loca, glyph data format
+}
+
+func hhea() []byte {
+	return b(uint32(0x00010000), 800, -200&0xffff, 0, 600, 0, 0, 600, 1, 0, 0, 0, 0, 0, 0, 0, len(advances))
+}
+
+func maxp() []byte {
+	m := b(uint32(0x00010000), len(advances), 4, 1)
+	return append(m, make([]byte, 32-len(m))...)
+}
+
+func hmtx() []byte {
+	var out []byte
+	for _, a := range advances {
+		out = append(out, b(a, 0)...)
+	}
+	return out
+}
+
+func cmap() []byte {
+	runes := []int{0x41, 0x56, 0x66, 0x69, 0x301, 0xffff}
+	gids := []int{1, 2, 3, 4, 6, 0}
+	n := len(runes)
+	var ends, starts, deltas, ranges []byte
+	for i, r := range runes {
+		ends = append(ends, b(r)...)
+		starts = append(starts, b(r)...)
+		delta := (gids[i] - r) & 0xffff
+		if r == 0xffff {
+			delta = 1
+		}
+		deltas = append(deltas, b(delta)...)
+		ranges = append(ranges, b(0)...)
+	}
+	sub := b(4, 0, 0, 2*n, 8, 2, 2*n-8, ends, 0, starts, deltas, ranges)
+	binary.BigEndian.PutUint16(sub[2:], uint16(len(sub)))
+	return b(0, 1, 3, 1, uint32(12), sub)
+}
+
+// glyf gives every glyph a box, the acute sitting high up.
+func glyf() ([]byte, []byte) {
+	var loca, glyf []byte
+	for i, a := range advances {
+		loca = append(loca, b(len(glyf)/2)...)
+		x0, y0, x1, y1 := 50, 0, a-50, 700
+		if i == 6 {
+			x0, y0, x1, y1 = 50, 750, 150, 900
+		}
+		glyf = append(glyf, b(1, x0, y0, x1, y1, 3, 0)...)
+		glyf = append(glyf, 1, 1, 1, 1)
+		glyf = append(glyf, b(x0, x1-x0, 0, x0-x1)...)
+		glyf = append(glyf, b(y0, 0, y1-y0, 0)...)
+	}
+	loca = append(loca, b(len(glyf)/2)...)
+	return loca, glyf
+}
+
+// layout builds a GSUB or GPOS table.  scripts maps script tags to the feature indexes of their default LangSys,
+// features are (tag, lookup index) pairs, and lookups are complete lookup tables.
+func layout(scripts map[string][]int, features [][2]interface{}, lookups [][]byte) []byte {
+	var tags []string
+	for t := range scripts {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	scriptList := b(len(tags))
+	var scriptTables []byte
+	for _, t := range tags {
+		scriptList = append(scriptList, b(t, 2+6*len(tags)+len(scriptTables))...)
+		langSys := b(0, 0xffff, len(scripts[t]))
+		for _, f := range scripts[t] {
+			langSys = append(langSys, b(f)...)
+		}
+		scriptTables = append(scriptTables, b(4, 0, langSys)...)
+	}
+	scriptList = append(scriptList, scriptTables...)
+
+	featureList := b(len(features))
+	var featureTables []byte
+	for _, f := range features {
+		featureList = append(featureList, b(f[0].(string), 2+6*len(features)+len(featureTables))...)
+		featureTables = append(featureTables, b(0, 1, f[1].(int))...)
+	}
+	featureList = append(featureList, featureTables...)
+
+	lookupList := b(len(lookups))
+	var lookupTables []byte
+	for _, l := range lookups {
+		lookupList = append(lookupList, b(2+2*len(lookups)+len(lookupTables))...)
+		lookupTables = append(lookupTables, l...)
+	}
+	lookupList = append(lookupList, lookupTables...)
+
+	return b(1, 0, 10, 10+len(scriptList), 10+len(scriptList)+len(featureList), scriptList, featureList, lookupList)
+}
+
+// lookup wraps subtables in a lookup table.
+func lookup(kind int, subs ...[]byte) []byte {
+	out := b(kind, 0, len(subs))
+	at := 6 + 2*len(subs)
+	for _, sub := range subs {
+		out = append(out, b(at)...)
+		at += len(sub)
+	}
+	for _, sub := range subs {
+		out = append(out, sub...)
+	}
+	return out
+}
+
+// extension wraps a subtable of another lookup type, for an extension lookup (GSUB type 7, GPOS type 9).
+func extension(kind int, sub []byte) []byte {
+	return b(1, kind, uint32(8), sub)
+}
+
+// ligature is a ligature substitution of f i into glyph.
+func ligature(glyph int) []byte {
+	// Format, coverage at 8, one set at 14; coverage [f]; set with one ligature at 4; the ligature
+	return b(1, 8, 1, 14, 1, 1, 3, 1, 4, glyph, 2, 4)
+}
+
+func gsub() []byte {
+	return layout(
+		map[string][]int{"cyrl": {0}, "latn": {1}},
+		[][2]interface{}{{"liga", 0}, {"liga", 1}},
+		[][]byte{lookup(4, ligature(1)), lookup(4, ligature(5))},
+	)
+}
+
+func gpos() []byte {
+	// Mark to base: mark coverage at 12, base coverage at 18, one class, mark array at 26, base array at 38
+	markCov := b(1, 1, 6)
+	baseCov := b(1, 2, 1, 3)
+	markArray := b(1, 0, 6, 1, 100, 650)               // One record: class 0, anchor at 6
+	baseArray := b(2, 6, 12, 1, 300, 700, 1, 150, 700) // A's anchor at 6, f's at 12
+	mark := b(1, 12, 18, 1, 26, 38, markCov, baseCov, markArray, baseArray)
+	return layout(
+		map[string][]int{"DFLT": {0, 1}, "latn": {0, 1}},
+		[][2]interface{}{{"kern", 0}, {"mark", 1}},
+		[][]byte{lookup(9, extension(2, kern(1, 2, -150)), extension(2, kern(2, 1, -100))), lookup(4, mark)},
+	)
+}
+
+// kern is a pair adjustment of the first glyph's advance when followed by second.
+func kern(first, second, value int) []byte {
+	// Format 1: coverage at 12, XAdvance for the first glyph only, one pair set at 18
+	return b(1, 12, 4, 0, 1, 18, 1, 1, first, 1, second, value&0xffff)
+}
+
+func gdef() []byte {
+	return b(1, 0, 12, 0, 0, 0, 1, 1, 6, 1, 1, 1, 1, 2, 3)
+}
+
+// sfnt assembles the tables into a font file, with checksums and the head checksum adjustment.
+func sfnt(tables map[string][]byte) []byte {
+	var tags []string
+	for t := range tables {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	n := len(tags)
+	sr, es := 1, 0
+	for sr*2 <= n {
+		sr, es = sr*2, es+1
+	}
+	out := b(uint32(0x00010000), n, sr*16, es, n*16-sr*16)
+	offset := 12 + 16*n
+	var data []byte
+	for _, t := range tags {
+		d := tables[t]
+		out = append(out, b(t, checksum(d), uint32(offset+len(data)), uint32(len(d)))...)
+		data = append(data, d...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	out = append(out, data...)
+	headAt := int(binary.BigEndian.Uint32(out[12+16*sort.SearchStrings(tags, "head")+8:]))
+	binary.BigEndian.PutUint32(out[headAt+8:], 0xB1B0AFBA-checksum(out))
+	return out
+}
+
+func checksum(d []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(d); i += 4 {
+		var w [4]byte
+		copy(w[:], d[i:])
+		sum += binary.BigEndian.Uint32(w[:])
+	}
+	return sum
+}
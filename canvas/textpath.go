@@ -0,0 +1,184 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"math"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dbase"
+)
+
+// PathOverflow is what happens to glyphs that don't fit on the path.
+type PathOverflow int
+
+const (
+	OverflowHide   PathOverflow = iota // Glyphs whose centre falls off either end of the path are dropped
+	OverflowExtend                     // Glyphs carry on in a straight line past the ends of the path
+	OverflowWrap                       // Glyphs wrap around to the start of the path.  Meant for closed paths such as circles
+	OverflowFit                        // The font size is reduced so the whole string fits
+)
+
+// PathTextOptions control how text is laid along a path.
+type PathTextOptions struct {
+	Offset    float64   // Distance along the path where the text area starts, in pixels
+	Align     TextAlign // Alignment of the text within the rest of the path after Offset.  Left and Start are the start of the path
+	Shift     float64   // Baseline shift away from the path, in pixels.  Positive moves the text to the left of the direction of travel, which is up for a left to right path
+	Overflow  PathOverflow
+	Direction TextDirection
+}
+
+// TextOnPath lays text out along path, and returns the outlines of the glyphs, each rotated to follow the path.
+// Lines, quadratic and cubic Béziers and arcs are all followed.  Sub paths are joined end to end, so text can run across several.
+// The result is in the same coordinates as path, ready to fill with a GraphicContext.
+func (f *FontCache) TextOnPath(tf *truetype.Font, size float64, text string, path *draw2d.Path, opts PathTextOptions) (*draw2d.Path, error) {
+	out := new(draw2d.Path)
+	if tf == nil || path == nil {
+		return out, nil
+	}
+	track := flattenPath(path)
+
+	p := resolveBidi(text, opts.Direction)
+	run := layoutLine(f, tf, size, p, 0, len(p.runes))
+	avail := track.length - opts.Offset
+	if opts.Overflow == OverflowFit && run.advance > avail && avail > 0 {
+		size *= avail / run.advance
+		run = layoutLine(f, tf, size, p, 0, len(p.runes))
+	}
+	start := opts.Offset + alignLine(opts.Align, p.base == 1, avail, run.advance)
+
+	glyph := new(draw2d.Path)
+	for _, g := range run.glyphs {
+		// Marks stay with their base, so the pair is turned as one
+		a := g
+		if g.attached {
+			a = run.glyphs[g.base]
+		}
+		mid := start + a.x + a.advance/2
+		switch opts.Overflow {
+		case OverflowHide:
+			if mid < 0 || mid > track.length {
+				continue
+			}
+		case OverflowWrap:
+			if track.length > 0 {
+				mid = math.Mod(mid, track.length)
+				if mid < 0 {
+					mid += track.length
+				}
+			}
+		}
+		x, y, angle := track.at(mid)
+
+		glyph.Clear()
+		if err := GlyphPath(glyph, g.font, size, g.index, g.x-a.x-a.advance/2, g.y-opts.Shift); err != nil {
+			return out, err
+		}
+		tr := draw2d.NewTranslationMatrix(x, y)
+		tr.Rotate(angle)
+		appendTransformed(out, glyph, tr)
+	}
+	return out, nil
+}
+
+// appendTransformed adds src to dst with tr applied to every point.  src must not contain arcs, which glyph outlines never do.
+func appendTransformed(dst, src *draw2d.Path, tr draw2d.Matrix) {
+	pts := make([]float64, len(src.Points))
+	copy(pts, src.Points)
+	tr.Transform(pts)
+	i := 0
+	for _, cmp := range src.Components {
+		switch cmp {
+		case draw2d.MoveToCmp:
+			dst.MoveTo(pts[i], pts[i+1])
+			i += 2
+		case draw2d.LineToCmp:
+			dst.LineTo(pts[i], pts[i+1])
+			i += 2
+		case draw2d.QuadCurveToCmp:
+			dst.QuadCurveTo(pts[i], pts[i+1], pts[i+2], pts[i+3])
+			i += 4
+		case draw2d.CubicCurveToCmp:
+			dst.CubicCurveTo(pts[i], pts[i+1], pts[i+2], pts[i+3], pts[i+4], pts[i+5])
+			i += 6
+		case draw2d.ArcToCmp:
+			i += 6
+		case draw2d.CloseCmp:
+			dst.Close()
+		}
+	}
+}
+
+// pathTrack is a path flattened into line segments, with the distance along the path to the end of each one.
+type pathTrack struct {
+	segs   []trackSegment
+	length float64
+
+	x, y           float64 // Current point while flattening
+	startX, startY float64 // Start of the current subpath, which Close goes back to
+}
+
+type trackSegment struct {
+	x0, y0, x1, y1 float64
+	end            float64 // Distance along the path at x1, y1
+}
+
+// flattenPath turns path into segments, using the same curve flattening draw2d uses to draw it.
+func flattenPath(path *draw2d.Path) *pathTrack {
+	t := &pathTrack{}
+	draw2dbase.Flatten(path, t, 1)
+	return t
+}
+
+// pathTrack implements draw2dbase.Flattener
+func (t *pathTrack) MoveTo(x, y float64) {
+	t.x, t.y = x, y
+	t.startX, t.startY = x, y
+}
+
+func (t *pathTrack) LineTo(x, y float64) {
+	l := math.Hypot(x-t.x, y-t.y)
+	if l > 0 {
+		t.length += l
+		t.segs = append(t.segs, trackSegment{t.x, t.y, x, y, t.length})
+	}
+	t.x, t.y = x, y
+}
+
+// Close adds the segment back to the start of the subpath.  draw2d's Flatten also draws it first, in which case this one is empty.
+func (t *pathTrack) Close() {
+	t.LineTo(t.startX, t.startY)
+}
+
+func (t *pathTrack) LineJoin() {}
+func (t *pathTrack) End()      {}
+
+// at returns the point at distance d along the path, and the angle of the path there.
+// Distances before the start or past the end continue along the first or last segment.
+func (t *pathTrack) at(d float64) (x, y, angle float64) {
+	if len(t.segs) == 0 {
+		return t.x + d, t.y, 0
+	}
+	i := sort.Search(len(t.segs), func(i int) bool { return t.segs[i].end >= d })
+	if i == len(t.segs) {
+		i--
+	}
+	s := t.segs[i]
+	l := math.Hypot(s.x1-s.x0, s.y1-s.y0)
+	u := (d - (s.end - l)) / l
+	return s.x0 + (s.x1-s.x0)*u, s.y0 + (s.y1-s.y0)*u, math.Atan2(s.y1-s.y0, s.x1-s.x0)
+}
@@ -0,0 +1,90 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package canvas
+
+import (
+	"math"
+	"testing"
+
+	"github.com/llgcode/draw2d"
+	"github.com/llgcode/draw2d/draw2dkit"
+)
+
+func TestPathTrackClosed(t *testing.T) {
+	rect := new(draw2d.Path)
+	draw2dkit.Rectangle(rect, 0, 0, 100, 50)
+
+	twoTriangles := new(draw2d.Path)
+	twoTriangles.MoveTo(0, 0)
+	twoTriangles.LineTo(30, 0)
+	twoTriangles.LineTo(30, 40)
+	twoTriangles.Close()
+	twoTriangles.MoveTo(100, 0)
+	twoTriangles.LineTo(130, 0)
+	twoTriangles.LineTo(130, 40)
+	twoTriangles.Close()
+
+	circle := new(draw2d.Path)
+	draw2dkit.Circle(circle, 0, 0, 50)
+
+	tests := []struct {
+		name   string
+		path   *draw2d.Path
+		length float64
+		slack  float64
+	}{
+		{"rect", rect, 300, 0},
+		{"two triangles", twoTriangles, 240, 0},
+		{"circle", circle, 2 * math.Pi * 50, 1}, // Flattened, so a touch short
+	}
+	for _, tt := range tests {
+		if l := flattenPath(tt.path).length; math.Abs(l-tt.length) > tt.slack+1e-9 {
+			t.Errorf("%s: length %v, want %v", tt.name, l, tt.length)
+		}
+	}
+
+	// Close goes back to the start of the subpath even when the flattener hasn't drawn that segment itself
+	track := &pathTrack{}
+	track.MoveTo(10, 10)
+	track.LineTo(40, 10)
+	track.LineTo(40, 50)
+	track.Close()
+	if track.length != 120 {
+		t.Errorf("closed by hand: length %v, want 120", track.length)
+	}
+	x, y, angle := track.at(95) // Half way back along the closing segment
+	if math.Abs(x-25) > 1e-9 || math.Abs(y-30) > 1e-9 || math.Abs(angle-math.Atan2(-40, -30)) > 1e-9 {
+		t.Errorf("at(95) = %v, %v, %v, want 25, 30 on the closing segment", x, y, angle)
+	}
+}
+
+func TestTextOnClosedPath(t *testing.T) {
+	fc, f := testFonts(t)
+	rect := new(draw2d.Path)
+	draw2dkit.Rectangle(rect, 0, 0, 100, 50)
+
+	// Right aligned text ends on the closing edge, the left side going up
+	glyphs, err := fc.TextOnPath(f, 12, "ABC", rect, PathTextOptions{Align: AlignRight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var minX, maxX = math.Inf(1), math.Inf(-1)
+	for i := 0; i < len(glyphs.Points); i += 2 {
+		minX, maxX = math.Min(minX, glyphs.Points[i]), math.Max(maxX, glyphs.Points[i])
+	}
+	if len(glyphs.Points) == 0 || maxX > 20 || minX < -20 {
+		t.Errorf("right aligned glyphs span x %v to %v, want them on the left edge", minX, maxX)
+	}
+}
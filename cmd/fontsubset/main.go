@@ -0,0 +1,178 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// fontsubset cuts a TrueType font down to the characters an app actually draws, so the wasm download shrinks.
+// The characters come from -chars / -charset, and / or from the string literals of the Go sources under -scan.
+// Output is a Go file in the same form as canvas/font.go, ready to drop in place of it, or a plain .ttf with -raw.
+//
+//	go run ./cmd/fontsubset -scan ./demo -charset ascii -o canvas/font.go
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/markfarnan/go-canvas/canvas"
+)
+
+// Named character sets for -charset
+var charsets = map[string]string{
+	"digits": "0123456789",
+	"ascii":  asciiRange(0x20, 0x7e),
+	"latin":  asciiRange(0x20, 0x7e) + asciiRange(0xa0, 0xff),
+}
+
+func asciiRange(lo, hi rune) string {
+	var b strings.Builder
+	for r := lo; r <= hi; r++ {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func main() {
+	in := flag.String("font", "", "TrueType font to subset (defaults to the canvas built in font)")
+	chars := flag.String("chars", "", "Characters to keep")
+	charset := flag.String("charset", "", "Named character sets to keep, comma separated: digits, ascii, latin")
+	scan := flag.String("scan", "", "Directory of Go sources whose string literals are kept, searched recursively")
+	out := flag.String("o", "", "Output file (defaults to stdout)")
+	pkg := flag.String("pkg", "canvas", "Package name for the generated Go file")
+	name := flag.String("name", "font.ttf", "Key of the font in the generated FontData")
+	raw := flag.Bool("raw", false, "Write the subsetted .ttf itself rather than a Go file")
+	flag.Parse()
+
+	data := canvas.FontData["font.ttf"]
+	if *in != "" {
+		var err error
+		if data, err = ioutil.ReadFile(*in); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	keep := make(map[rune]bool)
+	for _, r := range *chars {
+		keep[r] = true
+	}
+	if *charset != "" {
+		for _, n := range strings.Split(*charset, ",") {
+			set, ok := charsets[strings.TrimSpace(n)]
+			if !ok {
+				log.Fatalf("unknown charset %q", n)
+			}
+			for _, r := range set {
+				keep[r] = true
+			}
+		}
+	}
+	if *scan != "" {
+		if err := scanLiterals(*scan, keep); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(keep) == 0 {
+		log.Fatal("nothing to keep: use -chars, -charset or -scan")
+	}
+	runes := make([]rune, 0, len(keep))
+	for r := range keep {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(a, b int) bool { return runes[a] < runes[b] })
+
+	sub, err := canvas.SubsetFont(data, runes)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	if *raw {
+		bw.Write(sub)
+	} else {
+		writeGo(bw, *pkg, *name, len(runes), sub)
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d characters, %d bytes -> %d bytes", len(runes), len(data), len(sub))
+}
+
+// scanLiterals adds the runes of every string and character literal in the Go files under dir.
+func scanLiterals(dir string, keep map[rune]bool) error {
+	fset := token.NewFileSet()
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || (lit.Kind != token.STRING && lit.Kind != token.CHAR) {
+				return true
+			}
+			// Unquote takes char literals as they are, giving the one rune
+			if u, err := strconv.Unquote(lit.Value); err == nil {
+				for _, r := range u {
+					keep[r] = true
+				}
+			}
+			return true
+		})
+		return nil
+	})
+}
+
+// writeGo writes the font as a folder2go style FontData map, as canvas/font.go is.
+func writeGo(w io.Writer, pkg, name string, chars int, data []byte) {
+	fmt.Fprintf(w, "// Package font -- Generated by fontsubset, keeping %d characters\n", chars)
+	fmt.Fprintf(w, "package %s\n\n", pkg)
+	fmt.Fprintf(w, "type fs map[string][]byte\n\n")
+	fmt.Fprintf(w, "var (\n\t// Data contains the binarized folder\n\tFontData = fs{\n\t\t%q: []byte{\n", name)
+	for i := 0; i < len(data); i += 20 {
+		fmt.Fprint(w, "\t\t\t")
+		for j := i; j < i+20 && j < len(data); j++ {
+			if j > i {
+				fmt.Fprint(w, " ")
+			}
+			fmt.Fprintf(w, "0x%02X,", data[j])
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprint(w, "\t\t},\n\t}\n)\n")
+}
@@ -0,0 +1,54 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanLiterals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fontsubset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := "package x\n\nvar (\n" +
+		"\ta = '\\''\n" +
+		"\tb = '\"'\n" +
+		"\tc = '\\\\'\n" +
+		"\td = '\\u00e9'\n" +
+		"\te = 'ж'\n" +
+		"\tf = \"hi\\t\"\n" +
+		"\tg = `raw`\n" +
+		")\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keep := make(map[rune]bool)
+	if err := scanLiterals(dir, keep); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range "'\"\\éжhi\traw" {
+		if !keep[r] {
+			t.Errorf("%q not kept", r)
+		}
+	}
+	if len(keep) != 11 {
+		t.Errorf("%d runes kept, want 11", len(keep))
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// spritepack packs loose PNG sprites into one sprite sheet image, and writes its frames out as TexturePacker JSON
+// for canvas.ParseSpriteSheet (or most game engines) to load.  Directories are searched for PNGs, and the frames
+// are named by their path within the directory.
+//
+//	go run ./cmd/spritepack -o assets/sheet.png -trim -padding 2 sprites/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/markfarnan/go-canvas/canvas"
+)
+
+func main() {
+	out := flag.String("o", "sheet.png", "Sprite sheet image to write")
+	jsonOut := flag.String("json", "", "Frames JSON to write; defaults to the image name with .json")
+	padding := flag.Int("padding", 1, "Transparent pixels between sprites")
+	trim := flag.Bool("trim", false, "Trim transparent borders off sprites")
+	maxWidth := flag.Int("max", 4096, "Widest the sheet may be")
+	pot := flag.Bool("pot", false, "Make the sheet's sides powers of two")
+	pivot := flag.String("pivot", "", "Pivot for every frame, as a fraction of its size, such as 0.5,1 for bottom centre")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: spritepack [flags] sprite.png... | dir...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	var px, py float64
+	if *pivot != "" {
+		if _, err := fmt.Sscanf(*pivot, "%g,%g", &px, &py); err != nil {
+			log.Fatalf("bad pivot %q", *pivot)
+		}
+	}
+
+	names, files, err := findPNGs(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	imgs := make([]image.Image, len(files))
+	for i, f := range files {
+		if imgs[i], err = readPNG(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sheet, err := canvas.PackSpriteSheet(names, imgs, canvas.PackOptions{
+		Padding:    *padding,
+		Trim:       *trim,
+		MaxWidth:   *maxWidth,
+		PowerOfTwo: *pot,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range sheet.Frames() {
+		f.PivotX, f.PivotY = px, py
+	}
+
+	if err := writePNG(*out, sheet.Image()); err != nil {
+		log.Fatal(err)
+	}
+	if *jsonOut == "" {
+		*jsonOut = strings.TrimSuffix(*out, filepath.Ext(*out)) + ".json"
+	}
+	f, err := os.Create(*jsonOut)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sheet.WriteJSON(f, filepath.Base(*out)); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	size := sheet.Image().Rect.Size()
+	fmt.Printf("%d sprites packed into %dx%d: %s, %s\n", len(names), size.X, size.Y, *out, *jsonOut)
+}
+
+// findPNGs expands the arguments into PNG files, with the frame name for each.
+func findPNGs(args []string) ([]string, []string, error) {
+	var names, files []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			names, files = append(names, filepath.Base(arg)), append(files, arg)
+			continue
+		}
+		var found []string
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".png") {
+				found = append(found, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		sort.Strings(found)
+		for _, path := range found {
+			rel, _ := filepath.Rel(arg, path)
+			names, files = append(names, filepath.ToSlash(rel)), append(files, path)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, n := range names {
+		if seen[n] {
+			return nil, nil, fmt.Errorf("two sprites named %q", n)
+		}
+		seen[n] = true
+	}
+	return names, files, nil
+}
+
+func readPNG(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return img, nil
+}
+
+func writePNG(name string, img image.Image) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
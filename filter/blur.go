@@ -0,0 +1,163 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package filter
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// GaussianBlur blurs with a Gaussian of standard deviation Sigma pixels, as CSS blur() does with its length.
+// It is approximated by three box blurs each way, so costs the same whatever the radius.
+type GaussianBlur struct {
+	Sigma float64
+}
+
+// Blur returns a Gaussian blur of standard deviation sigma pixels.
+func Blur(sigma float64) GaussianBlur {
+	return GaussianBlur{sigma}
+}
+
+// Apply blurs r of src into dst.  Edge pixels are repeated past the sides of r.
+func (g GaussianBlur) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	if g.Sigma <= 0 {
+		copyRect(dst, src, r)
+		return
+	}
+	tmp := getScratch(dst.Rect)
+	defer scratch.Put(tmp)
+	for i, b := range GaussBoxes(g.Sigma, 3) {
+		if i > 0 {
+			src = dst // Later passes blur dst again, through tmp
+		}
+		boxRows(tmp, src, r, b/2)
+		boxColumns(dst, tmp, r, b/2)
+	}
+}
+
+// BoxBlur averages each pixel with those within Radius pixels across and down.
+type BoxBlur struct {
+	Radius int
+}
+
+// Apply box blurs r of src into dst.  Edge pixels are repeated past the sides of r.
+func (b BoxBlur) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	tmp := getScratch(dst.Rect)
+	defer scratch.Put(tmp)
+	boxRows(tmp, src, r, b.Radius)
+	boxColumns(dst, tmp, r, b.Radius)
+}
+
+// Frame sized scratch images for the two pass blurs
+var scratch sync.Pool
+
+func getScratch(r image.Rectangle) *image.RGBA {
+	if m, ok := scratch.Get().(*image.RGBA); ok && m.Rect == r {
+		return m
+	}
+	return image.NewRGBA(r)
+}
+
+// boxRows box blurs each row of r of src across, into dst.
+func boxRows(dst, src *image.RGBA, r image.Rectangle, radius int) {
+	parallel(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			boxLine(dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)], src.Pix[src.PixOffset(r.Min.X, y):src.PixOffset(r.Max.X, y)], r.Dx(), radius)
+		}
+	})
+}
+
+// boxColumns box blurs r of src down, into dst.  Bands of columns are summed a row at a time, which keeps to the cache.
+func boxColumns(dst, src *image.RGBA, r image.Rectangle, radius int) {
+	size := 2*radius + 1
+	inv := (1<<16 + size/2) / size
+	const half = 1 << 15
+	parallel(r.Min.X, r.Max.X, func(x0, x1 int) {
+		n := 4 * (x1 - x0)
+		sum := make([]int, n)
+		row := func(y int) []uint8 {
+			o := src.PixOffset(x0, clampInt(y, r.Min.Y, r.Max.Y-1))
+			return src.Pix[o : o+n : o+n]
+		}
+		for i := -radius; i <= radius; i++ {
+			for k, v := range row(r.Min.Y + i) {
+				sum[k] += int(v)
+			}
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			o := dst.PixOffset(x0, y)
+			d := dst.Pix[o : o+n : o+n]
+			for k, v := range sum {
+				d[k] = uint8((v*inv + half) >> 16)
+			}
+			in, out := row(y+radius+1), row(y-radius)
+			for k := range sum {
+				sum[k] += int(in[k]) - int(out[k])
+			}
+		}
+	})
+}
+
+// boxLine writes the box blur of the n pixels in line to dst.
+func boxLine(dst, line []uint8, n, radius int) {
+	var s0, s1, s2, s3 int
+	for i := -radius; i <= radius; i++ {
+		j := 4 * clampInt(i, 0, n-1)
+		s0, s1, s2, s3 = s0+int(line[j]), s1+int(line[j+1]), s2+int(line[j+2]), s3+int(line[j+3])
+	}
+	// Divide by the box size as a 16.16 multiply
+	size := 2*radius + 1
+	inv := (1<<16 + size/2) / size
+	const half = 1 << 15
+	for i, o := 0, 0; i < n; i, o = i+1, o+4 {
+		d := dst[o : o+4 : o+4]
+		d[0], d[1], d[2], d[3] = uint8((s0*inv+half)>>16), uint8((s1*inv+half)>>16), uint8((s2*inv+half)>>16), uint8((s3*inv+half)>>16)
+		in, out := i+radius+1, i-radius
+		if in >= n {
+			in = n - 1
+		}
+		if out < 0 {
+			out = 0
+		}
+		a, b := line[4*in:4*in+4:4*in+4], line[4*out:4*out+4:4*out+4]
+		s0 += int(a[0]) - int(b[0])
+		s1 += int(a[1]) - int(b[1])
+		s2 += int(a[2]) - int(b[2])
+		s3 += int(a[3]) - int(b[3])
+	}
+}
+
+// GaussBoxes returns n box widths whose successive box blurs approximate a Gaussian blur with standard deviation sigma.
+// The widths are odd, so each box centres on its pixel.  Blur uses three, and so does the canvas shadow.
+func GaussBoxes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	wl := int(math.Floor(ideal))
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+	mIdeal := (12*sigma*sigma - float64(n*wl*wl) - float64(4*n*wl) - float64(3*n)) / float64(-4*wl-4)
+	m := int(math.Round(mIdeal))
+	boxes := make([]int, n)
+	for i := range boxes {
+		if i < m {
+			boxes[i] = wl
+		} else {
+			boxes[i] = wu
+		}
+	}
+	return boxes
+}
@@ -0,0 +1,177 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package filter
+
+import (
+	"image"
+	"math"
+)
+
+// ColorMatrix maps each pixel's colour with a 4x5 matrix, as SVG feColorMatrix does.
+// Rows give the new red, green, blue and alpha from the old red, green, blue, alpha and a constant, all from 0 to 1.
+// Colours are unpremultiplied before, and premultiplied again after.
+type ColorMatrix [20]float64
+
+// Identity leaves colours alone.
+var Identity = ColorMatrix{
+	1, 0, 0, 0, 0,
+	0, 1, 0, 0, 0,
+	0, 0, 1, 0, 0,
+	0, 0, 0, 1, 0,
+}
+
+// Brightness scales colours by amount, as CSS brightness(): 0 is black, 1 unchanged.
+func Brightness(amount float64) ColorMatrix {
+	return diagonal(amount, 0)
+}
+
+// Contrast scales colours around middle grey, as CSS contrast(): 0 is all grey, 1 unchanged.
+func Contrast(amount float64) ColorMatrix {
+	return diagonal(amount, 0.5-0.5*amount)
+}
+
+// Invert inverts colours by amount, as CSS invert(): 1 is fully inverted.
+func Invert(amount float64) ColorMatrix {
+	return diagonal(1-2*amount, amount)
+}
+
+// Opacity scales alpha, as CSS opacity().
+func Opacity(amount float64) ColorMatrix {
+	m := Identity
+	m[18] = amount
+	return m
+}
+
+// Saturate sets the colour saturation, as CSS saturate(): 0 is grey, 1 unchanged and above that more vivid.
+func Saturate(s float64) ColorMatrix {
+	return rgb(
+		0.213+0.787*s, 0.715-0.715*s, 0.072-0.072*s,
+		0.213-0.213*s, 0.715+0.285*s, 0.072-0.072*s,
+		0.213-0.213*s, 0.715-0.715*s, 0.072+0.928*s,
+	)
+}
+
+// Grayscale takes the colour out by amount, as CSS grayscale().
+func Grayscale(amount float64) ColorMatrix {
+	s := 1 - math.Min(1, amount)
+	return rgb(
+		0.2126+0.7874*s, 0.7152-0.7152*s, 0.0722-0.0722*s,
+		0.2126-0.2126*s, 0.7152+0.2848*s, 0.0722-0.0722*s,
+		0.2126-0.2126*s, 0.7152-0.7152*s, 0.0722+0.9278*s,
+	)
+}
+
+// Sepia tones colours by amount, as CSS sepia().
+func Sepia(amount float64) ColorMatrix {
+	s := 1 - math.Min(1, amount)
+	return rgb(
+		0.393+0.607*s, 0.769-0.769*s, 0.189-0.189*s,
+		0.349-0.349*s, 0.686+0.314*s, 0.168-0.168*s,
+		0.272-0.272*s, 0.534-0.534*s, 0.131+0.869*s,
+	)
+}
+
+// HueRotate turns colours around the colour wheel by angle radians, as CSS hue-rotate().
+func HueRotate(angle float64) ColorMatrix {
+	c, s := math.Cos(angle), math.Sin(angle)
+	return rgb(
+		0.213+c*0.787-s*0.213, 0.715-c*0.715-s*0.715, 0.072-c*0.072+s*0.928,
+		0.213-c*0.213+s*0.143, 0.715+c*0.285+s*0.140, 0.072-c*0.072-s*0.283,
+		0.213-c*0.213-s*0.787, 0.715-c*0.715+s*0.715, 0.072+c*0.928+s*0.072,
+	)
+}
+
+// Mul returns the matrix applying n and then m, so two colour filters can be done in one pass.
+func (m ColorMatrix) Mul(n ColorMatrix) ColorMatrix {
+	var out ColorMatrix
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 5; c++ {
+			var v float64
+			for k := 0; k < 4; k++ {
+				v += m[5*r+k] * n[5*k+c]
+			}
+			if c == 4 {
+				v += m[5*r+4]
+			}
+			out[5*r+c] = v
+		}
+	}
+	return out
+}
+
+// Apply maps the colours of src into dst, within r.
+func (m ColorMatrix) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	var f [20]float32
+	for i, v := range m {
+		f[i] = float32(v)
+	}
+	for i := 4; i < 20; i += 5 {
+		f[i] *= 255 // Constants in byte units
+	}
+	parallel(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			s := src.Pix[src.PixOffset(r.Min.X, y):src.PixOffset(r.Max.X, y)]
+			d := dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)]
+			for i := 0; i < len(s); i += 4 {
+				a := float32(s[i+3])
+				var cr, cg, cb float32
+				if a > 0 {
+					k := 255 / a
+					cr, cg, cb = float32(s[i])*k, float32(s[i+1])*k, float32(s[i+2])*k
+				}
+				nr := f[0]*cr + f[1]*cg + f[2]*cb + f[3]*a + f[4]
+				ng := f[5]*cr + f[6]*cg + f[7]*cb + f[8]*a + f[9]
+				nb := f[10]*cr + f[11]*cg + f[12]*cb + f[13]*a + f[14]
+				na := f[15]*cr + f[16]*cg + f[17]*cb + f[18]*a + f[19]
+				oa := clamp8(na)
+				k := float32(oa) / 255
+				d[i] = clamp8(clampF(nr) * k)
+				d[i+1] = clamp8(clampF(ng) * k)
+				d[i+2] = clamp8(clampF(nb) * k)
+				d[i+3] = oa
+			}
+		}
+	})
+}
+
+// diagonal scales red, green and blue by k and adds c.
+func diagonal(k, c float64) ColorMatrix {
+	return ColorMatrix{
+		k, 0, 0, 0, c,
+		0, k, 0, 0, c,
+		0, 0, k, 0, c,
+		0, 0, 0, 1, 0,
+	}
+}
+
+// rgb makes a matrix mixing only the colour channels, leaving alpha alone.
+func rgb(rr, rg, rb, gr, gg, gb, br, bg, bb float64) ColorMatrix {
+	return ColorMatrix{
+		rr, rg, rb, 0, 0,
+		gr, gg, gb, 0, 0,
+		br, bg, bb, 0, 0,
+		0, 0, 0, 1, 0,
+	}
+}
+
+func clampF(v float32) float32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
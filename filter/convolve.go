@@ -0,0 +1,143 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package filter
+
+import (
+	"image"
+)
+
+// Convolution replaces each pixel with a weighted sum of its neighbours, as SVG feConvolveMatrix does.
+// Kernel holds Width x Height weights, row by row, centred on the pixel.  The sum is divided by Divisor (by the kernel's total
+// if that's 0, or 1 if that is 0 too) and Bias, from 0 to 1, is added.  Colours are premultiplied throughout.
+// Alpha is left as it is unless ConvolveAlpha is set.
+type Convolution struct {
+	Kernel        []float64
+	Width, Height int
+	Divisor       float64
+	Bias          float64
+	ConvolveAlpha bool
+}
+
+// Convolve returns a convolution with a square kernel, which must have an odd number of rows.
+func Convolve(kernel ...float64) Convolution {
+	n := 1
+	for n*n < len(kernel) {
+		n++
+	}
+	return Convolution{Kernel: kernel, Width: n, Height: n}
+}
+
+// Sharpen sharpens edges by amount; 1 is a strong sharpen.
+func Sharpen(amount float64) Convolution {
+	a := amount
+	return Convolve(
+		0, -a, 0,
+		-a, 1+4*a, -a,
+		0, -a, 0,
+	)
+}
+
+// EdgeDetect leaves only the edges, as bright lines on black.
+func EdgeDetect() Convolution {
+	return Convolution{Kernel: []float64{
+		-1, -1, -1,
+		-1, 8, -1,
+		-1, -1, -1,
+	}, Width: 3, Height: 3, Divisor: 1}
+}
+
+// Emboss gives a raised relief look, lit from the top left.
+func Emboss() Convolution {
+	return Convolution{Kernel: []float64{
+		-2, -1, 0,
+		-1, 1, 1,
+		0, 1, 2,
+	}, Width: 3, Height: 3, Divisor: 1}
+}
+
+// Apply convolves r of src into dst.  Edge pixels are repeated past the sides of r.
+func (c Convolution) Apply(dst, src *image.RGBA, r image.Rectangle) {
+	if c.Width*c.Height == 0 || len(c.Kernel) < c.Width*c.Height {
+		copyRect(dst, src, r)
+		return
+	}
+	div := c.Divisor
+	if div == 0 {
+		for _, k := range c.Kernel[:c.Width*c.Height] {
+			div += k
+		}
+		if div == 0 {
+			div = 1
+		}
+	}
+	k := make([]float32, c.Width*c.Height)
+	for i := range k {
+		k[i] = float32(c.Kernel[i] / div)
+	}
+	bias := float32(c.Bias * 255)
+	cx, cy := c.Width/2, c.Height/2
+	parallel(r.Min.Y, r.Max.Y, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			d := dst.Pix[dst.PixOffset(r.Min.X, y):]
+			for x := r.Min.X; x < r.Max.X; x++ {
+				var sum [4]float32
+				for ky := 0; ky < c.Height; ky++ {
+					sy := clampInt(y+ky-cy, r.Min.Y, r.Max.Y-1)
+					row := src.Pix[src.PixOffset(src.Rect.Min.X, sy):]
+					for kx := 0; kx < c.Width; kx++ {
+						w := k[ky*c.Width+kx]
+						if w == 0 {
+							continue
+						}
+						sx := clampInt(x+kx-cx, r.Min.X, r.Max.X-1)
+						p := row[4*(sx-src.Rect.Min.X):]
+						sum[0] += w * float32(p[0])
+						sum[1] += w * float32(p[1])
+						sum[2] += w * float32(p[2])
+						sum[3] += w * float32(p[3])
+					}
+				}
+				i := 4 * (x - r.Min.X)
+				a := src.Pix[src.PixOffset(x, y)+3]
+				if c.ConvolveAlpha {
+					a = clamp8(sum[3] + bias)
+				}
+				// Keep colours premultiplied, no brighter than alpha
+				fa := float32(a)
+				d[i] = clamp8(minF(sum[0]+bias*fa/255, fa))
+				d[i+1] = clamp8(minF(sum[1]+bias*fa/255, fa))
+				d[i+2] = clamp8(minF(sum[2]+bias*fa/255, fa))
+				d[i+3] = a
+			}
+		}
+	})
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func minF(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
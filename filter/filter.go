@@ -0,0 +1,118 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package filter post-processes images, such as the canvas shadow frame, in the manner of the CSS filter property:
+// blurs, convolution kernels and colour matrices, chained one after another.
+// Work is split across goroutines by rows, so it uses all cores natively and costs nothing extra in single threaded wasm.
+package filter
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Filter is a single image operation.
+type Filter interface {
+	// Apply reads src and writes the filtered result to dst, within r only.  dst and src have the same bounds and are never the same image.
+	// Pixels outside r are not read, so a sub-rectangle is filtered as if it were the whole image.
+	Apply(dst, src *image.RGBA, r image.Rectangle)
+}
+
+// Chain applies filters one after another.  It keeps a scratch image between calls, so reuse it from frame to frame.
+type Chain struct {
+	Filters []Filter
+	buf     *image.RGBA
+}
+
+// NewChain returns a chain of the filters, applied in order.
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{Filters: filters}
+}
+
+// Add appends filters to the chain.
+func (c *Chain) Add(filters ...Filter) *Chain {
+	c.Filters = append(c.Filters, filters...)
+	return c
+}
+
+// Apply runs the chain over r of img, in place.
+func (c *Chain) Apply(img *image.RGBA, r image.Rectangle) {
+	r = r.Intersect(img.Rect)
+	if len(c.Filters) == 0 || r.Empty() {
+		return
+	}
+	if c.buf == nil || c.buf.Rect != img.Rect {
+		c.buf = image.NewRGBA(img.Rect)
+	}
+	src, dst := img, c.buf
+	for _, f := range c.Filters {
+		f.Apply(dst, src, r)
+		src, dst = dst, src
+	}
+	if src != img {
+		copyRect(img, src, r)
+	}
+}
+
+// Apply runs filters over r of img, in place.  Use a Chain instead when doing it every frame.
+func Apply(img *image.RGBA, r image.Rectangle, filters ...Filter) {
+	NewChain(filters...).Apply(img, r)
+}
+
+// copyRect copies r of src into dst.
+func copyRect(dst, src *image.RGBA, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)], src.Pix[src.PixOffset(r.Min.X, y):src.PixOffset(r.Max.X, y)])
+	}
+}
+
+// parallel calls fn for bands of [lo, hi), one per CPU, and waits for them all.
+func parallel(lo, hi int, fn func(lo, hi int)) {
+	n := runtime.GOMAXPROCS(0)
+	if n > hi-lo {
+		n = hi - lo
+	}
+	if n <= 1 {
+		if hi > lo {
+			fn(lo, hi)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	band := (hi - lo + n - 1) / n
+	for b := lo; b < hi; b += band {
+		e := b + band
+		if e > hi {
+			e = hi
+		}
+		wg.Add(1)
+		go func(b, e int) {
+			defer wg.Done()
+			fn(b, e)
+		}(b, e)
+	}
+	wg.Wait()
+}
+
+// clamp8 rounds v to a byte, clamping it to 0 to 255.
+func clamp8(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,194 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package filter
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// testFrame makes a colourful frame with hard edges and some transparency, so the filters have something to work on.
+func testFrame(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(255 * x / w), uint8(255 * y / h), 128, 255}
+			if (x/32+y/32)%2 == 0 {
+				c.B, c.A = 255, uint8(64+x%192)
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func cloneRGBA(m *image.RGBA) *image.RGBA {
+	c := *m
+	c.Pix = append([]uint8(nil), m.Pix...)
+	return &c
+}
+
+// maxDiff returns the biggest difference of any channel of the two images.
+func maxDiff(a, b *image.RGBA) int {
+	d := 0
+	for i := range a.Pix {
+		if v := int(a.Pix[i]) - int(b.Pix[i]); v > d {
+			d = v
+		} else if -v > d {
+			d = -v
+		}
+	}
+	return d
+}
+
+func TestIdentity(t *testing.T) {
+	src := testFrame(100, 70)
+	img := cloneRGBA(src)
+	Apply(img, img.Rect, Identity)
+	if d := maxDiff(img, src); d > 1 {
+		t.Errorf("identity matrix changed a channel by %d", d)
+	}
+
+	// A matrix times the identity is itself
+	if m := Sepia(0.7).Mul(Identity); m != Sepia(0.7) {
+		t.Errorf("sepia times identity is %v", m)
+	}
+}
+
+func TestConvolveDelta(t *testing.T) {
+	src := testFrame(100, 70)
+	img := cloneRGBA(src)
+	Apply(img, img.Rect, Convolve(
+		0, 0, 0,
+		0, 1, 0,
+		0, 0, 0,
+	))
+	if d := maxDiff(img, src); d != 0 {
+		t.Errorf("centred delta kernel changed a channel by %d", d)
+	}
+
+	// A delta left of centre takes each pixel from its left, so moves the image right, repeating the edge.
+	// Alpha too, as it's convolved.
+	img = cloneRGBA(src)
+	Apply(img, img.Rect, Convolution{Kernel: []float64{
+		0, 0, 0,
+		1, 0, 0,
+		0, 0, 0,
+	}, Width: 3, Height: 3, ConvolveAlpha: true})
+	for y := 0; y < 70; y++ {
+		for x := 0; x < 100; x++ {
+			sx := x - 1
+			if sx < 0 {
+				sx = 0
+			}
+			if got, want := img.RGBAAt(x, y), src.RGBAAt(sx, y); got != want {
+				t.Fatalf("shifted at %d, %d: %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestGaussBoxes(t *testing.T) {
+	for _, sigma := range []float64{0.5, 1, 2, 4.5, 10, 30} {
+		boxes := GaussBoxes(sigma, 3)
+		// Variances add, and a box of width w has variance (w² - 1) / 12
+		var v float64
+		for _, w := range boxes {
+			if w%2 == 0 {
+				t.Errorf("sigma %v: even box width %d", sigma, w)
+			}
+			v += float64(w*w-1) / 12
+		}
+		if s := math.Sqrt(v); math.Abs(s-sigma) > 0.5 {
+			t.Errorf("sigma %v: boxes %v give %v", sigma, boxes, s)
+		}
+	}
+}
+
+func TestBlur(t *testing.T) {
+	// A flat colour stays flat
+	img := image.NewRGBA(image.Rect(0, 0, 50, 40))
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:], []uint8{100, 50, 25, 200})
+	}
+	flat := cloneRGBA(img)
+	Apply(img, img.Rect, Blur(5))
+	if d := maxDiff(img, flat); d > 1 {
+		t.Errorf("blurring a flat colour changed a channel by %d", d)
+	}
+
+	// A dot spreads out symmetrically, and only within the rectangle given
+	img = image.NewRGBA(image.Rect(0, 0, 50, 40))
+	img.SetRGBA(20, 20, color.RGBA{255, 255, 255, 255})
+	r := image.Rect(0, 0, 40, 40)
+	Apply(img, r, Blur(2))
+	if a, b := img.RGBAAt(17, 20), img.RGBAAt(23, 20); a != b || a.A == 0 {
+		t.Errorf("either side of the dot: %v and %v", a, b)
+	}
+	if a, b := img.RGBAAt(20, 17), img.RGBAAt(20, 23); a != b || a.A == 0 {
+		t.Errorf("above and below the dot: %v and %v", a, b)
+	}
+	if c := img.RGBAAt(20, 20); c.A == 0 || c.A == 255 {
+		t.Errorf("centre of the dot is %v", c)
+	}
+	for y := 0; y < 40; y++ {
+		for x := 40; x < 50; x++ {
+			if c := img.RGBAAt(x, y); c.A != 0 {
+				t.Fatalf("blurred outside the rectangle at %d, %d: %v", x, y, c)
+			}
+		}
+	}
+}
+
+func BenchmarkFilters(b *testing.B) {
+	five := make([]float64, 25)
+	for i := range five {
+		five[i] = 1
+	}
+	frame := testFrame(1280, 720)
+	benchmarks := []struct {
+		name   string
+		filter Filter
+	}{
+		{"blur2", Blur(2)},
+		{"blur20", Blur(20)},
+		{"sharpen", Sharpen(1)},
+		{"convolve5x5", Convolve(five...)},
+		{"grayscale", Grayscale(1)},
+		{"sepiaSaturate", Sepia(1).Mul(Saturate(1.5))},
+		{"hueRotate", HueRotate(1)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			chain := NewChain(bm.filter)
+			img := cloneRGBA(frame)
+			b.SetBytes(int64(len(img.Pix)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				chain.Apply(img, img.Rect)
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse("blur(4px) sepia(1) hue-rotate(90deg) contrast(120%)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright [2019] [Mark Farnan]
+
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+
+//        http://www.apache.org/licenses/LICENSE-2.0
+
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parse makes a chain from a CSS filter string, such as "blur(4px) brightness(120%) sepia(0.5)".
+// blur, brightness, contrast, grayscale, hue-rotate, invert, opacity, saturate and sepia are understood, plus "none".
+func Parse(s string) (*Chain, error) {
+	c := NewChain()
+	s = strings.TrimSpace(s)
+	if s == "none" || s == "" {
+		return c, nil
+	}
+	for s != "" {
+		open := strings.IndexByte(s, '(')
+		end := strings.IndexByte(s, ')')
+		if open < 0 || end < open {
+			return nil, fmt.Errorf("filter: bad filter %q", s)
+		}
+		name, arg := strings.TrimSpace(s[:open]), strings.TrimSpace(s[open+1:end])
+		s = strings.TrimSpace(s[end+1:])
+
+		if name == "blur" {
+			px := 0.0
+			if arg != "" {
+				v, err := strconv.ParseFloat(strings.TrimSuffix(arg, "px"), 64)
+				if err != nil {
+					return nil, fmt.Errorf("filter: bad blur length %q", arg)
+				}
+				px = v
+			}
+			c.Add(Blur(px))
+			continue
+		}
+		if name == "hue-rotate" {
+			a, err := parseAngle(arg)
+			if err != nil {
+				return nil, err
+			}
+			c.Add(HueRotate(a))
+			continue
+		}
+
+		f, ok := map[string]func(float64) ColorMatrix{
+			"brightness": Brightness,
+			"contrast":   Contrast,
+			"grayscale":  Grayscale,
+			"invert":     Invert,
+			"opacity":    Opacity,
+			"saturate":   Saturate,
+			"sepia":      Sepia,
+		}[name]
+		if !ok {
+			return nil, fmt.Errorf("filter: unknown filter %q", name)
+		}
+		v := 1.0 // The default amount for all of these
+		if arg != "" {
+			var err error
+			if v, err = parseAmount(arg); err != nil {
+				return nil, err
+			}
+		}
+		if name != "brightness" && name != "contrast" && name != "saturate" {
+			v = math.Min(v, 1)
+		}
+		c.Add(f(v))
+	}
+	return c, nil
+}
+
+// parseAmount parses a number or percentage.
+func parseAmount(s string) (float64, error) {
+	scale := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, scale = s[:len(s)-1], 0.01
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("filter: bad amount %q", s)
+	}
+	return v * scale, nil
+}
+
+// parseAngle parses a CSS angle into radians.
+func parseAngle(s string) (float64, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"deg", math.Pi / 180}, {"grad", math.Pi / 200}, {"rad", 1}, {"turn", 2 * math.Pi}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+			if err != nil {
+				break
+			}
+			return v * u.scale, nil
+		}
+	}
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("filter: bad angle %q", s)
+}
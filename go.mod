@@ -5,4 +5,6 @@ go 1.13
 require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/llgcode/draw2d v0.0.0-20200110163050-b96d8208fcfc
+	golang.org/x/image v0.0.0-20180708004352-c73c2afc3b81
+	golang.org/x/text v0.3.6
 )